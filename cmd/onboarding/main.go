@@ -2,15 +2,22 @@ package main
 
 import (
 	"context"
+	"net"
 	"net/http"
+	"os"
 
 	health "chaits.org/go-microservices-repo/internal/handlers"
 	handlers "chaits.org/go-microservices-repo/internal/handlers/onboarding"
 	"chaits.org/go-microservices-repo/internal/repositories"
 	appserver "chaits.org/go-microservices-repo/internal/server"
+	"chaits.org/go-microservices-repo/pkg/general/config"
 	"chaits.org/go-microservices-repo/pkg/general/logger"
+	"chaits.org/go-microservices-repo/pkg/general/ratelimit"
 	"chaits.org/go-microservices-repo/pkg/general/tracing"
+	"chaits.org/go-microservices-repo/pkg/network/discovery"
+	"chaits.org/go-microservices-repo/pkg/network/httpclient"
 	"chaits.org/go-microservices-repo/pkg/network/middleware"
+	sqldb "chaits.org/go-microservices-repo/pkg/storage/sqldb/connectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
@@ -18,26 +25,59 @@ const serviceName = "onboarding"
 
 func main() {
 	logger.Init(serviceName)
-	shutdownTracer := tracing.InitTracer(context.Background(), serviceName)
+
+	env := os.Getenv("APP_ENV")
+	if env == "" {
+		env = "dev"
+	}
+	appConfig := config.InitConfigs(env)
+	appConfig.LoadConfigs()
+
+	shutdownTracer := tracing.InitTracer(context.Background(), serviceName, tracing.WithAppConfig(appConfig))
 	defer shutdownTracer()
 
 	repos, err := repositories.NewMySQLDBManager()
 	if err != nil {
-		logger.Logger.WithError(err).Error("error getting DB manager")
+		logger.Logger.WithError(err).Fatal("error getting DB manager")
 	}
 
-	middlewares := middleware.AllMiddlewareManager(serviceName, repos.AppRepo)
+	// Plans are changed by operators with an admin bearer token, not by apps.
+	if err := httpclient.LoadJWTSigningKey(context.Background(), appConfig, httpclient.EnvSecretStore{}); err != nil {
+		logger.Logger.WithError(err).Fatal("JWT signing key error")
+	}
+
+	rateLimits, err := middleware.AppRateLimitConfigFromApp(appConfig)
+	if err != nil {
+		logger.Logger.WithError(err).Fatal("Rate limit configuration error")
+	}
+	rateLimits.Store, err = ratelimit.StoreFromApp(appConfig, repos.DB, sqldb.DB_MYSQL)
+	if err != nil {
+		logger.Logger.WithError(err).Fatal("Rate limit store error")
+	}
+
+	middlewares := middleware.AllMiddlewareManager(serviceName, repos.AppRepo, rateLimits)
+	adminMiddlewares := middleware.AdminMiddlewareManager(serviceName)
 	appsHandler := handlers.NewAppsHandler(repos)
 
 	http.Handle("/apps/list", middlewares.Then(appsHandler.GetAppsHandler, "getapps-handler"))
 	http.Handle("/apps/create", middlewares.Then(appsHandler.RegisterAppHandler, "register-app-handler"))
 	http.Handle("/apps/delete", middlewares.Then(appsHandler.RevokeAppHandler, "revoke-app-handler"))
+	http.Handle("/apps/plan", adminMiddlewares.Then(appsHandler.SetAppPlanHandler, "set-app-plan-handler"))
 	http.Handle("/health", health.HealthHandler(serviceName))
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, "index.html")
 	})
 	http.Handle("/metrics", promhttp.Handler())
 
+	registryToken, err := discovery.RegistrationToken(appConfig)
+	if err != nil {
+		logger.Logger.WithError(err).Fatal("Registry token error")
+	}
+
+	// The debug pages are served on the admin listener, bound to admin.host, not on the public port.
+	adminServer := &http.Server{Addr: net.JoinHostPort(appConfig.GetConfig("admin.host"), "9080"), Handler: tracing.DebugMux()}
 	server := &http.Server{Addr: ":8080"}
-	appserver.StartServer(serviceName, server)
+	appserver.StartServer(serviceName, server,
+		appserver.WithRegistry(discovery.RegistrationURL(appConfig), registryToken, appConfig.GetConfig("discovery.advertise_host")),
+		appserver.WithAdminServer(adminServer))
 }
@@ -0,0 +1,3 @@
+module chaits.org/go-microservices-repo/cmd/registry
+
+go 1.24.5
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+
+	"chaits.org/go-microservices-repo/pkg/network/discovery"
+)
+
+// registry is a small in-memory service registry for local development.
+// Services register on start and send heartbeats; see discovery.Registry.
+// Registrations need the shared token in REGISTRY_TOKEN. The registry listens
+// on loopback unless HOST says otherwise.
+func main() {
+	host := os.Getenv("HOST")
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8500"
+	}
+	token := os.Getenv("REGISTRY_TOKEN")
+	if token == "" {
+		log.Fatal("REGISTRY_TOKEN must be set")
+	}
+
+	registry := discovery.NewRegistry(discovery.WithRegistryToken(token))
+	defer registry.Close()
+	http.Handle("/v1/", registry.Handler())
+	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+
+	listenAddr := net.JoinHostPort(host, port)
+	log.Printf("Starting registry on %s\n", listenAddr)
+	log.Fatal(http.ListenAndServe(listenAddr, nil))
+}
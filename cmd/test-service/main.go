@@ -2,16 +2,23 @@ package main
 
 import (
 	"context"
+	"net"
 	"net/http"
+	"os"
 	"time"
 
 	health "chaits.org/go-microservices-repo/internal/handlers"
 	handlers "chaits.org/go-microservices-repo/internal/handlers/test-service"
 	"chaits.org/go-microservices-repo/internal/repositories"
 	appserver "chaits.org/go-microservices-repo/internal/server"
+	"chaits.org/go-microservices-repo/pkg/general/config"
 	"chaits.org/go-microservices-repo/pkg/general/logger"
+	"chaits.org/go-microservices-repo/pkg/general/ratelimit"
 	"chaits.org/go-microservices-repo/pkg/general/tracing"
+	"chaits.org/go-microservices-repo/pkg/network/discovery"
+	"chaits.org/go-microservices-repo/pkg/network/httpclient"
 	"chaits.org/go-microservices-repo/pkg/network/middleware"
+	sqldb "chaits.org/go-microservices-repo/pkg/storage/sqldb/connectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
@@ -21,7 +28,14 @@ func main() {
 
 	logger.Init(serviceName)
 
-	shutdownTracer := tracing.InitTracer(context.Background(), serviceName)
+	env := os.Getenv("APP_ENV")
+	if env == "" {
+		env = "dev"
+	}
+	appConfig := config.InitConfigs(env)
+	appConfig.LoadConfigs()
+
+	shutdownTracer := tracing.InitTracer(context.Background(), serviceName, tracing.WithAppConfig(appConfig))
 	defer shutdownTracer()
 
 	repos, err := repositories.NewMySQLDBManager()
@@ -29,16 +43,42 @@ func main() {
 		logger.Logger.WithError(err).Fatal("DB Error")
 	}
 
+	if err := httpclient.LoadJWTSigningKey(context.Background(), appConfig, httpclient.EnvSecretStore{}); err != nil {
+		logger.Logger.WithError(err).Fatal("JWT signing key error")
+	}
+
+	services := discovery.NewDiscoveryFromConfig(appConfig)
+	defer services.Close()
+	onboarding := httpclient.NewDiscoveredLoadBalancer(services, "onboarding", httpclient.LoadBalancerConfigFromApp(appConfig, "onboarding"))
+	defer onboarding.Close()
+	chainHandler := handlers.NewChainHandler(onboarding, httpclient.CredentialsFromConfig(appConfig, "onboarding"))
+
+	rateLimits, err := middleware.AppRateLimitConfigFromApp(appConfig)
+	if err != nil {
+		logger.Logger.WithError(err).Fatal("Rate limit configuration error")
+	}
+	rateLimits.Store, err = ratelimit.StoreFromApp(appConfig, repos.DB, sqldb.DB_MYSQL)
+	if err != nil {
+		logger.Logger.WithError(err).Fatal("Rate limit store error")
+	}
+
+	corsConfig, err := middleware.CORSConfigFromApp(appConfig)
+	if err != nil {
+		logger.Logger.WithError(err).Fatal("CORS configuration error")
+	}
+
 	middlewares := middleware.NewManager(
 		middleware.WithLogging,
 		middleware.WithPrometheusMetrics(serviceName),
-		middleware.WithCORS,
-		middleware.WithRateLimiter(100, time.Minute),
-		middleware.WithAPIKeyAuth(repos.AppRepo),
+		middleware.WithCORSConfig(corsConfig),
+		middleware.WithRateLimiter(rateLimits.IPRequestsPerMinute, time.Minute),
+		middleware.WithAnyAuth(middleware.APIKeyAuthenticator(repos.AppRepo), middleware.JWTAuthenticator(serviceName)),
+		middleware.WithAuthorization(middleware.AuthorizationRulesFromApp(appConfig)),
+		middleware.WithAppRateLimiter(repos.AppRepo, rateLimits),
 	)
 
 	http.Handle("/hello", middlewares.Then(handlers.HelloHandler, "hello-handler"))
-	http.Handle("/chain", middlewares.Then(handlers.ChainHandler, "chain-handler"))
+	http.Handle("/chain", middlewares.Then(chainHandler.ChainHandler, "chain-handler"))
 	http.Handle("/health", health.HealthHandler(serviceName))
 
 	// http.Handle("/hello", otelhttp.NewHandler(middlewares.Then1(handlers.HelloHandler), "hello-handler"))
@@ -47,9 +87,18 @@ func main() {
 	// http.Handle("/hello", otelhttp.NewHandler(middleware.ChainAllHandlers(handlers.HelloHandler, serviceName), "hello-handler"))
 	// http.Handle("/chain", otelhttp.NewHandler(middleware.ChainAllHandlers(handlers.ChainHandler, serviceName), "chain-handler"))
 
+	registryToken, err := discovery.RegistrationToken(appConfig)
+	if err != nil {
+		logger.Logger.WithError(err).Fatal("Registry token error")
+	}
+
+	// The debug pages are served on the admin listener, bound to admin.host, not on the public port.
+	adminServer := &http.Server{Addr: net.JoinHostPort(appConfig.GetConfig("admin.host"), "9081"), Handler: tracing.DebugMux()}
 	server := &http.Server{Addr: ":8081"}
 	http.Handle("/metrics", promhttp.Handler())
-	appserver.StartServer(serviceName, server)
+	appserver.StartServer(serviceName, server,
+		appserver.WithRegistry(discovery.RegistrationURL(appConfig), registryToken, appConfig.GetConfig("discovery.advertise_host")),
+		appserver.WithAdminServer(adminServer))
 	// log.Fatal(http.ListenAndServe(":8080", nil))
 }
 
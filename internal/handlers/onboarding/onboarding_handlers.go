@@ -166,3 +166,43 @@ func (a *AppsHandler) RevokeAppHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(fmt.Sprintf("App deleted successfully! id: %d", id)))
 }
+
+// SetAppPlanHandler creates or replaces the rate limit plan of an app. Services
+// pick up the new plan once their cached copy expires, without a restart. Apps
+// must not set their own plans, so mount it behind middleware.AdminMiddlewareManager.
+func (a *AppsHandler) SetAppPlanHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String("handler.name", "setappplan-handler"))
+
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var plan models.AppPlan
+	if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+		http.Error(w, "Error with request body", http.StatusBadRequest)
+		span.SetStatus(codes.Error, "Error with request body")
+		return
+	}
+	if plan.AppName == "" || plan.Burst < 0 || plan.RatePerMinute < 0 || plan.DailyQuota < 0 {
+		http.Error(w, "Bad request: app_name is required and limits must not be negative", http.StatusBadRequest)
+		span.SetStatus(codes.Error, "Error with request body")
+		return
+	}
+
+	dbCtx, dbSpan := otel.Tracer("db-tracer").Start(ctx, "db.upsert")
+	defer dbSpan.End()
+
+	if err := a.appRepo.SetAppPlan(dbCtx, plan); err != nil {
+		logger.Logger.WithError(err).Errorf("Error saving plan of app %s", plan.AppName)
+		dbSpan.SetStatus(codes.Error, "db upsert failed")
+		http.Error(w, "failed to save app plan", http.StatusInternalServerError)
+		return
+	}
+
+	dbSpan.SetStatus(codes.Ok, "db upsert successful")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
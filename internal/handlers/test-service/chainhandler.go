@@ -8,47 +8,98 @@ import (
 	"net/http"
 	"time"
 
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"chaits.org/go-microservices-repo/pkg/general/bulkhead"
+	"chaits.org/go-microservices-repo/pkg/network/httpclient"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 )
 
-func ChainHandler(w http.ResponseWriter, r *http.Request) {
+type ChainHandler struct {
+	helloClient *httpclient.HTTPClient
+}
+
+// NewChainHandler returns a handler that calls /hello on onboarding, showing a
+// traced service-to-service call made with a fully configured HTTPClient.
+// credentials may be nil. opts are applied last, e.g. httpclient.WithRecorder
+// to replay a cassette instead of calling onboarding.
+func NewChainHandler(onboarding *httpclient.LoadBalancer, credentials httpclient.Credentials, opts ...httpclient.Option) *ChainHandler {
+	clientOpts := []httpclient.Option{
+		httpclient.WithDependencyName("onboarding"),
+		httpclient.WithTimeout(5 * time.Second),
+		httpclient.WithLoadBalancer(onboarding),
+		httpclient.WithRequestLogging(),
+		httpclient.WithConnectionTiming(time.Second),
+		httpclient.WithMaxIdleConnsPerHost(20),
+		httpclient.WithBulkhead(bulkhead.Config{
+			MaxConcurrent: 50,
+			MaxQueue:      50,
+			QueueTimeout:  500 * time.Millisecond,
+		}),
+		httpclient.WithHedging(httpclient.HedgePolicy{
+			Delay:        50 * time.Millisecond,
+			Percentile:   0.95,
+			MaxExtraLoad: 0.1,
+		}),
+	}
+	if credentials != nil {
+		clientOpts = append(clientOpts, httpclient.WithCredentials(onboarding.Service(), credentials))
+	}
+	clientOpts = append(clientOpts, opts...)
+	return &ChainHandler{helloClient: httpclient.NewHTTPClient(clientOpts...)}
+}
+
+func (c *ChainHandler) ChainHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	span := trace.SpanFromContext(ctx)
 	span.AddEvent("Started Chain Call")
 
-	// Create a new HTTP client that automatically injects trace context
-	client := http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
 	for i := 0; i < 1; i++ {
-		callHello(ctx, span, client, w)
+		if err := callHello(ctx, span, c.helloClient, w); err != nil {
+			return
+		}
 		// Simulate a slow process
 		slowProcess()
 		io.WriteString(w, "Chained call complete!\n")
 	}
 }
 
-func callHello(ctx context.Context, span trace.Span, client http.Client, w http.ResponseWriter) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:8080/hello", nil)
+// callHello calls /hello on onboarding. On failure it writes the error response
+// and returns the error, so the caller must stop writing to w.
+func callHello(ctx context.Context, span trace.Span, client *httpclient.HTTPClient, w http.ResponseWriter) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://onboarding/hello", nil)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "Failed to create Request")
-		http.Error(w, fmt.Sprintf("Error Creating Request with Context: %w", err), http.StatusInternalServerError)
-		return
+		http.Error(w, fmt.Sprintf("Error Creating Request with Context: %v", err), http.StatusInternalServerError)
+		return err
 	}
 
-	resp, err := client.Do(req)
+	resp, err := client.Do(ctx, req)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "failed call to /hello")
 		http.Error(w, fmt.Sprintf("Error calling /hello: %v", err), http.StatusInternalServerError)
-		return
+		return err
 	}
 	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
+	if err := client.CheckResponse(resp); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "/hello returned an error")
+		http.Error(w, fmt.Sprintf("Error calling /hello: %v", err), http.StatusBadGateway)
+		return err
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, httpclient.DEFAULT_MAX_RESPONSE_BYTES))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to read /hello response")
+		http.Error(w, fmt.Sprintf("Error reading /hello response: %v", err), http.StatusBadGateway)
+		return err
+	}
 	span.AddEvent("Received response from /hello", trace.WithAttributes(attribute.String("response.body", string(body))))
+	return nil
 }
 
 func slowProcess() {
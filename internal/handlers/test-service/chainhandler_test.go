@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"chaits.org/go-microservices-repo/pkg/network/httpclient"
+)
+
+// TestChainHandlerReplay runs the chain handler against recorded responses of
+// onboarding, so no onboarding instance is needed.
+func TestChainHandlerReplay(t *testing.T) {
+	tests := []struct {
+		name       string
+		cassette   string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "hello answered", cassette: "testdata/onboarding_hello.json",
+			wantStatus: http.StatusOK, wantBody: "Chained call complete!\n"},
+		{name: "hello unavailable", cassette: "testdata/onboarding_hello_unavailable.json",
+			wantStatus: http.StatusBadGateway, wantBody: "Error calling /hello"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, err := httpclient.NewRecorder(tt.cassette, httpclient.RECORDER_MODE_REPLAY)
+			if err != nil {
+				t.Fatalf("NewRecorder() error = %v", err)
+			}
+			// The endpoint is never dialed, every request is answered by the recorder.
+			onboarding := httpclient.NewLoadBalancer("onboarding", []httpclient.Endpoint{{Address: "127.0.0.1:1"}}, httpclient.LoadBalancerConfig{})
+			defer onboarding.Close()
+			handler := NewChainHandler(onboarding, nil, httpclient.WithRecorder(recorder))
+
+			rec := httptest.NewRecorder()
+			handler.ChainHandler(rec, httptest.NewRequest(http.MethodGet, "/chain", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", rec.Body.String(), tt.wantBody)
+			}
+			if unused := recorder.Unused(); len(unused) != 0 {
+				t.Errorf("%d recorded calls to onboarding were not made", len(unused))
+			}
+		})
+	}
+}
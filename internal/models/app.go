@@ -7,3 +7,14 @@ type App struct {
 	Name   string `json:"name,omitempty"`
 	APIKey string `json:"api_key,omitempty"`
 }
+
+// AppPlan holds the rate limits of an application. Zero disables a limit.
+type AppPlan struct {
+	AppName string `json:"app_name"`
+	// Burst is the number of requests an app may send at once.
+	Burst int `json:"burst"`
+	// RatePerMinute is the sustained rate the burst refills at.
+	RatePerMinute int `json:"rate_per_minute"`
+	// DailyQuota is the number of requests allowed per UTC day.
+	DailyQuota int `json:"daily_quota"`
+}
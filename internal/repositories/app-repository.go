@@ -6,8 +6,8 @@ import (
 	"fmt"
 
 	"chaits.org/go-microservices-repo/internal/models"
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/codes"
+	"chaits.org/go-microservices-repo/pkg/general/bulkhead"
+	sqldb "chaits.org/go-microservices-repo/pkg/storage/sqldb/connectors"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -17,23 +17,47 @@ type AppRepository interface {
 	GetAllApps(ctx context.Context) ([]models.App, error)
 	DeleteApp(ctx context.Context, id int) (sql.Result, error)
 	ValidateAPIKey(ctx context.Context, appName, apiKey string) (string, bool, error)
+	GetAppPlan(ctx context.Context, appName string) (models.AppPlan, bool, error)
+	SetAppPlan(ctx context.Context, plan models.AppPlan) error
 }
 
 // appRepository implements the AppRepository interface.
+// Queries go through the instrumented sqldb.DB, which records spans and metrics.
 type appRepository struct {
-	db *sql.DB
+	db *sqldb.DB
+	// bulkhead caps concurrent queries. Nil means no limit.
+	bulkhead *bulkhead.Bulkhead
+}
+
+type AppRepositoryOption func(*appRepository)
+
+// WithBulkhead runs the queries of the repository inside b, so a slow database
+// cannot tie up every request goroutine.
+func WithBulkhead(b *bulkhead.Bulkhead) AppRepositoryOption {
+	return func(r *appRepository) {
+		r.bulkhead = b
+	}
 }
 
 // NewAppRepository creates a new AppRepository.
-func NewAppRepository(db *sql.DB) AppRepository {
-	return &appRepository{db: db}
+func NewAppRepository(db *sqldb.DB, opts ...AppRepositoryOption) AppRepository {
+	r := &appRepository{db: db}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// limit runs fn inside the bulkhead, if there is one.
+func (r *appRepository) limit(ctx context.Context, fn func(ctx context.Context) error) error {
+	if r.bulkhead == nil {
+		return fn(ctx)
+	}
+	return r.bulkhead.Execute(ctx, fn)
 }
 
 // CreateApp hashes the API key and inserts a new app into the database.
 func (r *appRepository) CreateApp(ctx context.Context, a *models.App) (models.App, error) {
-	_, tableSpan := otel.Tracer("db-tracer").Start(ctx, "db.insert.app")
-	defer tableSpan.End()
-
 	newApp := models.App{}
 	// Hash the API key before storing it
 	hashedAPIKey, err := bcrypt.GenerateFromPassword([]byte(a.APIKey), bcrypt.DefaultCost)
@@ -42,7 +66,11 @@ func (r *appRepository) CreateApp(ctx context.Context, a *models.App) (models.Ap
 	}
 
 	// Insert into the database
-	res, err := r.db.Exec("INSERT INTO apps (name, api_key_hash) VALUES (?, ?)", a.Name, hashedAPIKey)
+	var res sql.Result
+	err = r.limit(ctx, func(ctx context.Context) error {
+		res, err = r.db.ExecContext(ctx, "INSERT INTO apps (name, api_key_hash) VALUES (?, ?)", a.Name, hashedAPIKey)
+		return err
+	})
 	if err != nil {
 		return newApp, fmt.Errorf("error inserting into db: %v", err)
 	}
@@ -63,21 +91,25 @@ func (r *appRepository) CreateApp(ctx context.Context, a *models.App) (models.Ap
 
 // GetAllApps retrieves all registered apps (without their API keys) from the database.
 func (r *appRepository) GetAllApps(ctx context.Context) ([]models.App, error) {
-	_, tableSpan := otel.Tracer("db-tracer").Start(ctx, "db.query.apps")
-	defer tableSpan.End()
-	rows, err := r.db.Query("SELECT id, name FROM apps")
-	if err != nil {
-		return nil, fmt.Errorf("failed to query apps: %v", err)
-	}
-	defer rows.Close()
-
 	var apps []models.App
-	for rows.Next() {
-		var a models.App
-		if err := rows.Scan(&a.ID, &a.Name); err != nil {
-			return nil, fmt.Errorf("failed to scan app row: %v", err)
+	err := r.limit(ctx, func(ctx context.Context) error {
+		rows, err := r.db.QueryContext(ctx, "SELECT id, name FROM apps")
+		if err != nil {
+			return fmt.Errorf("failed to query apps: %w", err)
 		}
-		apps = append(apps, a)
+		defer rows.Close()
+
+		for rows.Next() {
+			var a models.App
+			if err := rows.Scan(&a.ID, &a.Name); err != nil {
+				return fmt.Errorf("failed to scan app row: %w", err)
+			}
+			apps = append(apps, a)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return apps, nil
@@ -85,26 +117,26 @@ func (r *appRepository) GetAllApps(ctx context.Context) ([]models.App, error) {
 
 // DeleteApp revokes (deletes) an app by its ID.
 func (r *appRepository) DeleteApp(ctx context.Context, id int) (sql.Result, error) {
-	_, tableSpan := otel.Tracer("db-tracer").Start(ctx, "db.delete.app")
-	defer tableSpan.End()
-	return r.db.Exec("DELETE FROM apps WHERE id = ?", id)
+	var res sql.Result
+	err := r.limit(ctx, func(ctx context.Context) error {
+		var err error
+		res, err = r.db.ExecContext(ctx, "DELETE FROM apps WHERE id = ?", id)
+		return err
+	})
+	return res, err
 }
 
 // ValidateAPIKey - Validates API Key against apps table
 func (r *appRepository) ValidateAPIKey(ctx context.Context, appName, apiKey string) (string, bool, error) {
-	_, span := otel.Tracer("db-tracer").Start(ctx, "db.validate_api_key")
-	defer span.End()
-
 	var storedHash string
 	query := "SELECT api_key_hash FROM apps WHERE name = ?"
-	err := r.db.QueryRowContext(ctx, query, appName).Scan(&storedHash)
+	err := r.limit(ctx, func(ctx context.Context) error {
+		return r.db.QueryRowContext(ctx, query, appName).Scan(&storedHash)
+	})
 	if err != nil {
 		if err == sql.ErrNoRows {
-			span.SetStatus(codes.Ok, "API key not found")
 			return "", false, nil
 		}
-		span.SetStatus(codes.Error, fmt.Sprintf("db query failed: %v", err))
-		span.RecordError(err)
 		return "", false, err
 	}
 
@@ -112,10 +144,37 @@ func (r *appRepository) ValidateAPIKey(ctx context.Context, appName, apiKey stri
 	err = bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(apiKey))
 	if err != nil {
 		// bcrypt.CompareHashAndPassword returns an error if they don't match
-		span.SetStatus(codes.Ok, "API key validation failed")
 		return "", false, nil
 	}
 
-	span.SetStatus(codes.Ok, "API key validated successfully")
 	return appName, true, nil
 }
+
+// GetAppPlan returns the rate limit plan of an app. The bool is false when the app has no plan.
+func (r *appRepository) GetAppPlan(ctx context.Context, appName string) (models.AppPlan, bool, error) {
+	plan := models.AppPlan{AppName: appName}
+	query := "SELECT burst, rate_per_minute, daily_quota FROM app_plans WHERE app_name = ?"
+	err := r.limit(ctx, func(ctx context.Context) error {
+		return r.db.QueryRowContext(ctx, query, appName).Scan(&plan.Burst, &plan.RatePerMinute, &plan.DailyQuota)
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return plan, false, nil
+		}
+		return plan, false, fmt.Errorf("failed to query plan of app %s: %w", appName, err)
+	}
+	return plan, true, nil
+}
+
+// SetAppPlan creates or replaces the rate limit plan of an app.
+func (r *appRepository) SetAppPlan(ctx context.Context, plan models.AppPlan) error {
+	return r.limit(ctx, func(ctx context.Context) error {
+		// A single upsert, so concurrent calls for a new app cannot both insert.
+		query := `INSERT INTO app_plans (app_name, burst, rate_per_minute, daily_quota) VALUES (?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE burst = VALUES(burst), rate_per_minute = VALUES(rate_per_minute), daily_quota = VALUES(daily_quota)`
+		if _, err := r.db.ExecContext(ctx, query, plan.AppName, plan.Burst, plan.RatePerMinute, plan.DailyQuota); err != nil {
+			return fmt.Errorf("failed to save plan of app %s: %w", plan.AppName, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,111 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chaits.org/go-microservices-repo/internal/models"
+	"chaits.org/go-microservices-repo/pkg/errors"
+	"chaits.org/go-microservices-repo/pkg/general/bulkhead"
+	sqldb "chaits.org/go-microservices-repo/pkg/storage/sqldb/connectors"
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const planQuery = "SELECT burst, rate_per_minute, daily_quota FROM app_plans WHERE app_name = ?"
+
+// TestAppRepositoryBulkhead checks that queries wait for a slot of the
+// bulkhead and never reach the database when they are rejected.
+func TestAppRepositoryBulkhead(t *testing.T) {
+	tests := []struct {
+		name string
+		// queued is the number of calls already waiting when the query is made.
+		queued   int
+		cancel   bool
+		wantPlan bool
+		wantErr  error
+		wantCode string
+	}{
+		{name: "runs once the slot is free", wantPlan: true},
+		{name: "queue full", queued: 1, wantCode: errors.BULKHEAD_FULL_ERROR},
+		{name: "canceled while queued", cancel: true, wantErr: context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("sqlmock.New() error = %v", err)
+			}
+			defer db.Close()
+			limiter := bulkhead.New("test-db", bulkhead.Config{MaxConcurrent: 1, MaxQueue: 1})
+			repo := NewAppRepository(sqldb.NewDB(db, &sqldb.DBConfig{DBDriver: sqldb.DB_MYSQL}), WithBulkhead(limiter))
+
+			release, err := limiter.Acquire(context.Background())
+			if err != nil {
+				t.Fatalf("Acquire() error = %v", err)
+			}
+			defer release()
+			for i := 0; i < tt.queued; i++ {
+				go limiter.Acquire(context.Background())
+			}
+			waitQueued(t, limiter, tt.queued)
+			if tt.wantPlan {
+				mock.ExpectQuery(planQuery).WithArgs("billing").
+					WillReturnRows(sqlmock.NewRows([]string{"burst", "rate_per_minute", "daily_quota"}).AddRow(5, 60, 1000))
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			type planResult struct {
+				plan models.AppPlan
+				ok   bool
+				err  error
+			}
+			done := make(chan planResult, 1)
+			go func() {
+				plan, ok, err := repo.GetAppPlan(ctx, "billing")
+				done <- planResult{plan, ok, err}
+			}()
+
+			if tt.queued == 0 {
+				waitQueued(t, limiter, 1)
+				if tt.cancel {
+					cancel()
+				} else {
+					release()
+				}
+			}
+			got := <-done
+
+			var appErr *errors.AppError
+			switch {
+			case tt.wantPlan:
+				if got.err != nil || !got.ok || got.plan.RatePerMinute != 60 {
+					t.Errorf("GetAppPlan() = (%+v, %v, %v), want the stored plan", got.plan, got.ok, got.err)
+				}
+			case tt.wantCode != "":
+				if !errors.As(got.err, &appErr) || appErr.Code != tt.wantCode {
+					t.Errorf("GetAppPlan() error = %v, want %s", got.err, tt.wantCode)
+				}
+			case !errors.Is(got.err, tt.wantErr):
+				t.Errorf("GetAppPlan() error = %v, want %v", got.err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// waitQueued waits until n calls are waiting for a slot of b.
+func waitQueued(t *testing.T, b *bulkhead.Bulkhead, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for b.Queued() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d calls queued, want %d", b.Queued(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -4,3 +4,22 @@ CREATE TABLE apps (
     name VARCHAR(255) NOT NULL,
     api_key_hash VARCHAR(255) NOT NULL UNIQUE
 );
+
+-- Rate limit plan of an app. Apps without a row get the configured default plan.
+-- Zero disables the corresponding limit.
+DROP TABLE IF EXISTS app_plans;
+CREATE TABLE app_plans (
+    app_name VARCHAR(255) PRIMARY KEY,
+    burst INTEGER NOT NULL,
+    rate_per_minute INTEGER NOT NULL,
+    daily_quota INTEGER NOT NULL DEFAULT 0
+);
+
+-- State of the rate limits when ratelimit.store is sql. value is the theoretical
+-- arrival time or a counter; both are unix nanoseconds apart from the counter.
+DROP TABLE IF EXISTS rate_limits;
+CREATE TABLE rate_limits (
+    limit_key VARCHAR(255) PRIMARY KEY,
+    value BIGINT NOT NULL,
+    expires_at BIGINT NOT NULL
+);
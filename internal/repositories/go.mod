@@ -2,4 +2,7 @@ module chaits.org/go-microservices-repo/internal/repositories
 
 go 1.24.5
 
-require golang.org/x/crypto v0.41.0 // indirect
+require (
+	github.com/DATA-DOG/go-sqlmock v1.5.2
+	golang.org/x/crypto v0.41.0 // indirect
+)
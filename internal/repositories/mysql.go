@@ -1,13 +1,25 @@
 package repositories
 
 import (
+	"time"
+
+	"chaits.org/go-microservices-repo/pkg/general/bulkhead"
 	"chaits.org/go-microservices-repo/pkg/general/logger"
 	sqldb "chaits.org/go-microservices-repo/pkg/storage/sqldb/connectors"
 )
 
+// dbBulkhead caps the concurrent queries of the repositories.
+var dbBulkhead = bulkhead.Config{
+	MaxConcurrent: 20,
+	MaxQueue:      100,
+	QueueTimeout:  2 * time.Second,
+}
+
 // DBManager holds all table-specific repositories.
 type DBManager struct {
 	AppRepo AppRepository
+	// DB is the shared connection, for stores that keep their own tables.
+	DB *sqldb.DB
 }
 
 // NewMySQLDBManager initializes the database connection and repositories.
@@ -19,10 +31,12 @@ func NewMySQLDBManager() (*DBManager, error) {
 		logger.Logger.WithError(err).Error("error connecting to db")
 	}
 
-	// Initialize table-specific repositories
-	appRepo := NewAppRepository(db)
+	// Initialize table-specific repositories. They share one bulkhead, as they share the connection pool.
+	limiter := bulkhead.New(sqldb.DB_MYSQL, dbBulkhead)
+	appRepo := NewAppRepository(db, WithBulkhead(limiter))
 
 	return &DBManager{
 		AppRepo: appRepo,
+		DB:      db,
 	}, nil
 }
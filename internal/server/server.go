@@ -3,24 +3,93 @@ package appserver
 import (
 	"context"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
+
+	"chaits.org/go-microservices-repo/pkg/network/discovery"
 )
 
-func StartServer(serviceName string, server *http.Server) {
+type serverOptions struct {
+	registryURL   string
+	registryToken string
+	advertiseHost string
+	adminServer   *http.Server
+}
+
+type Option func(*serverOptions)
+
+// WithRegistry registers the service with the registry at registryURL once it
+// is listening, keeps it registered with heartbeats and deregisters it on
+// shutdown. token authenticates to the registry, and advertiseHost is the host
+// other services use to reach this one. An empty registryURL disables
+// registration.
+func WithRegistry(registryURL, token, advertiseHost string) Option {
+	return func(o *serverOptions) {
+		o.registryURL = registryURL
+		o.registryToken = token
+		o.advertiseHost = advertiseHost
+	}
+}
+
+// WithAdminServer runs admin next to the service and shuts it down with it.
+// It serves pages such as /debug/traces that must not be on the public port,
+// so its address should be bound to loopback or an internal network.
+func WithAdminServer(admin *http.Server) Option {
+	return func(o *serverOptions) {
+		o.adminServer = admin
+	}
+}
+
+func StartServer(serviceName string, server *http.Server, opts ...Option) {
+	options := &serverOptions{advertiseHost: "localhost"}
+	for _, opt := range opts {
+		opt(options)
+	}
+
 	go func() {
-		log.Printf("%s service starting on port 8080\n", serviceName)
-		server.ListenAndServe()
+		log.Printf("%s service starting on %s\n", serviceName, server.Addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("%s service stopped: %v", serviceName, err)
+		}
 	}()
-	gracefulShutdown(server, 10*time.Second)
+
+	var beforeShutdown []func()
+	if admin := options.adminServer; admin != nil {
+		go func() {
+			log.Printf("%s admin server starting on %s\n", serviceName, admin.Addr)
+			if err := admin.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("%s admin server stopped: %v", serviceName, err)
+			}
+		}()
+		beforeShutdown = append(beforeShutdown, func() { admin.Close() })
+	}
+	if options.registryURL != "" {
+		// Deregister first so callers stop picking this instance while it drains.
+		beforeShutdown = append(beforeShutdown, register(serviceName, server, options).Deregister)
+	}
+	gracefulShutdown(server, 10*time.Second, beforeShutdown...)
+}
+
+// register announces the server's advertised address to the registry.
+func register(serviceName string, server *http.Server, options *serverOptions) *discovery.Registrar {
+	_, port, err := net.SplitHostPort(server.Addr)
+	if err != nil || port == "" {
+		port = "80"
+	}
+	address := net.JoinHostPort(options.advertiseHost, port)
+	return discovery.Register(options.registryURL, options.registryToken, discovery.Instance{
+		Service: serviceName,
+		Address: address,
+	}, discovery.DEFAULT_INSTANCE_TTL)
 }
 
 // GracefulShutdown is a generic function to perform graceful shutdown on a running server.
 // It listens for OS signals to trigger the shutdown process.
-func gracefulShutdown(server *http.Server, timeout time.Duration) {
+func gracefulShutdown(server *http.Server, timeout time.Duration, beforeShutdown ...func()) {
 	// Create a channel to listen for OS signals.
 	stop := make(chan os.Signal, 1)
 
@@ -32,6 +101,10 @@ func gracefulShutdown(server *http.Server, timeout time.Duration) {
 
 	log.Println("Shutting down the server gracefully...")
 
+	for _, fn := range beforeShutdown {
+		fn()
+	}
+
 	// Create a context with a timeout. This gives active requests a chance to finish.
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
@@ -1,5 +1,21 @@
 package errors
 
 const (
-	ALL_RETRIES_FAILED_ERROR string = "AllRetriesFailedError"
+	ALL_RETRIES_FAILED_ERROR  string = "AllRetriesFailedError"
+	CIRCUIT_OPEN_ERROR        string = "CircuitOpenError"
+	REMOTE_ERROR              string = "RemoteError"
+	INVALID_RESPONSE_ERROR    string = "InvalidResponseError"
+	RESPONSE_TOO_LARGE_ERROR  string = "ResponseTooLargeError"
+	NO_ENDPOINTS_ERROR        string = "NoEndpointsError"
+	SERVICE_NOT_FOUND_ERROR   string = "ServiceNotFoundError"
+	SECRET_NOT_FOUND_ERROR    string = "SecretNotFoundError"
+	CREDENTIALS_ERROR         string = "CredentialsError"
+	UNRECORDED_REQUEST_ERROR  string = "UnrecordedRequestError"
+	BULKHEAD_FULL_ERROR       string = "BulkheadFullError"
+	BULKHEAD_TIMEOUT_ERROR    string = "BulkheadTimeoutError"
+	BODY_NOT_REPLAYABLE_ERROR string = "BodyNotReplayableError"
+	MISSING_CREDENTIALS_ERROR string = "MissingCredentialsError"
+	INVALID_CREDENTIALS_ERROR string = "InvalidCredentialsError"
+	FORBIDDEN_ERROR           string = "ForbiddenError"
+	INTERNAL_ERROR            string = "InternalError"
 )
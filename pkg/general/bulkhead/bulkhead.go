@@ -0,0 +1,169 @@
+// Package bulkhead caps the concurrent calls into a dependency, so a slow
+// dependency cannot tie up every goroutine of the caller.
+package bulkhead
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"chaits.org/go-microservices-repo/pkg/errors"
+	"chaits.org/go-microservices-repo/pkg/general/metrics"
+)
+
+// Rejection reasons reported in bulkhead_rejections_total.
+const (
+	REJECTED_FULL    = "full"
+	REJECTED_TIMEOUT = "timeout"
+)
+
+// Config sizes a bulkhead.
+type Config struct {
+	// MaxConcurrent is the number of calls allowed to run at once.
+	MaxConcurrent int
+	// MaxQueue is the number of calls allowed to wait for a slot. Zero rejects
+	// calls as soon as all slots are taken.
+	MaxQueue int
+	// QueueTimeout bounds the wait for a slot. Zero waits until the context is done.
+	QueueTimeout time.Duration
+}
+
+// Bulkhead limits concurrent calls. Calls beyond MaxConcurrent wait in a
+// bounded queue and are rejected with BULKHEAD_FULL_ERROR when it is full, or
+// with BULKHEAD_TIMEOUT_ERROR when they waited longer than QueueTimeout.
+type Bulkhead struct {
+	name  string
+	cfg   Config
+	slots chan struct{}
+
+	mu     sync.Mutex
+	queued int
+}
+
+// New returns a bulkhead reported under name in the bulkhead_* metrics.
+func New(name string, cfg Config) *Bulkhead {
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = 1
+	}
+	b := &Bulkhead{name: name, cfg: cfg, slots: make(chan struct{}, cfg.MaxConcurrent)}
+	b.report()
+	return b
+}
+
+// Name returns the name of the bulkhead.
+func (b *Bulkhead) Name() string {
+	return b.name
+}
+
+// Acquire takes a slot, waiting in the queue if needed. The returned release
+// function gives the slot back and may be called more than once.
+func (b *Bulkhead) Acquire(ctx context.Context) (release func(), err error) {
+	select {
+	case b.slots <- struct{}{}:
+		return b.releaser(), nil
+	default:
+	}
+
+	b.mu.Lock()
+	if b.queued >= b.cfg.MaxQueue {
+		b.mu.Unlock()
+		metrics.IncrementBulkheadRejections(b.name, REJECTED_FULL)
+		return nil, errors.New(errors.BULKHEAD_FULL_ERROR,
+			fmt.Sprintf("bulkhead %s is full: %d calls running and %d waiting", b.name, b.cfg.MaxConcurrent, b.queued))
+	}
+	b.queued++
+	b.mu.Unlock()
+	b.report()
+	defer func() {
+		b.mu.Lock()
+		b.queued--
+		b.mu.Unlock()
+		b.report()
+	}()
+
+	var timeout <-chan time.Time
+	if b.cfg.QueueTimeout > 0 {
+		timer := time.NewTimer(b.cfg.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case b.slots <- struct{}{}:
+		return b.releaser(), nil
+	case <-timeout:
+		metrics.IncrementBulkheadRejections(b.name, REJECTED_TIMEOUT)
+		return nil, errors.New(errors.BULKHEAD_TIMEOUT_ERROR,
+			fmt.Sprintf("no slot of bulkhead %s became free within %v", b.name, b.cfg.QueueTimeout))
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Execute runs fn inside the bulkhead.
+func (b *Bulkhead) Execute(ctx context.Context, fn func(ctx context.Context) error) error {
+	release, err := b.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return fn(ctx)
+}
+
+// InFlight returns the number of calls holding a slot.
+func (b *Bulkhead) InFlight() int {
+	return len(b.slots)
+}
+
+// Queued returns the number of calls waiting for a slot.
+func (b *Bulkhead) Queued() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.queued
+}
+
+func (b *Bulkhead) releaser() func() {
+	b.report()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-b.slots
+			b.report()
+		})
+	}
+}
+
+func (b *Bulkhead) report() {
+	metrics.UpdateBulkhead(b.name, b.InFlight(), b.Queued())
+}
+
+// IsRejection reports whether err is a rejection by a bulkhead.
+func IsRejection(err error) bool {
+	var appErr *errors.AppError
+	return errors.As(err, &appErr) &&
+		(appErr.Code == errors.BULKHEAD_FULL_ERROR || appErr.Code == errors.BULKHEAD_TIMEOUT_ERROR)
+}
+
+// Group hands out one bulkhead per name, all sized by the same Config.
+type Group struct {
+	cfg Config
+
+	mu        sync.Mutex
+	bulkheads map[string]*Bulkhead
+}
+
+func NewGroup(cfg Config) *Group {
+	return &Group{cfg: cfg, bulkheads: make(map[string]*Bulkhead)}
+}
+
+// Get returns the bulkhead of name, creating it on first use.
+func (g *Group) Get(name string) *Bulkhead {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	b, ok := g.bulkheads[name]
+	if !ok {
+		b = New(name, g.cfg)
+		g.bulkheads[name] = b
+	}
+	return b
+}
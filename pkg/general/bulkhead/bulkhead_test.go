@@ -0,0 +1,166 @@
+package bulkhead
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chaits.org/go-microservices-repo/pkg/errors"
+)
+
+func errorCode(err error) string {
+	var appErr *errors.AppError
+	if errors.As(err, &appErr) {
+		return appErr.Code
+	}
+	return ""
+}
+
+// waitQueued waits until n calls are waiting in the queue of b.
+func waitQueued(t *testing.T, b *Bulkhead, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for b.Queued() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d calls queued, want %d", b.Queued(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBulkheadConcurrencyCap(t *testing.T) {
+	b := New("test-cap", Config{MaxConcurrent: 2})
+
+	var releases []func()
+	for i := 0; i < 2; i++ {
+		release, err := b.Acquire(context.Background())
+		if err != nil {
+			t.Fatalf("Acquire() %d error = %v", i, err)
+		}
+		releases = append(releases, release)
+	}
+	if _, err := b.Acquire(context.Background()); errorCode(err) != errors.BULKHEAD_FULL_ERROR {
+		t.Fatalf("Acquire() over the cap error = %v, want %s", err, errors.BULKHEAD_FULL_ERROR)
+	}
+
+	// Releasing twice gives back one slot only.
+	releases[0]()
+	releases[0]()
+	if got := b.InFlight(); got != 1 {
+		t.Errorf("InFlight() = %d after one release, want 1", got)
+	}
+	if _, err := b.Acquire(context.Background()); err != nil {
+		t.Errorf("Acquire() after a release error = %v", err)
+	}
+}
+
+func TestBulkheadQueue(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		wait     func(ctx context.Context, cancel context.CancelFunc, b *Bulkhead, release func())
+		wantErr  error
+		wantCode string
+	}{
+		{name: "slot handed to the queue", cfg: Config{MaxConcurrent: 1, MaxQueue: 1},
+			wait: func(ctx context.Context, cancel context.CancelFunc, b *Bulkhead, release func()) { release() }},
+		{name: "queue timeout", cfg: Config{MaxConcurrent: 1, MaxQueue: 1, QueueTimeout: 10 * time.Millisecond},
+			wait:     func(ctx context.Context, cancel context.CancelFunc, b *Bulkhead, release func()) {},
+			wantCode: errors.BULKHEAD_TIMEOUT_ERROR},
+		{name: "canceled while queued", cfg: Config{MaxConcurrent: 1, MaxQueue: 1},
+			wait:    func(ctx context.Context, cancel context.CancelFunc, b *Bulkhead, release func()) { cancel() },
+			wantErr: context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New("test-queue", tt.cfg)
+			release, err := b.Acquire(context.Background())
+			if err != nil {
+				t.Fatalf("Acquire() error = %v", err)
+			}
+			defer release()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan error, 1)
+			go func() {
+				queuedRelease, err := b.Acquire(ctx)
+				if err == nil {
+					queuedRelease()
+				}
+				done <- err
+			}()
+			waitQueued(t, b, 1)
+
+			// The queue is full now.
+			if _, err := b.Acquire(context.Background()); errorCode(err) != errors.BULKHEAD_FULL_ERROR {
+				t.Errorf("Acquire() with a full queue error = %v, want %s", err, errors.BULKHEAD_FULL_ERROR)
+			}
+
+			tt.wait(ctx, cancel, b, release)
+			err = <-done
+			switch {
+			case tt.wantCode != "":
+				if errorCode(err) != tt.wantCode {
+					t.Errorf("queued Acquire() error = %v, want %s", err, tt.wantCode)
+				}
+			case !errors.Is(err, tt.wantErr):
+				t.Errorf("queued Acquire() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := b.Queued(); got != 0 {
+				t.Errorf("Queued() = %d after the wait ended, want 0", got)
+			}
+		})
+	}
+}
+
+func TestBulkheadExecute(t *testing.T) {
+	b := New("test-execute", Config{MaxConcurrent: 1})
+	fnErr := errors.New(errors.INTERNAL_ERROR, "query failed")
+
+	err := b.Execute(context.Background(), func(ctx context.Context) error {
+		if got := b.InFlight(); got != 1 {
+			t.Errorf("InFlight() = %d inside Execute, want 1", got)
+		}
+		return fnErr
+	})
+	if err != fnErr {
+		t.Errorf("Execute() error = %v, want %v", err, fnErr)
+	}
+	if got := b.InFlight(); got != 0 {
+		t.Errorf("InFlight() = %d after Execute, want 0", got)
+	}
+}
+
+func TestIsRejection(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: errors.New(errors.BULKHEAD_FULL_ERROR, "full"), want: true},
+		{err: errors.New(errors.BULKHEAD_TIMEOUT_ERROR, "timeout"), want: true},
+		{err: errors.New(errors.INTERNAL_ERROR, "other"), want: false},
+		{err: context.Canceled, want: false},
+		{err: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := IsRejection(tt.err); got != tt.want {
+			t.Errorf("IsRejection(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestGroup(t *testing.T) {
+	g := NewGroup(Config{MaxConcurrent: 1})
+	if g.Get("a") != g.Get("a") {
+		t.Error("Get() returned two bulkheads for one name")
+	}
+	if _, err := g.Get("a").Acquire(context.Background()); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if _, err := g.Get("b").Acquire(context.Background()); err != nil {
+		t.Errorf("a full bulkhead blocked another name: %v", err)
+	}
+}
@@ -0,0 +1,3 @@
+module chaits.org/go-microservices-repo/pkg/general/bulkhead
+
+go 1.24.5
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -53,3 +54,39 @@ func (a *AppConfig) GetConfig(key string) string {
 func (a *AppConfig) SetConfig(key, value string) {
 	a.viperConfig.Set(key, value)
 }
+
+func (a *AppConfig) Env() string {
+	return a.env
+}
+
+func (a *AppConfig) IsSet(key string) bool {
+	return a.viperConfig.IsSet(key)
+}
+
+func (a *AppConfig) GetBool(key string) bool {
+	return a.viperConfig.GetBool(key)
+}
+
+func (a *AppConfig) GetFloat64(key string) float64 {
+	return a.viperConfig.GetFloat64(key)
+}
+
+func (a *AppConfig) GetStringMapString(key string) map[string]string {
+	return a.viperConfig.GetStringMapString(key)
+}
+
+func (a *AppConfig) GetInt(key string) int {
+	return a.viperConfig.GetInt(key)
+}
+
+func (a *AppConfig) GetDuration(key string) time.Duration {
+	return a.viperConfig.GetDuration(key)
+}
+
+func (a *AppConfig) GetStringSlice(key string) []string {
+	return a.viperConfig.GetStringSlice(key)
+}
+
+func (a *AppConfig) GetStringMap(key string) map[string]interface{} {
+	return a.viperConfig.GetStringMap(key)
+}
@@ -0,0 +1,92 @@
+package logger
+
+import (
+	"encoding/json"
+	"mime"
+	"net/url"
+	"strings"
+)
+
+// REDACTED replaces sensitive values in logged requests and responses.
+const REDACTED = "[REDACTED]"
+
+// sensitiveKeys are matched case-insensitively against query parameters and
+// JSON field names, ignoring "-" and "_", e.g. "api_key", "X-API-Key" and "apiKey".
+var sensitiveKeys = []string{"apikey", "password", "secret", "token", "authorization", "cookie"}
+
+// IsSensitive reports whether a header, query parameter or field name holds a credential.
+func IsSensitive(key string) bool {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(key))
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(normalized, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactQuery masks the values of sensitive query parameters.
+func RedactQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return REDACTED
+	}
+	redacted := false
+	for key := range values {
+		if IsSensitive(key) {
+			values[key] = []string{REDACTED}
+			redacted = true
+		}
+	}
+	if !redacted {
+		return rawQuery
+	}
+	return values.Encode()
+}
+
+// RedactBody masks sensitive fields of a body with the given Content-Type:
+// parameters of application/x-www-form-urlencoded bodies, like RedactQuery,
+// and fields of JSON bodies. Other bodies are returned unchanged.
+func RedactBody(body []byte, contentType string) string {
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "application/x-www-form-urlencoded" {
+		return RedactQuery(string(body))
+	}
+	var value any
+	if len(body) == 0 || json.Unmarshal(body, &value) != nil {
+		return string(body)
+	}
+	if !redactValue(value) {
+		return string(body)
+	}
+	redacted, err := json.Marshal(value)
+	if err != nil {
+		return REDACTED
+	}
+	return string(redacted)
+}
+
+// redactValue masks sensitive fields in place and reports whether it changed anything.
+func redactValue(value any) bool {
+	changed := false
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			if IsSensitive(key) {
+				v[key] = REDACTED
+				changed = true
+			} else if redactValue(field) {
+				changed = true
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if redactValue(item) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
@@ -0,0 +1,79 @@
+package logger
+
+import "testing"
+
+func TestIsSensitive(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{key: "api_key", want: true},
+		{key: "X-API-Key", want: true},
+		{key: "apiKey", want: true},
+		{key: "Authorization", want: true},
+		{key: "refresh_token", want: true},
+		{key: "client_secret", want: true},
+		{key: "Set-Cookie", want: true},
+		{key: "password", want: true},
+		{key: "app_name", want: false},
+		{key: "Content-Type", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := IsSensitive(tt.key); got != tt.want {
+			t.Errorf("IsSensitive(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "empty", query: "", want: ""},
+		{name: "nothing sensitive", query: "page=2&sort=name", want: "page=2&sort=name"},
+		{name: "sensitive parameter", query: "app=billing&api_key=abc123", want: "api_key=%5BREDACTED%5D&app=billing"},
+		{name: "repeated parameter", query: "token=a&token=b", want: "token=%5BREDACTED%5D"},
+		{name: "unparsable", query: "token=%zz", want: REDACTED},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactQuery(tt.query); got != tt.want {
+				t.Errorf("RedactQuery(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		want        string
+	}{
+		{name: "empty", body: "", contentType: "application/json", want: ""},
+		{name: "JSON without secrets", body: `{"app":"billing"}`, contentType: "application/json", want: `{"app":"billing"}`},
+		{name: "JSON field", body: `{"app":"billing","password":"hunter2"}`, contentType: "application/json", want: `{"app":"billing","password":"[REDACTED]"}`},
+		{name: "nested JSON", body: `{"items":[{"apiKey":"abc"}],"auth":{"token":{"value":"x"}}}`, contentType: "application/json",
+			want: `{"auth":{"token":"[REDACTED]"},"items":[{"apiKey":"[REDACTED]"}]}`},
+		{name: "JSON without Content-Type", body: `{"secret":"s"}`, want: `{"secret":"[REDACTED]"}`},
+		{name: "form", body: "username=ann&password=hunter2", contentType: "application/x-www-form-urlencoded",
+			want: "password=%5BREDACTED%5D&username=ann"},
+		{name: "form with charset", body: "client_secret=s", contentType: "application/x-www-form-urlencoded; charset=utf-8",
+			want: "client_secret=%5BREDACTED%5D"},
+		{name: "form without secrets", body: "username=ann", contentType: "application/x-www-form-urlencoded", want: "username=ann"},
+		{name: "plain text", body: "password=hunter2", contentType: "text/plain", want: "password=hunter2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactBody([]byte(tt.body), tt.contentType); got != tt.want {
+				t.Errorf("RedactBody(%q, %q) = %q, want %q", tt.body, tt.contentType, got, tt.want)
+			}
+		})
+	}
+}
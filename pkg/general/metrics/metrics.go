@@ -31,6 +31,94 @@ func RecordDependencyRequest(dependencyName, status string, duration time.Durati
 	DependencyDurationSeconds.WithLabelValues(dependencyName, status).Observe(duration.Seconds())
 }
 
+// RecordCircuitBreakerTransition updates the state gauge and counts the transition.
+// States are reported as 0 = closed, 1 = half-open and 2 = open.
+func RecordCircuitBreakerTransition(host, from, to string, state int) {
+	CircuitBreakerState.WithLabelValues(host).Set(float64(state))
+	CircuitBreakerTransitionsTotal.WithLabelValues(host, from, to).Inc()
+}
+
+// IncrementCircuitBreakerRejections counts a call failed fast by an open circuit breaker.
+func IncrementCircuitBreakerRejections(host string) {
+	CircuitBreakerRejectionsTotal.WithLabelValues(host).Inc()
+}
+
+// RecordHedgedRequest counts a hedge that was sent, or skipped with outcome "budget_exhausted".
+func RecordHedgedRequest(dependencyName, outcome string) {
+	HedgedRequestsTotal.WithLabelValues(dependencyName, outcome).Inc()
+}
+
+// IncrementHedgeWins counts a call answered by a hedged request.
+func IncrementHedgeWins(dependencyName string) {
+	HedgeWinsTotal.WithLabelValues(dependencyName).Inc()
+}
+
+// UpdateLoadBalancerEndpointHealth reports the active health check state of an endpoint.
+func UpdateLoadBalancerEndpointHealth(service, endpoint string, healthy bool) {
+	value := 0.0
+	if healthy {
+		value = 1
+	}
+	LoadBalancerEndpointHealthy.WithLabelValues(service, endpoint).Set(value)
+}
+
+// RemoveLoadBalancerEndpoint drops the series of an endpoint that left the service.
+func RemoveLoadBalancerEndpoint(service, endpoint string) {
+	LoadBalancerEndpointHealthy.DeleteLabelValues(service, endpoint)
+	LoadBalancerEjectionsTotal.DeleteLabelValues(service, endpoint)
+}
+
+// IncrementLoadBalancerEjections counts an endpoint ejected by passive health checks.
+func IncrementLoadBalancerEjections(service, endpoint string) {
+	LoadBalancerEjectionsTotal.WithLabelValues(service, endpoint).Inc()
+}
+
+// RecordHTTPClientCacheRequest counts a cacheable request with its cache result.
+func RecordHTTPClientCacheRequest(dependencyName, result string) {
+	HTTPClientCacheRequestsTotal.WithLabelValues(dependencyName, result).Inc()
+}
+
+// IncrementHTTPClientCacheEvictions counts a response evicted from an in-memory cache.
+func IncrementHTTPClientCacheEvictions() {
+	HTTPClientCacheEvictionsTotal.Inc()
+}
+
+// AddHTTPClientCacheBytes adjusts the size of the cached response bodies by delta.
+func AddHTTPClientCacheBytes(delta int64) {
+	HTTPClientCacheBytes.Add(float64(delta))
+}
+
+// UpdateBulkhead reports the calls running in and waiting for a bulkhead.
+func UpdateBulkhead(name string, inFlight, queued int) {
+	BulkheadInFlight.WithLabelValues(name).Set(float64(inFlight))
+	BulkheadQueued.WithLabelValues(name).Set(float64(queued))
+}
+
+// IncrementBulkheadRejections counts a call rejected by a bulkhead with reason "full" or "timeout".
+func IncrementBulkheadRejections(name, reason string) {
+	BulkheadRejectionsTotal.WithLabelValues(name, reason).Inc()
+}
+
+// IncrementRateLimitRejections counts a request rejected by the per-app rate limiter.
+func IncrementRateLimitRejections(app, reason string) {
+	RateLimitRejectionsTotal.WithLabelValues(app, reason).Inc()
+}
+
+// IncrementRateLimitStoreErrors counts a rate limit decision that failed because the store could not be used.
+func IncrementRateLimitStoreErrors(store string) {
+	RateLimitStoreErrorsTotal.WithLabelValues(store).Inc()
+}
+
+// RecordDependencyPhase records the duration of one phase of an outgoing request.
+func RecordDependencyPhase(dependencyName, phase string, duration time.Duration) {
+	DependencyPhaseDurationSeconds.WithLabelValues(dependencyName, phase).Observe(duration.Seconds())
+}
+
+// IncrementDependencyConnections counts a connection used by an outgoing request.
+func IncrementDependencyConnections(dependencyName string, reused bool) {
+	DependencyConnectionsTotal.WithLabelValues(dependencyName, strconv.FormatBool(reused)).Inc()
+}
+
 // UpdateDatabaseConnections sets the value of the database connections gauge.
 // Call this function periodically to report the number of open connections.
 func UpdateDatabaseConnections(count int) {
@@ -56,3 +144,24 @@ func IncrementUserRegistrations() {
 func IncrementCheckoutEvents() {
 	CheckoutEventsTotal.Inc()
 }
+
+// --- Tracing Metrics Utilities ---
+
+// RecordTraceSamplingDecision counts a tail sampling decision and the rule that produced it.
+func RecordTraceSamplingDecision(kept bool, reason string) {
+	decision := "dropped"
+	if kept {
+		decision = "kept"
+	}
+	TraceSamplingDecisionsTotal.WithLabelValues(decision, reason).Inc()
+}
+
+// RecordTraceSamplingDroppedSpans counts spans the tail sampler dropped before deciding.
+func RecordTraceSamplingDroppedSpans(reason string, count int) {
+	TraceSamplingDroppedSpansTotal.WithLabelValues(reason).Add(float64(count))
+}
+
+// UpdateTraceSamplingBufferedTraces sets the number of traces waiting for a decision.
+func UpdateTraceSamplingBufferedTraces(count int) {
+	TraceSamplingBufferedTraces.Set(float64(count))
+}
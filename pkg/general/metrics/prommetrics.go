@@ -95,6 +95,162 @@ var (
 		[]string{"dependency_name", "status"},
 	)
 
+	// CircuitBreakerState is a GaugeVec for the state of each outbound circuit breaker.
+	// 0 = closed, 1 = half-open, 2 = open.
+	CircuitBreakerState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "circuit_breaker_state",
+			Help: "State of the circuit breaker per target host (0 closed, 1 half-open, 2 open).",
+		},
+		[]string{"host"},
+	)
+
+	// CircuitBreakerTransitionsTotal is a CounterVec for circuit breaker state changes.
+	CircuitBreakerTransitionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "circuit_breaker_transitions_total",
+			Help: "Total number of circuit breaker state changes per target host.",
+		},
+		[]string{"host", "from", "to"},
+	)
+
+	// CircuitBreakerRejectionsTotal is a CounterVec for calls rejected by an open circuit breaker.
+	CircuitBreakerRejectionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "circuit_breaker_rejections_total",
+			Help: "Total number of calls failed fast by an open circuit breaker.",
+		},
+		[]string{"host"},
+	)
+
+	// HedgedRequestsTotal is a CounterVec for hedged requests sent, and skipped
+	// because the extra load budget was spent.
+	HedgedRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "hedged_requests_total",
+			Help: "Total number of hedged requests per dependency, by outcome (sent or budget_exhausted).",
+		},
+		[]string{"dependency_name", "outcome"},
+	)
+
+	// HedgeWinsTotal is a CounterVec for calls answered by a hedged request rather than the original.
+	HedgeWinsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "hedge_wins_total",
+			Help: "Total number of calls whose response came from a hedged request.",
+		},
+		[]string{"dependency_name"},
+	)
+
+	// LoadBalancerEndpointHealthy is a GaugeVec that is 1 while an endpoint passes its health checks.
+	LoadBalancerEndpointHealthy = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "load_balancer_endpoint_healthy",
+			Help: "Whether a load balanced endpoint passes its active health checks (1) or not (0).",
+		},
+		[]string{"service", "endpoint"},
+	)
+
+	// LoadBalancerEjectionsTotal is a CounterVec for endpoints ejected by passive health checks.
+	LoadBalancerEjectionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "load_balancer_ejections_total",
+			Help: "Total number of times an endpoint was ejected after consecutive failed requests.",
+		},
+		[]string{"service", "endpoint"},
+	)
+
+	// HTTPClientCacheRequestsTotal is a CounterVec for cacheable client requests by cache result.
+	HTTPClientCacheRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_client_cache_requests_total",
+			Help: "Total number of cacheable outgoing requests per dependency, by result (hit, miss, revalidated or coalesced).",
+		},
+		[]string{"dependency_name", "result"},
+	)
+
+	// HTTPClientCacheEvictionsTotal is a Counter for responses evicted from the in-memory cache.
+	HTTPClientCacheEvictionsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "http_client_cache_evictions_total",
+			Help: "Total number of cached responses evicted to stay within the cache bounds.",
+		},
+	)
+
+	// HTTPClientCacheBytes is a Gauge for the size of the cached response bodies.
+	HTTPClientCacheBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "http_client_cache_bytes",
+			Help: "Total size in bytes of the response bodies held in in-memory caches.",
+		},
+	)
+
+	// BulkheadInFlight is a GaugeVec for the calls holding a slot of a bulkhead.
+	BulkheadInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bulkhead_in_flight",
+			Help: "Number of calls currently running inside a bulkhead.",
+		},
+		[]string{"bulkhead"},
+	)
+
+	// BulkheadQueued is a GaugeVec for the calls waiting for a slot of a bulkhead.
+	BulkheadQueued = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bulkhead_queued",
+			Help: "Number of calls currently waiting for a bulkhead slot.",
+		},
+		[]string{"bulkhead"},
+	)
+
+	// BulkheadRejectionsTotal is a CounterVec for calls turned away by a bulkhead.
+	BulkheadRejectionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bulkhead_rejections_total",
+			Help: "Total number of calls rejected by a bulkhead, by reason (full or timeout).",
+		},
+		[]string{"bulkhead", "reason"},
+	)
+
+	// RateLimitRejectionsTotal is a CounterVec for requests rejected by the per-app rate limiter.
+	RateLimitRejectionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rate_limit_rejections_total",
+			Help: "Total number of requests rejected by the per-app rate limiter, by reason (rate or quota).",
+		},
+		[]string{"app", "reason"},
+	)
+
+	// RateLimitStoreErrorsTotal is a CounterVec for failed calls to a rate limit store.
+	RateLimitStoreErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rate_limit_store_errors_total",
+			Help: "Total number of rate limit decisions that failed because the store could not be used.",
+		},
+		[]string{"store"},
+	)
+
+	// DependencyPhaseDurationSeconds is a HistogramVec for the phases of an outgoing
+	// request: dns, connect, tls, wait_conn and server.
+	DependencyPhaseDurationSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "dependency_phase_duration_seconds",
+			Help:    "Duration of the phases of requests to external dependencies, in seconds.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		},
+		[]string{"dependency_name", "phase"},
+	)
+
+	// DependencyConnectionsTotal is a CounterVec for the connections used by
+	// outgoing requests, by whether they were reused from the pool.
+	DependencyConnectionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dependency_connections_total",
+			Help: "Total number of connections used for requests to external dependencies, by reused (true or false).",
+		},
+		[]string{"dependency_name", "reused"},
+	)
+
 	// DatabaseConnectionsOpen is a Gauge for the number of open database connections.
 	// This helps manage connection pools.
 	DatabaseConnectionsOpen = prometheus.NewGauge(
@@ -135,6 +291,37 @@ var (
 	)
 )
 
+// --- 5. Tracing Metrics ---
+var (
+	// TraceSamplingDecisionsTotal is a CounterVec for tail sampling decisions.
+	// The reason label records which rule kept the trace, or "none" when it was dropped.
+	TraceSamplingDecisionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "trace_sampling_decisions_total",
+			Help: "Total number of tail sampling decisions.",
+		},
+		[]string{"decision", "reason"},
+	)
+
+	// TraceSamplingDroppedSpansTotal is a CounterVec for spans dropped before a decision was made.
+	// This happens when the tail sampling buffer is full or a trace grows too large.
+	TraceSamplingDroppedSpansTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "trace_sampling_dropped_spans_total",
+			Help: "Total number of spans dropped by the tail sampler before a decision.",
+		},
+		[]string{"reason"},
+	)
+
+	// TraceSamplingBufferedTraces is a Gauge for the traces waiting for a tail sampling decision.
+	TraceSamplingBufferedTraces = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "trace_sampling_buffered_traces",
+			Help: "Number of traces buffered by the tail sampler.",
+		},
+	)
+)
+
 // init registers all defined metrics with the default Prometheus registry.
 // This function is automatically called when the package is imported.
 func init() {
@@ -147,9 +334,29 @@ func init() {
 		CPUUsageSecondsTotal,
 		DependencyRequestsTotal,
 		DependencyDurationSeconds,
+		DependencyPhaseDurationSeconds,
+		DependencyConnectionsTotal,
 		DatabaseConnectionsOpen,
+		CircuitBreakerState,
+		CircuitBreakerTransitionsTotal,
+		CircuitBreakerRejectionsTotal,
+		HedgedRequestsTotal,
+		HedgeWinsTotal,
+		LoadBalancerEndpointHealthy,
+		LoadBalancerEjectionsTotal,
+		HTTPClientCacheRequestsTotal,
+		HTTPClientCacheEvictionsTotal,
+		HTTPClientCacheBytes,
+		BulkheadInFlight,
+		BulkheadQueued,
+		BulkheadRejectionsTotal,
+		RateLimitRejectionsTotal,
+		RateLimitStoreErrorsTotal,
 		UserRegistrationsTotal,
 		CheckoutEventsTotal,
 		JobQueueSize,
+		TraceSamplingDecisionsTotal,
+		TraceSamplingDroppedSpansTotal,
+		TraceSamplingBufferedTraces,
 	)
 }
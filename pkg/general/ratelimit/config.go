@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"fmt"
+
+	"chaits.org/go-microservices-repo/pkg/general/config"
+	sqldb "chaits.org/go-microservices-repo/pkg/storage/sqldb/connectors"
+)
+
+// StoreFromApp returns the store selected by ratelimit.store, defaulting to
+// memory. The sql store uses db, opened with driver; the redis store reads
+// ratelimit.redis.address, password, db and timeout.
+func StoreFromApp(appConfig *config.AppConfig, db *sqldb.DB, driver string) (Store, error) {
+	name := STORE_MEMORY
+	if appConfig.IsSet("ratelimit.store") {
+		name = appConfig.GetConfig("ratelimit.store")
+	}
+
+	switch name {
+	case STORE_MEMORY:
+		return NewMemoryStore(), nil
+	case STORE_SQL:
+		if db == nil {
+			return nil, fmt.Errorf("rate limit store %s needs a database connection", name)
+		}
+		return NewSQLStore(db, driver)
+	case STORE_REDIS:
+		return NewRedisStore(RedisConfig{
+			Address:  appConfig.GetConfig("ratelimit.redis.address"),
+			Password: appConfig.GetConfig("ratelimit.redis.password"),
+			DB:       appConfig.GetInt("ratelimit.redis.db"),
+			Timeout:  appConfig.GetDuration("ratelimit.redis.timeout"),
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store: %s", name)
+	}
+}
+
+// FailModeFromApp returns ratelimit.fail_mode, defaulting to FAIL_OPEN. Values
+// other than open and closed are an error, so that a typo cannot turn a
+// closed limit into an open one.
+func FailModeFromApp(appConfig *config.AppConfig) (FailMode, error) {
+	if !appConfig.IsSet("ratelimit.fail_mode") {
+		return FAIL_OPEN, nil
+	}
+	switch mode := FailMode(appConfig.GetConfig("ratelimit.fail_mode")); mode {
+	case FAIL_OPEN, FAIL_CLOSED:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown rate limit fail mode: %s", mode)
+	}
+}
@@ -0,0 +1,34 @@
+package ratelimit
+
+import (
+	"testing"
+
+	"chaits.org/go-microservices-repo/pkg/general/config"
+)
+
+func TestFailModeFromApp(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    FailMode
+		wantErr bool
+	}{
+		{name: "unset", want: FAIL_OPEN},
+		{name: "open", value: "open", want: FAIL_OPEN},
+		{name: "closed", value: "closed", want: FAIL_CLOSED},
+		{name: "unknown", value: "close", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appConfig := config.InitConfigs("test")
+			if tt.value != "" {
+				appConfig.SetConfig("ratelimit.fail_mode", tt.value)
+			}
+			got, err := FailModeFromApp(appConfig)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("FailModeFromApp() = (%q, %v), want %q, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+// Package ratelimit implements rate limits whose state lives in a Store, so
+// replicas of a service that share a store share their limits.
+//
+// Limits use the generic cell rate algorithm (GCRA): a key stores only its
+// theoretical arrival time (TAT), the time at which its bucket would be empty
+// again. This behaves like a token bucket that refills continuously, and needs
+// a single atomic read-modify-write per request. Stores use the clock of the
+// calling instance, so replicas should keep their clocks in sync.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Store names, as accepted in the ratelimit.store configuration key.
+const (
+	STORE_MEMORY = "memory"
+	STORE_SQL    = "sql"
+	STORE_REDIS  = "redis"
+)
+
+// FailMode decides what happens to a request when the store cannot be reached.
+type FailMode string
+
+const (
+	// FAIL_OPEN lets requests through unlimited while the store is down.
+	FAIL_OPEN FailMode = "open"
+	// FAIL_CLOSED rejects requests while the store is down.
+	FAIL_CLOSED FailMode = "closed"
+)
+
+// Limit allows Rate requests per Period on average, and up to Burst requests at
+// once. Rate must be positive; a Burst below one counts as one.
+type Limit struct {
+	Rate   int
+	Period time.Duration
+	Burst  int
+}
+
+func (l Limit) burst() int {
+	return max(l.Burst, 1)
+}
+
+// interval is the time one request takes to refill.
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Rate)
+}
+
+// Result is the outcome of Store.Allow.
+type Result struct {
+	Allowed bool
+	// Limit is the burst size of the limit.
+	Limit int
+	// Remaining is the number of requests that would be allowed right now.
+	Remaining int
+	// ResetAfter is the time until the full burst is available again.
+	ResetAfter time.Duration
+	// RetryAfter is the time until the next request would be allowed. Zero when Allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps the state of limits.
+type Store interface {
+	// Name identifies the store in logs and in rate_limit_store_errors_total.
+	Name() string
+	// Allow applies limit to key and records the request if it is allowed.
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+	// Increment adds one to the counter of key and returns the new count. The
+	// counter starts again from zero after expiresAt.
+	Increment(ctx context.Context, key string, expiresAt time.Time) (int64, error)
+}
+
+// gcra decides on one request for a key whose theoretical arrival time is tat.
+// It returns the TAT to store, which is unchanged when the request is rejected.
+func gcra(limit Limit, now, tat time.Time) (time.Time, bool) {
+	if tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(limit.interval())
+	if now.Before(next.Add(-limit.interval() * time.Duration(limit.burst()))) {
+		return tat, false
+	}
+	return next, true
+}
+
+// result describes the state of a key after gcra returned tat and allowed.
+func result(limit Limit, now, tat time.Time, allowed bool) Result {
+	interval := limit.interval()
+	burstOffset := interval * time.Duration(limit.burst())
+	if tat.Before(now) {
+		tat = now
+	}
+	r := Result{Allowed: allowed, Limit: limit.burst(), ResetAfter: tat.Sub(now)}
+	if allowed {
+		r.Remaining = int((burstOffset - r.ResetAfter) / interval)
+	} else {
+		r.RetryAfter = tat.Add(interval - burstOffset).Sub(now)
+	}
+	return r
+}
+
+// MemoryStore keeps limits in the memory of the process. It is the default,
+// and the right store for a single instance.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	nextPrune time.Time
+}
+
+type memoryEntry struct {
+	tat     time.Time
+	count   int64
+	expires time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry)}
+}
+
+func (s *MemoryStore) Name() string {
+	return STORE_MEMORY
+}
+
+func (s *MemoryStore) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(now)
+
+	tat, allowed := gcra(limit, now, s.entries[key].tat)
+	if allowed {
+		s.entries[key] = memoryEntry{tat: tat, expires: tat}
+	}
+	return result(limit, now, tat, allowed), nil
+}
+
+func (s *MemoryStore) Increment(ctx context.Context, key string, expiresAt time.Time) (int64, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(now)
+
+	e := s.entries[key]
+	if !now.Before(e.expires) {
+		e.count = 0
+	}
+	e.count++
+	e.expires = expiresAt
+	s.entries[key] = e
+	return e.count, nil
+}
+
+// prune drops expired entries. It runs at most once a minute.
+func (s *MemoryStore) prune(now time.Time) {
+	if now.Before(s.nextPrune) {
+		return
+	}
+	s.nextPrune = now.Add(time.Minute)
+	for key, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGCRA(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limit := Limit{Rate: 60, Period: time.Minute, Burst: 3}
+
+	tests := []struct {
+		name    string
+		limit   Limit
+		tat     time.Time
+		allowed bool
+		wantTAT time.Time
+	}{
+		{name: "new key", limit: limit, allowed: true, wantTAT: now.Add(time.Second)},
+		{name: "tat in the past", limit: limit, tat: now.Add(-time.Hour), allowed: true, wantTAT: now.Add(time.Second)},
+		{name: "last request of the burst", limit: limit, tat: now.Add(2 * time.Second), allowed: true, wantTAT: now.Add(3 * time.Second)},
+		{name: "burst exhausted", limit: limit, tat: now.Add(3 * time.Second), allowed: false, wantTAT: now.Add(3 * time.Second)},
+		{name: "burst below one", limit: Limit{Rate: 60, Period: time.Minute}, tat: now.Add(time.Second), allowed: false, wantTAT: now.Add(time.Second)},
+		{name: "sub-second interval", limit: Limit{Rate: 10, Period: time.Second, Burst: 1}, tat: now, allowed: true, wantTAT: now.Add(100 * time.Millisecond)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tat, allowed := gcra(tt.limit, now, tt.tat)
+			if allowed != tt.allowed || !tat.Equal(tt.wantTAT) {
+				t.Errorf("gcra() = (%v, %v), want (%v, %v)", tat.Sub(now), allowed, tt.wantTAT.Sub(now), tt.allowed)
+			}
+		})
+	}
+}
+
+func TestResult(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limit := Limit{Rate: 60, Period: time.Minute, Burst: 3}
+
+	tests := []struct {
+		name    string
+		tat     time.Time
+		allowed bool
+		want    Result
+	}{
+		{name: "first request", tat: now.Add(time.Second), allowed: true,
+			want: Result{Allowed: true, Limit: 3, Remaining: 2, ResetAfter: time.Second}},
+		{name: "last request", tat: now.Add(3 * time.Second), allowed: true,
+			want: Result{Allowed: true, Limit: 3, Remaining: 0, ResetAfter: 3 * time.Second}},
+		{name: "rejected", tat: now.Add(3 * time.Second), allowed: false,
+			want: Result{Limit: 3, ResetAfter: 3 * time.Second, RetryAfter: time.Second}},
+		{name: "rejected mid-refill", tat: now.Add(3500 * time.Millisecond), allowed: false,
+			want: Result{Limit: 3, ResetAfter: 3500 * time.Millisecond, RetryAfter: 1500 * time.Millisecond}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := result(limit, now, tt.tat, tt.allowed); got != tt.want {
+				t.Errorf("result() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGCRARefills(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limit := Limit{Rate: 60, Period: time.Minute, Burst: 2}
+
+	steps := []struct {
+		at      time.Duration
+		allowed bool
+	}{
+		{at: 0, allowed: true},
+		{at: 0, allowed: true},
+		{at: 0, allowed: false},
+		{at: 500 * time.Millisecond, allowed: false},
+		{at: time.Second, allowed: true},
+		{at: time.Second, allowed: false},
+		{at: 10 * time.Second, allowed: true},
+		{at: 10 * time.Second, allowed: true},
+		{at: 10 * time.Second, allowed: false},
+	}
+
+	var tat time.Time
+	for i, step := range steps {
+		var allowed bool
+		tat, allowed = gcra(limit, start.Add(step.at), tat)
+		if allowed != step.allowed {
+			t.Errorf("request %d at %v: allowed = %v, want %v", i, step.at, allowed, step.allowed)
+		}
+	}
+}
+
+func TestMemoryStoreAllow(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Rate: 1, Period: time.Hour, Burst: 2}
+
+	for i, want := range []bool{true, true, false} {
+		res, err := store.Allow(context.Background(), "a", limit)
+		if err != nil {
+			t.Fatalf("Allow() error = %v", err)
+		}
+		if res.Allowed != want {
+			t.Errorf("request %d of a: Allowed = %v, want %v", i, res.Allowed, want)
+		}
+	}
+	if res, _ := store.Allow(context.Background(), "b", limit); !res.Allowed {
+		t.Errorf("first request of b rejected, keys should not share a limit")
+	}
+}
+
+func TestMemoryStoreIncrement(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		want      []int64
+	}{
+		{name: "counts until expiry", expiresAt: time.Now().Add(time.Hour), want: []int64{1, 2, 3}},
+		{name: "expired counter restarts", expiresAt: time.Now().Add(-time.Second), want: []int64{1, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			for i, want := range tt.want {
+				got, err := store.Increment(context.Background(), "quota", tt.expiresAt)
+				if err != nil {
+					t.Fatalf("Increment() error = %v", err)
+				}
+				if got != want {
+					t.Errorf("Increment() %d = %d, want %d", i, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// gcraScript is gcra in Lua, with times in unix microseconds so they stay
+// exact in Lua numbers. It returns whether the request is allowed and the TAT.
+var gcraScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local burst_offset = tonumber(ARGV[3])
+local tat = tonumber(redis.call('GET', KEYS[1])) or now
+if tat < now then tat = now end
+local new_tat = tat + interval
+if now < new_tat - burst_offset then
+  return {0, string.format('%.0f', tat)}
+end
+redis.call('SET', KEYS[1], string.format('%.0f', new_tat), 'PX', math.ceil((new_tat - now) / 1000))
+return {1, string.format('%.0f', new_tat)}
+`)
+
+// incrementScript increments a counter and sets its expiry when it is created.
+var incrementScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then redis.call('PEXPIREAT', KEYS[1], ARGV[1]) end
+return count
+`)
+
+// RedisConfig configures a RedisStore.
+type RedisConfig struct {
+	// Address is the host:port of the server.
+	Address  string
+	Password string
+	DB       int
+	// KeyPrefix is put in front of every key. Defaults to "ratelimit:".
+	KeyPrefix string
+	// Timeout bounds each command when the context has no earlier deadline. Defaults to one second.
+	Timeout time.Duration
+	// MaxIdle is the number of idle connections kept open. Defaults to 10.
+	MaxIdle int
+}
+
+// RedisStore keeps limits in Redis, or any server speaking the Redis protocol,
+// using Lua scripts so that each request is a single atomic command.
+type RedisStore struct {
+	cfg    RedisConfig
+	client *redis.Client
+}
+
+func NewRedisStore(cfg RedisConfig) *RedisStore {
+	if cfg.KeyPrefix == "" {
+		cfg.KeyPrefix = "ratelimit:"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Second
+	}
+	if cfg.MaxIdle <= 0 {
+		cfg.MaxIdle = 10
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr:         cfg.Address,
+		Password:     cfg.Password,
+		DB:           cfg.DB,
+		DialTimeout:  cfg.Timeout,
+		ReadTimeout:  cfg.Timeout,
+		WriteTimeout: cfg.Timeout,
+		MaxIdleConns: cfg.MaxIdle,
+	})
+	return &RedisStore{cfg: cfg, client: client}
+}
+
+func (s *RedisStore) Name() string {
+	return STORE_REDIS
+}
+
+func (s *RedisStore) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now().Truncate(time.Microsecond)
+	// Run tries EVALSHA and loads the script with EVAL when the server does not know it yet.
+	values, err := gcraScript.Run(ctx, s.client, []string{s.cfg.KeyPrefix + key},
+		now.UnixMicro(),
+		limit.interval().Microseconds(),
+		(limit.interval() * time.Duration(limit.burst())).Microseconds()).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	if len(values) != 2 {
+		return Result{}, fmt.Errorf("unexpected reply from rate limit script: %v", values)
+	}
+	allowed, _ := values[0].(int64)
+	tatString, _ := values[1].(string)
+	tat, err := strconv.ParseInt(tatString, 10, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("unexpected TAT from rate limit script: %v", values[1])
+	}
+	return result(limit, now, time.UnixMicro(tat), allowed == 1), nil
+}
+
+func (s *RedisStore) Increment(ctx context.Context, key string, expiresAt time.Time) (int64, error) {
+	return incrementScript.Run(ctx, s.client, []string{s.cfg.KeyPrefix + key}, expiresAt.UnixMilli()).Int64()
+}
+
+// Close closes the connections to the server.
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestRedisStore(t *testing.T) (*RedisStore, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	store := NewRedisStore(RedisConfig{Address: server.Addr()})
+	t.Cleanup(func() { store.Close() })
+	return store, server
+}
+
+func TestRedisStoreAllow(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    Limit
+		requests int
+		allowed  int
+	}{
+		{name: "within burst", limit: Limit{Rate: 60, Period: time.Minute, Burst: 5}, requests: 3, allowed: 3},
+		{name: "burst exhausted", limit: Limit{Rate: 60, Period: time.Minute, Burst: 3}, requests: 5, allowed: 3},
+		{name: "burst below one", limit: Limit{Rate: 60, Period: time.Minute}, requests: 2, allowed: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, _ := newTestRedisStore(t)
+			allowed := 0
+			var last Result
+			for i := 0; i < tt.requests; i++ {
+				res, err := store.Allow(context.Background(), "key", tt.limit)
+				if err != nil {
+					t.Fatalf("Allow() error = %v", err)
+				}
+				if res.Allowed {
+					allowed++
+				}
+				last = res
+			}
+			if allowed != tt.allowed {
+				t.Errorf("allowed %d of %d requests, want %d", allowed, tt.requests, tt.allowed)
+			}
+			if tt.requests > tt.allowed && (last.Allowed || last.RetryAfter <= 0) {
+				t.Errorf("last result = %+v, want a rejection with a RetryAfter", last)
+			}
+		})
+	}
+}
+
+func TestRedisStoreReloadsFlushedScripts(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	limit := Limit{Rate: 60, Period: time.Minute, Burst: 2}
+
+	// The first call finds no script, so EVALSHA fails with NOSCRIPT and the script is loaded.
+	if _, err := store.Allow(context.Background(), "key", limit); err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	if err := store.client.ScriptFlush(context.Background()).Err(); err != nil {
+		t.Fatalf("SCRIPT FLUSH error = %v", err)
+	}
+	res, err := store.Allow(context.Background(), "key", limit)
+	if err != nil {
+		t.Fatalf("Allow() after SCRIPT FLUSH error = %v", err)
+	}
+	if !res.Allowed || res.Remaining != 0 {
+		t.Errorf("Allow() after SCRIPT FLUSH = %+v, want the second request of the burst", res)
+	}
+	if !server.Exists("ratelimit:key") {
+		t.Errorf("key ratelimit:key not stored")
+	}
+}
+
+func TestRedisStoreIncrement(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	expiresAt := time.Now().Add(time.Hour)
+
+	for want := int64(1); want <= 3; want++ {
+		got, err := store.Increment(context.Background(), "quota", expiresAt)
+		if err != nil {
+			t.Fatalf("Increment() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("Increment() = %d, want %d", got, want)
+		}
+	}
+	if ttl := server.TTL("ratelimit:quota"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("TTL = %v, want the time until expiresAt", ttl)
+	}
+}
+
+func TestRedisStoreUnreachable(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	server.Close()
+
+	if _, err := store.Allow(context.Background(), "key", Limit{Rate: 1, Period: time.Second}); err == nil {
+		t.Errorf("Allow() error = nil, want an error while the server is down")
+	}
+}
@@ -0,0 +1,149 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sqldb "chaits.org/go-microservices-repo/pkg/storage/sqldb/connectors"
+)
+
+// SQLStore keeps limits in the rate_limits table of a MySQL or PostgreSQL
+// database:
+//
+//	CREATE TABLE rate_limits (
+//	    limit_key VARCHAR(255) PRIMARY KEY,
+//	    value BIGINT NOT NULL,
+//	    expires_at BIGINT NOT NULL
+//	);
+//
+// Each request runs an INSERT and a transaction that locks the row of its key,
+// so the requests of one key are serialized in the database and cost it a
+// round trip each. That suits low request rates and deployments without Redis;
+// use RedisStore for high request rates or hot keys. Expired rows are deleted
+// at most once an hour.
+type SQLStore struct {
+	db     *sqldb.DB
+	driver string
+
+	mu          sync.Mutex
+	nextCleanup time.Time
+}
+
+// NewSQLStore returns a store on db, which was opened with driver
+// sqldb.DB_MYSQL or sqldb.DB_POSTGRES.
+func NewSQLStore(db *sqldb.DB, driver string) (*SQLStore, error) {
+	if driver != sqldb.DB_MYSQL && driver != sqldb.DB_POSTGRES {
+		return nil, fmt.Errorf("unsupported rate limit store driver: %s", driver)
+	}
+	return &SQLStore{db: db, driver: driver}, nil
+}
+
+func (s *SQLStore) Name() string {
+	return s.driver
+}
+
+// Allow stores the TAT of key in unix nanoseconds, in both value and expires_at.
+func (s *SQLStore) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+	var tat time.Time
+	var allowed bool
+	err := s.update(ctx, key, now, func(value int64) (int64, int64, bool) {
+		if value > 0 {
+			tat = time.Unix(0, value)
+		}
+		tat, allowed = gcra(limit, now, tat)
+		return tat.UnixNano(), tat.UnixNano(), allowed
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return result(limit, now, tat, allowed), nil
+}
+
+func (s *SQLStore) Increment(ctx context.Context, key string, expiresAt time.Time) (int64, error) {
+	var count int64
+	err := s.update(ctx, key, time.Now(), func(value int64) (int64, int64, bool) {
+		count = value + 1
+		return count, expiresAt.UnixNano(), true
+	})
+	return count, err
+}
+
+// update runs fn on the value of key inside a transaction that holds the row
+// lock. An expired value reads as zero. The row is written when fn says so.
+func (s *SQLStore) update(ctx context.Context, key string, now time.Time, fn func(value int64) (newValue, expiresAt int64, write bool)) error {
+	s.cleanup(now)
+
+	// Create the row first, so that concurrent first requests lock the same row.
+	insert := "INSERT IGNORE INTO rate_limits (limit_key, value, expires_at) VALUES (?, 0, 0)"
+	if s.driver == sqldb.DB_POSTGRES {
+		insert = "INSERT INTO rate_limits (limit_key, value, expires_at) VALUES (?, 0, 0) ON CONFLICT (limit_key) DO NOTHING"
+	}
+	if _, err := s.db.ExecContext(ctx, s.rebind(insert), key); err != nil {
+		return fmt.Errorf("failed to create rate limit row %s: %w", key, err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin rate limit transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var value, expiresAt int64
+	err = tx.QueryRowContext(ctx, s.rebind("SELECT value, expires_at FROM rate_limits WHERE limit_key = ? FOR UPDATE"), key).Scan(&value, &expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to read rate limit row %s: %w", key, err)
+	}
+	if expiresAt <= now.UnixNano() {
+		value = 0
+	}
+
+	value, expiresAt, write := fn(value)
+	if !write {
+		return nil
+	}
+	_, err = tx.ExecContext(ctx, s.rebind("UPDATE rate_limits SET value = ?, expires_at = ? WHERE limit_key = ?"), value, expiresAt, key)
+	if err != nil {
+		return fmt.Errorf("failed to write rate limit row %s: %w", key, err)
+	}
+	return tx.Commit()
+}
+
+// cleanup deletes expired rows in the background, at most once an hour.
+func (s *SQLStore) cleanup(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Before(s.nextCleanup) {
+		return
+	}
+	s.nextCleanup = now.Add(time.Hour)
+	go func() {
+		_, err := s.db.ExecContext(context.Background(), s.rebind("DELETE FROM rate_limits WHERE expires_at <= ?"), now.UnixNano())
+		if err != nil {
+			log.Printf("Error deleting expired rate limit rows: %v", err)
+		}
+	}()
+}
+
+// rebind replaces ? placeholders with $1, $2, ... for PostgreSQL.
+func (s *SQLStore) rebind(query string) string {
+	if s.driver != sqldb.DB_POSTGRES {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
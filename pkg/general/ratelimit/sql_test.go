@@ -0,0 +1,240 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	sqldb "chaits.org/go-microservices-repo/pkg/storage/sqldb/connectors"
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const (
+	mysqlInsert = "INSERT IGNORE INTO rate_limits (limit_key, value, expires_at) VALUES (?, 0, 0)"
+	mysqlSelect = "SELECT value, expires_at FROM rate_limits WHERE limit_key = ? FOR UPDATE"
+	mysqlUpdate = "UPDATE rate_limits SET value = ?, expires_at = ? WHERE limit_key = ?"
+)
+
+// newTestSQLStore returns a store on a mock database whose statements must
+// match exactly. The hourly cleanup is not due.
+func newTestSQLStore(t *testing.T, driver string) (*SQLStore, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("sqlmock.New() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store, err := NewSQLStore(sqldb.NewDB(db, &sqldb.DBConfig{DBDriver: driver}), driver)
+	if err != nil {
+		t.Fatalf("NewSQLStore() error = %v", err)
+	}
+	store.nextCleanup = time.Now().Add(time.Hour)
+	return store, mock
+}
+
+// nanosAround matches a unix nanosecond value within a second of want.
+type nanosAround struct{ want time.Time }
+
+func (m nanosAround) Match(v driver.Value) bool {
+	n, ok := v.(int64)
+	return ok && time.Unix(0, n).Sub(m.want).Abs() < time.Second
+}
+
+func TestSQLStoreAllow(t *testing.T) {
+	limit := Limit{Rate: 60, Period: time.Minute, Burst: 2}
+	now := time.Now()
+
+	tests := []struct {
+		name          string
+		value         time.Time
+		expiresAt     time.Time
+		wantAllowed   bool
+		wantRemaining int
+		wantTAT       time.Time
+	}{
+		{name: "new key", wantAllowed: true, wantRemaining: 1, wantTAT: now.Add(time.Second)},
+		{name: "stored TAT", value: now.Add(time.Second), expiresAt: now.Add(time.Second),
+			wantAllowed: true, wantRemaining: 0, wantTAT: now.Add(2 * time.Second)},
+		{name: "burst exhausted", value: now.Add(2 * time.Second), expiresAt: now.Add(2 * time.Second)},
+		{name: "expired row is reset", value: now.Add(time.Hour), expiresAt: now.Add(-time.Second),
+			wantAllowed: true, wantRemaining: 1, wantTAT: now.Add(time.Second)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, mock := newTestSQLStore(t, sqldb.DB_MYSQL)
+			var value, expiresAt int64
+			if !tt.value.IsZero() {
+				value, expiresAt = tt.value.UnixNano(), tt.expiresAt.UnixNano()
+			}
+
+			mock.ExpectExec(mysqlInsert).WithArgs("app:billing").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectBegin()
+			mock.ExpectQuery(mysqlSelect).WithArgs("app:billing").
+				WillReturnRows(sqlmock.NewRows([]string{"value", "expires_at"}).AddRow(value, expiresAt))
+			if tt.wantAllowed {
+				tat := nanosAround{tt.wantTAT}
+				mock.ExpectExec(mysqlUpdate).WithArgs(tat, tat, "app:billing").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			res, err := store.Allow(context.Background(), "app:billing", limit)
+			if err != nil {
+				t.Fatalf("Allow() error = %v", err)
+			}
+			if res.Allowed != tt.wantAllowed || res.Allowed && res.Remaining != tt.wantRemaining {
+				t.Errorf("Allow() = %+v, want allowed %v with %d remaining", res, tt.wantAllowed, tt.wantRemaining)
+			}
+			if !res.Allowed && res.RetryAfter <= 0 {
+				t.Errorf("rejected with RetryAfter = %v", res.RetryAfter)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestSQLStoreIncrement(t *testing.T) {
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		value     int64
+		expiresAt time.Time
+		want      int64
+	}{
+		{name: "new key", want: 1},
+		{name: "stored count", value: 4, expiresAt: now.Add(time.Minute), want: 5},
+		{name: "expired count is reset", value: 4, expiresAt: now.Add(-time.Minute), want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, mock := newTestSQLStore(t, sqldb.DB_MYSQL)
+			var storedExpiry int64
+			if !tt.expiresAt.IsZero() {
+				storedExpiry = tt.expiresAt.UnixNano()
+			}
+
+			mock.ExpectExec(mysqlInsert).WithArgs("quota:billing").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectBegin()
+			mock.ExpectQuery(mysqlSelect).WithArgs("quota:billing").
+				WillReturnRows(sqlmock.NewRows([]string{"value", "expires_at"}).AddRow(tt.value, storedExpiry))
+			mock.ExpectExec(mysqlUpdate).WithArgs(tt.want, expiresAt.UnixNano(), "quota:billing").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			count, err := store.Increment(context.Background(), "quota:billing", expiresAt)
+			if err != nil {
+				t.Fatalf("Increment() error = %v", err)
+			}
+			if count != tt.want {
+				t.Errorf("Increment() = %d, want %d", count, tt.want)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestSQLStorePostgres(t *testing.T) {
+	store, mock := newTestSQLStore(t, sqldb.DB_POSTGRES)
+	expiresAt := time.Now().Add(time.Hour)
+
+	mock.ExpectExec("INSERT INTO rate_limits (limit_key, value, expires_at) VALUES ($1, 0, 0) ON CONFLICT (limit_key) DO NOTHING").
+		WithArgs("quota:billing").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT value, expires_at FROM rate_limits WHERE limit_key = $1 FOR UPDATE").
+		WithArgs("quota:billing").WillReturnRows(sqlmock.NewRows([]string{"value", "expires_at"}).AddRow(0, 0))
+	mock.ExpectExec("UPDATE rate_limits SET value = $1, expires_at = $2 WHERE limit_key = $3").
+		WithArgs(int64(1), expiresAt.UnixNano(), "quota:billing").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if _, err := store.Increment(context.Background(), "quota:billing", expiresAt); err != nil {
+		t.Fatalf("Increment() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSQLStoreErrors(t *testing.T) {
+	dbErr := errors.New("connection refused")
+
+	tests := []struct {
+		name   string
+		expect func(mock sqlmock.Sqlmock)
+	}{
+		{name: "insert fails", expect: func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec(mysqlInsert).WillReturnError(dbErr)
+		}},
+		{name: "select fails", expect: func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec(mysqlInsert).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectBegin()
+			mock.ExpectQuery(mysqlSelect).WillReturnError(dbErr)
+			mock.ExpectRollback()
+		}},
+		{name: "update fails", expect: func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec(mysqlInsert).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectBegin()
+			mock.ExpectQuery(mysqlSelect).WillReturnRows(sqlmock.NewRows([]string{"value", "expires_at"}).AddRow(0, 0))
+			mock.ExpectExec(mysqlUpdate).WillReturnError(dbErr)
+			mock.ExpectRollback()
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, mock := newTestSQLStore(t, sqldb.DB_MYSQL)
+			tt.expect(mock)
+
+			_, err := store.Increment(context.Background(), "quota:billing", time.Now().Add(time.Hour))
+			if !errors.Is(err, dbErr) {
+				t.Errorf("Increment() error = %v, want %v", err, dbErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestSQLStoreCleanup(t *testing.T) {
+	store, mock := newTestSQLStore(t, sqldb.DB_POSTGRES)
+	start := time.Now()
+	store.nextCleanup = time.Time{}
+
+	steps := []struct {
+		at         time.Duration
+		wantDelete bool
+	}{
+		{at: 0, wantDelete: true},
+		{at: 30 * time.Minute, wantDelete: false},
+		{at: 61 * time.Minute, wantDelete: true},
+	}
+
+	for _, step := range steps {
+		now := start.Add(step.at)
+		if step.wantDelete {
+			mock.ExpectExec("DELETE FROM rate_limits WHERE expires_at <= $1").
+				WithArgs(now.UnixNano()).WillReturnResult(sqlmock.NewResult(0, 3))
+		}
+		store.cleanup(now)
+
+		// The delete runs in the background.
+		deadline := time.Now().Add(time.Second)
+		for mock.ExpectationsWereMet() != nil && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("cleanup after %v: %v", step.at, err)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package tracing
+
+import (
+	"chaits.org/go-microservices-repo/pkg/general/config"
+)
+
+// Config holds the settings used by InitTracer to build the tracer provider.
+type Config struct {
+	// Exporter is one of EXPORTER_OTLP_GRPC, EXPORTER_OTLP_HTTP, EXPORTER_STDOUT or EXPORTER_NONE.
+	Exporter string
+
+	// Endpoint is the collector address. Defaults to the standard OTLP port for the exporter.
+	Endpoint string
+
+	// Headers are sent with every export request, e.g. collector auth tokens.
+	Headers map[string]string
+
+	// Insecure disables TLS towards the collector.
+	Insecure bool
+
+	// TLS settings used when Insecure is false. All files are PEM encoded.
+	TLSCAFile     string
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSServerName string
+
+	// SampleRatio is the fraction of new root traces that are sampled.
+	// Spans with a parent always follow the parent's decision.
+	SampleRatio float64
+
+	// Environment is reported as deployment.environment on every span.
+	Environment string
+
+	// Version is reported as service.version. Defaults to the module build info.
+	Version string
+
+	// Propagators are the formats injected into outgoing requests. Incoming
+	// requests are always extracted from any supported format.
+	Propagators []string
+
+	// TailSampling enables tail-based sampling when set. SampleRatio is then
+	// ignored: every span is recorded and the tail sampler decides what is exported.
+	TailSampling *TailSamplingConfig
+
+	// DebugMaxTraces keeps the last N traces in memory for the /debug/traces
+	// viewer when greater than zero.
+	DebugMaxTraces int
+
+	// ServiceGraph derives a caller -> callee dependency graph from spans when set.
+	ServiceGraph *ServiceGraphConfig
+}
+
+type Option func(*Config)
+
+func defaultConfig() *Config {
+	return &Config{
+		Exporter:    EXPORTER_OTLP_GRPC,
+		Insecure:    true,
+		SampleRatio: 1.0,
+		Propagators: []string{PROPAGATOR_TRACECONTEXT, PROPAGATOR_BAGGAGE},
+	}
+}
+
+func WithExporter(exporter string) Option {
+	return func(c *Config) {
+		c.Exporter = exporter
+	}
+}
+
+func WithEndpoint(endpoint string) Option {
+	return func(c *Config) {
+		c.Endpoint = endpoint
+	}
+}
+
+func WithHeaders(headers map[string]string) Option {
+	return func(c *Config) {
+		c.Headers = headers
+	}
+}
+
+func WithInsecure(insecure bool) Option {
+	return func(c *Config) {
+		c.Insecure = insecure
+	}
+}
+
+// WithTLS configures a TLS connection to the collector. certFile and keyFile
+// are only needed when the collector requires client certificates.
+func WithTLS(caFile, certFile, keyFile, serverName string) Option {
+	return func(c *Config) {
+		c.Insecure = false
+		c.TLSCAFile = caFile
+		c.TLSCertFile = certFile
+		c.TLSKeyFile = keyFile
+		c.TLSServerName = serverName
+	}
+}
+
+func WithSampleRatio(ratio float64) Option {
+	return func(c *Config) {
+		c.SampleRatio = ratio
+	}
+}
+
+func WithEnvironment(environment string) Option {
+	return func(c *Config) {
+		c.Environment = environment
+	}
+}
+
+func WithServiceVersion(version string) Option {
+	return func(c *Config) {
+		c.Version = version
+	}
+}
+
+// WithPropagators sets the formats injected into outgoing requests, e.g.
+// PROPAGATOR_TRACECONTEXT, PROPAGATOR_BAGGAGE and PROPAGATOR_B3_MULTI.
+func WithPropagators(propagators ...string) Option {
+	return func(c *Config) {
+		c.Propagators = propagators
+	}
+}
+
+// WithTailSampling buffers each trace until its root span ends and exports it
+// only if one of the rules in tailConfig matches.
+func WithTailSampling(tailConfig TailSamplingConfig) Option {
+	return func(c *Config) {
+		c.TailSampling = &tailConfig
+	}
+}
+
+// WithDebugTraces keeps the last maxTraces traces in memory so they can be
+// browsed through DebugTracesHandler, independently of the exporter.
+func WithDebugTraces(maxTraces int) Option {
+	return func(c *Config) {
+		c.DebugMaxTraces = maxTraces
+	}
+}
+
+// WithServiceGraph builds a live dependency graph from the spans of this
+// service, served by ServiceGraphHandler.
+func WithServiceGraph(graphConfig ServiceGraphConfig) Option {
+	return func(c *Config) {
+		c.ServiceGraph = &graphConfig
+	}
+}
+
+// WithAppConfig reads the tracing.* keys from the application configuration.
+// Keys that are not set keep their defaults, so it can be combined with other options.
+func WithAppConfig(appConfig *config.AppConfig) Option {
+	return func(c *Config) {
+		if appConfig.IsSet(CONFIG_EXPORTER) {
+			c.Exporter = appConfig.GetConfig(CONFIG_EXPORTER)
+		}
+		if appConfig.IsSet(CONFIG_ENDPOINT) {
+			c.Endpoint = appConfig.GetConfig(CONFIG_ENDPOINT)
+		}
+		if appConfig.IsSet(CONFIG_INSECURE) {
+			c.Insecure = appConfig.GetBool(CONFIG_INSECURE)
+		}
+		if appConfig.IsSet(CONFIG_HEADERS) {
+			c.Headers = appConfig.GetStringMapString(CONFIG_HEADERS)
+		}
+		if appConfig.IsSet(CONFIG_TLS_CA_FILE) {
+			c.TLSCAFile = appConfig.GetConfig(CONFIG_TLS_CA_FILE)
+		}
+		if appConfig.IsSet(CONFIG_TLS_CERT_FILE) {
+			c.TLSCertFile = appConfig.GetConfig(CONFIG_TLS_CERT_FILE)
+		}
+		if appConfig.IsSet(CONFIG_TLS_KEY_FILE) {
+			c.TLSKeyFile = appConfig.GetConfig(CONFIG_TLS_KEY_FILE)
+		}
+		if appConfig.IsSet(CONFIG_TLS_SERVER_NAME) {
+			c.TLSServerName = appConfig.GetConfig(CONFIG_TLS_SERVER_NAME)
+		}
+		if appConfig.IsSet(CONFIG_PROPAGATORS) {
+			c.Propagators = appConfig.GetStringSlice(CONFIG_PROPAGATORS)
+		}
+		if appConfig.IsSet(CONFIG_SAMPLE_RATIO) {
+			c.SampleRatio = appConfig.GetFloat64(CONFIG_SAMPLE_RATIO)
+		}
+		if appConfig.IsSet(CONFIG_ENVIRONMENT) {
+			c.Environment = appConfig.GetConfig(CONFIG_ENVIRONMENT)
+		}
+		// The application environment is only a fallback for an unset environment.
+		if c.Environment == "" {
+			c.Environment = appConfig.Env()
+		}
+		if appConfig.GetBool(CONFIG_TAIL_SAMPLING_ENABLED) {
+			c.TailSampling = tailSamplingFromAppConfig(appConfig)
+		}
+		if appConfig.GetBool(CONFIG_DEBUG_ENABLED) {
+			c.DebugMaxTraces = appConfig.GetInt(CONFIG_DEBUG_MAX_TRACES)
+			if c.DebugMaxTraces <= 0 {
+				c.DebugMaxTraces = 100
+			}
+		}
+		if appConfig.GetBool(CONFIG_SERVICE_GRAPH_ENABLED) {
+			c.ServiceGraph = &ServiceGraphConfig{
+				Window: appConfig.GetDuration(CONFIG_SERVICE_GRAPH_WINDOW),
+				Peers:  appConfig.GetStringMapString(CONFIG_SERVICE_GRAPH_PEERS),
+			}
+		}
+	}
+}
+
+func tailSamplingFromAppConfig(appConfig *config.AppConfig) *TailSamplingConfig {
+	tailConfig := defaultTailSamplingConfig()
+	if appConfig.IsSet(CONFIG_TAIL_SAMPLING_LATENCY_THRESHOLD) {
+		tailConfig.LatencyThreshold = appConfig.GetDuration(CONFIG_TAIL_SAMPLING_LATENCY_THRESHOLD)
+	}
+	if appConfig.IsSet(CONFIG_TAIL_SAMPLING_ROUTES) {
+		tailConfig.Routes = appConfig.GetStringSlice(CONFIG_TAIL_SAMPLING_ROUTES)
+	}
+	if appConfig.IsSet(CONFIG_TAIL_SAMPLING_BASELINE_RATIO) {
+		tailConfig.BaselineRatio = appConfig.GetFloat64(CONFIG_TAIL_SAMPLING_BASELINE_RATIO)
+	}
+	if appConfig.IsSet(CONFIG_TAIL_SAMPLING_MAX_TRACES) {
+		tailConfig.MaxTraces = appConfig.GetInt(CONFIG_TAIL_SAMPLING_MAX_TRACES)
+	}
+	if appConfig.IsSet(CONFIG_TAIL_SAMPLING_MAX_SPANS_PER_TRACE) {
+		tailConfig.MaxSpansPerTrace = appConfig.GetInt(CONFIG_TAIL_SAMPLING_MAX_SPANS_PER_TRACE)
+	}
+	if appConfig.IsSet(CONFIG_TAIL_SAMPLING_TRACE_TIMEOUT) {
+		tailConfig.TraceTimeout = appConfig.GetDuration(CONFIG_TAIL_SAMPLING_TRACE_TIMEOUT)
+	}
+	return &tailConfig
+}
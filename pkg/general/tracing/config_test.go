@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"testing"
+
+	"chaits.org/go-microservices-repo/pkg/general/config"
+)
+
+func TestWithAppConfigKeepsUnsetKeys(t *testing.T) {
+	tls := WithTLS("ca.pem", "cert.pem", "key.pem", "collector")
+
+	tests := []struct {
+		name    string
+		before  []Option
+		keys    map[string]string
+		want    Config
+		wantTLS [4]string
+	}{
+		{name: "nothing set", want: Config{Exporter: EXPORTER_OTLP_GRPC, Insecure: true, Environment: "test"}},
+		{name: "options kept when keys are unset", before: []Option{tls, WithEnvironment("staging")},
+			want:    Config{Exporter: EXPORTER_OTLP_GRPC, Insecure: false, Environment: "staging"},
+			wantTLS: [4]string{"ca.pem", "cert.pem", "key.pem", "collector"}},
+		{name: "keys override options", before: []Option{tls, WithEnvironment("staging")},
+			keys: map[string]string{
+				CONFIG_EXPORTER:        EXPORTER_OTLP_HTTP,
+				CONFIG_TLS_CA_FILE:     "/etc/otel/ca.pem",
+				CONFIG_TLS_SERVER_NAME: "otel.internal",
+				CONFIG_ENVIRONMENT:     "production",
+			},
+			want:    Config{Exporter: EXPORTER_OTLP_HTTP, Insecure: false, Environment: "production"},
+			wantTLS: [4]string{"/etc/otel/ca.pem", "cert.pem", "key.pem", "otel.internal"}},
+		{name: "empty environment falls back to the app environment", keys: map[string]string{CONFIG_ENVIRONMENT: ""},
+			want: Config{Exporter: EXPORTER_OTLP_GRPC, Insecure: true, Environment: "test"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appConfig := config.InitConfigs("test")
+			for key, value := range tt.keys {
+				appConfig.SetConfig(key, value)
+			}
+			cfg := defaultConfig()
+			for _, opt := range append(tt.before, WithAppConfig(appConfig)) {
+				opt(cfg)
+			}
+
+			if cfg.Exporter != tt.want.Exporter || cfg.Insecure != tt.want.Insecure || cfg.Environment != tt.want.Environment {
+				t.Errorf("exporter %s insecure %v environment %q, want %s %v %q",
+					cfg.Exporter, cfg.Insecure, cfg.Environment, tt.want.Exporter, tt.want.Insecure, tt.want.Environment)
+			}
+			if got := [4]string{cfg.TLSCAFile, cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSServerName}; got != tt.wantTLS {
+				t.Errorf("TLS files = %q, want %q", got, tt.wantTLS)
+			}
+		})
+	}
+}
@@ -4,3 +4,41 @@ const (
 	GRPC_COLLECTOR_ENDPOINT = "localhost:4317"
 	HTTP_COLLECTOR_ENDPOINT = "localhost:4318"
 )
+
+// Supported span exporters.
+const (
+	EXPORTER_OTLP_GRPC = "otlp-grpc"
+	EXPORTER_OTLP_HTTP = "otlp-http"
+	EXPORTER_STDOUT    = "stdout"
+	EXPORTER_NONE      = "none"
+)
+
+// Configuration keys read by WithAppConfig.
+const (
+	CONFIG_EXPORTER        = "tracing.exporter"
+	CONFIG_ENDPOINT        = "tracing.endpoint"
+	CONFIG_INSECURE        = "tracing.insecure"
+	CONFIG_HEADERS         = "tracing.headers"
+	CONFIG_TLS_CA_FILE     = "tracing.tls.ca_file"
+	CONFIG_TLS_CERT_FILE   = "tracing.tls.cert_file"
+	CONFIG_TLS_KEY_FILE    = "tracing.tls.key_file"
+	CONFIG_TLS_SERVER_NAME = "tracing.tls.server_name"
+	CONFIG_SAMPLE_RATIO    = "tracing.sample_ratio"
+	CONFIG_ENVIRONMENT     = "tracing.environment"
+	CONFIG_PROPAGATORS     = "tracing.propagators"
+
+	CONFIG_TAIL_SAMPLING_ENABLED             = "tracing.tail_sampling.enabled"
+	CONFIG_TAIL_SAMPLING_LATENCY_THRESHOLD   = "tracing.tail_sampling.latency_threshold"
+	CONFIG_TAIL_SAMPLING_ROUTES              = "tracing.tail_sampling.routes"
+	CONFIG_TAIL_SAMPLING_BASELINE_RATIO      = "tracing.tail_sampling.baseline_ratio"
+	CONFIG_TAIL_SAMPLING_MAX_TRACES          = "tracing.tail_sampling.max_traces"
+	CONFIG_TAIL_SAMPLING_MAX_SPANS_PER_TRACE = "tracing.tail_sampling.max_spans_per_trace"
+	CONFIG_TAIL_SAMPLING_TRACE_TIMEOUT       = "tracing.tail_sampling.trace_timeout"
+
+	CONFIG_DEBUG_ENABLED    = "tracing.debug.enabled"
+	CONFIG_DEBUG_MAX_TRACES = "tracing.debug.max_traces"
+
+	CONFIG_SERVICE_GRAPH_ENABLED = "tracing.service_graph.enabled"
+	CONFIG_SERVICE_GRAPH_WINDOW  = "tracing.service_graph.window"
+	CONFIG_SERVICE_GRAPH_PEERS   = "tracing.service_graph.peers"
+)
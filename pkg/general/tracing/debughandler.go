@@ -0,0 +1,257 @@
+package tracing
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// debugExporter is set by InitTracer when WithDebugTraces is used.
+var debugExporter *MemoryExporter
+
+// DebugExporter returns the in-memory exporter installed by WithDebugTraces,
+// or nil when the trace viewer is disabled.
+func DebugExporter() *MemoryExporter {
+	return debugExporter
+}
+
+// DebugMux serves the trace viewer and the service graph, for an admin
+// listener that is not reachable from the public network.
+func DebugMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/traces", DebugTracesHandler())
+	mux.Handle("/debug/traces/", DebugTracesHandler())
+	mux.Handle("/debug/servicegraph", ServiceGraphHandler())
+	return mux
+}
+
+// DebugTracesHandler serves the local trace viewer. Register it for both
+// "/debug/traces" and "/debug/traces/".
+//
+//	GET /debug/traces                      HTML list of recent traces
+//	GET /debug/traces?trace_id=<id>        HTML waterfall of one trace
+//	GET /debug/traces/api                  JSON list of recent traces
+//	GET /debug/traces/api?trace_id=<id>    JSON spans of one trace
+//
+// The lists accept the route, status (ok|error), min_duration (e.g. 250ms) and limit query parameters.
+func DebugTracesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exporter := DebugExporter()
+		if exporter == nil {
+			http.Error(w, "Trace viewer disabled. Enable tracing.debug in the configuration.", http.StatusNotFound)
+			return
+		}
+
+		query := r.URL.Query()
+		asJSON := strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/api")
+
+		if traceID := query.Get("trace_id"); traceID != "" {
+			spans, ok := exporter.Trace(traceID)
+			if !ok {
+				http.Error(w, "Trace not found", http.StatusNotFound)
+				return
+			}
+			if asJSON {
+				writeDebugJSON(w, spans)
+				return
+			}
+			renderDebugPage(w, waterfallTemplate, newWaterfall(traceID, spans))
+			return
+		}
+
+		filter, err := parseTraceFilter(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		traces := exporter.Traces(filter)
+		if asJSON {
+			writeDebugJSON(w, traces)
+			return
+		}
+		renderDebugPage(w, listTemplate, map[string]any{
+			"Traces": traces,
+			"Route":  query.Get("route"),
+			"Status": query.Get("status"),
+			"MinDur": query.Get("min_duration"),
+		})
+	})
+}
+
+func parseTraceFilter(query map[string][]string) (TraceFilter, error) {
+	get := func(key string) string {
+		if values := query[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	filter := TraceFilter{
+		Route:  get("route"),
+		Status: get("status"),
+		Limit:  100,
+	}
+	if minDuration := get("min_duration"); minDuration != "" {
+		d, err := time.ParseDuration(minDuration)
+		if err != nil {
+			return filter, err
+		}
+		filter.MinDuration = d
+	}
+	if limit := get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return filter, err
+		}
+		filter.Limit = n
+	}
+	return filter, nil
+}
+
+func writeDebugJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, "Error formatting response", http.StatusInternalServerError)
+	}
+}
+
+func renderDebugPage(w http.ResponseWriter, tmpl *template.Template, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+	}
+}
+
+// waterfallRow is one span in the waterfall, positioned relative to the trace.
+type waterfallRow struct {
+	SpanRecord
+	Depth       int
+	OffsetPct   float64
+	WidthPct    float64
+	IndentPixel int
+}
+
+type waterfall struct {
+	TraceID    string
+	DurationMS float64
+	Rows       []waterfallRow
+}
+
+// newWaterfall orders spans depth-first under their parents and computes the
+// bar offsets as a percentage of the whole trace.
+func newWaterfall(traceID string, spans []SpanRecord) waterfall {
+	summary := summarize(spans)
+	total := summary.DurationMS
+	if total <= 0 {
+		total = 1
+	}
+
+	children := make(map[string][]SpanRecord)
+	ids := make(map[string]bool, len(spans))
+	for _, span := range spans {
+		ids[span.SpanID] = true
+	}
+	var roots []SpanRecord
+	for _, span := range spans {
+		if ids[span.ParentID] {
+			children[span.ParentID] = append(children[span.ParentID], span)
+		} else {
+			roots = append(roots, span)
+		}
+	}
+
+	wf := waterfall{TraceID: traceID, DurationMS: summary.DurationMS}
+	var walk func(span SpanRecord, depth int)
+	walk = func(span SpanRecord, depth int) {
+		offset := float64(span.Start.Sub(summary.Start)) / float64(time.Millisecond)
+		width := span.DurationMS / total * 100
+		if width < 0.5 {
+			width = 0.5
+		}
+		wf.Rows = append(wf.Rows, waterfallRow{
+			SpanRecord:  span,
+			Depth:       depth,
+			OffsetPct:   offset / total * 100,
+			WidthPct:    width,
+			IndentPixel: depth * 16,
+		})
+		for _, child := range children[span.SpanID] {
+			walk(child, depth+1)
+		}
+	}
+	for _, root := range roots {
+		walk(root, 0)
+	}
+	return wf
+}
+
+const debugStyle = `<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 4px 8px; border-bottom: 1px solid #ddd; font-size: 14px; }
+.error { color: #c0392b; }
+.bar-cell { width: 50%; }
+.bar-track { position: relative; height: 14px; background: #f4f4f4; }
+.bar { position: absolute; height: 14px; background: #3498db; }
+.bar.error { background: #e74c3c; }
+details { font-size: 12px; }
+</style>`
+
+var listTemplate = template.Must(template.New("list").Parse(`<!DOCTYPE html>
+<html><head><title>Recent Traces</title>` + debugStyle + `</head><body>
+<h1>Recent Traces</h1>
+<form method="get">
+  Route <input name="route" value="{{.Route}}">
+  Status <select name="status">
+    <option value="" {{if eq .Status ""}}selected{{end}}>any</option>
+    <option value="ok" {{if eq .Status "ok"}}selected{{end}}>ok</option>
+    <option value="error" {{if eq .Status "error"}}selected{{end}}>error</option>
+  </select>
+  Min duration <input name="min_duration" value="{{.MinDur}}" placeholder="250ms">
+  <button type="submit">Filter</button>
+</form>
+<table>
+<tr><th>Start</th><th>Service</th><th>Root</th><th>Route</th><th>Status</th><th>Duration (ms)</th><th>Spans</th></tr>
+{{range .Traces}}
+<tr>
+  <td>{{.Start.Format "15:04:05.000"}}</td>
+  <td>{{.Service}}</td>
+  <td><a href="?trace_id={{.TraceID}}">{{.RootName}}</a></td>
+  <td>{{.Route}}</td>
+  <td class="{{.Status}}">{{.Status}}</td>
+  <td>{{printf "%.2f" .DurationMS}}</td>
+  <td>{{.SpanCount}}</td>
+</tr>
+{{else}}
+<tr><td colspan="7">No traces recorded yet.</td></tr>
+{{end}}
+</table>
+</body></html>`))
+
+var waterfallTemplate = template.Must(template.New("waterfall").Parse(`<!DOCTYPE html>
+<html><head><title>Trace {{.TraceID}}</title>` + debugStyle + `</head><body>
+<p><a href="?">&larr; Recent traces</a></p>
+<h1>Trace {{.TraceID}}</h1>
+<p>Total duration: {{printf "%.2f" .DurationMS}} ms</p>
+<table>
+<tr><th>Span</th><th>Service</th><th>Duration (ms)</th><th class="bar-cell">Timeline</th></tr>
+{{range .Rows}}
+<tr>
+  <td style="padding-left: {{.IndentPixel}}px" class="{{.Status}}">
+    {{.Name}} <small>({{.Kind}})</small>
+    <details><summary>details</summary>
+      {{if .StatusMsg}}<div class="error">{{.StatusMsg}}</div>{{end}}
+      {{range $k, $v := .Attributes}}<div>{{$k}} = {{$v}}</div>{{end}}
+      {{range .Events}}<div>event: {{.Name}} @ {{.Time.Format "15:04:05.000"}}</div>{{end}}
+    </details>
+  </td>
+  <td>{{.Service}}</td>
+  <td>{{printf "%.2f" .DurationMS}}</td>
+  <td class="bar-cell"><div class="bar-track"><div class="bar {{.Status}}" style="left: {{printf "%.2f" .OffsetPct}}%; width: {{printf "%.2f" .WidthPct}}%"></div></div></td>
+</tr>
+{{end}}
+</table>
+</body></html>`))
@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"chaits.org/go-microservices-repo/pkg/general/config"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestDebugTracesDisabledByDefault(t *testing.T) {
+	cfg := defaultConfig()
+	WithAppConfig(config.InitConfigs("test"))(cfg)
+	if cfg.DebugMaxTraces != 0 {
+		t.Errorf("DebugMaxTraces = %d without tracing.debug.enabled, want 0", cfg.DebugMaxTraces)
+	}
+
+	if DebugExporter() != nil {
+		t.Fatal("a debug exporter is installed before InitTracer")
+	}
+	for _, path := range []string{"/debug/traces", "/debug/traces/api", "/debug/traces/api?trace_id=" + traceIDOf(1)} {
+		rec := httptest.NewRecorder()
+		DebugMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want %d", path, rec.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestDebugTracesHandler(t *testing.T) {
+	exporter := NewMemoryExporter(10)
+	exporter.ExportSpans(context.Background(), []sdktrace.ReadOnlySpan{
+		spanAt(1, 1, 0, "GET /apps", 0, 10*time.Millisecond, false),
+		spanAt(2, 1, 0, "POST /apps", time.Second, 10*time.Millisecond, true),
+	})
+	debugExporter = exporter
+	t.Cleanup(func() { debugExporter = nil })
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantType   string
+		check      func(t *testing.T, body string)
+	}{
+		{name: "JSON list", path: "/debug/traces/api?status=error", wantStatus: http.StatusOK, wantType: "application/json",
+			check: func(t *testing.T, body string) {
+				var traces []TraceSummary
+				json.Unmarshal([]byte(body), &traces)
+				if len(traces) != 1 || traces[0].RootName != "POST /apps" {
+					t.Errorf("traces = %+v, want the failed trace", traces)
+				}
+			}},
+		{name: "JSON trace", path: "/debug/traces/api?trace_id=" + traceIDOf(1), wantStatus: http.StatusOK, wantType: "application/json",
+			check: func(t *testing.T, body string) {
+				var spans []SpanRecord
+				json.Unmarshal([]byte(body), &spans)
+				if len(spans) != 1 || spans[0].Name != "GET /apps" {
+					t.Errorf("spans = %+v, want the GET /apps root", spans)
+				}
+			}},
+		{name: "HTML list", path: "/debug/traces", wantStatus: http.StatusOK, wantType: "text/html",
+			check: func(t *testing.T, body string) {
+				if !strings.Contains(body, "POST /apps") {
+					t.Error("list does not show the traces")
+				}
+			}},
+		{name: "HTML waterfall", path: "/debug/traces/?trace_id=" + traceIDOf(2), wantStatus: http.StatusOK, wantType: "text/html"},
+		{name: "unknown trace", path: "/debug/traces/api?trace_id=" + traceIDOf(9), wantStatus: http.StatusNotFound},
+		{name: "invalid filter", path: "/debug/traces/api?min_duration=soon", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			DebugMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("GET %s = %d, want %d", tt.path, rec.Code, tt.wantStatus)
+			}
+			if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, tt.wantType) {
+				t.Errorf("Content-Type = %q, want %s", contentType, tt.wantType)
+			}
+			if tt.check != nil {
+				tt.check(t, rec.Body.String())
+			}
+		})
+	}
+}
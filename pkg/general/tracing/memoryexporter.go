@@ -0,0 +1,275 @@
+package tracing
+
+import (
+	"container/list"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.20.0"
+)
+
+// SpanRecord is the in-memory copy of an exported span.
+type SpanRecord struct {
+	TraceID    string            `json:"trace_id"`
+	SpanID     string            `json:"span_id"`
+	ParentID   string            `json:"parent_id,omitempty"`
+	Name       string            `json:"name"`
+	Service    string            `json:"service"`
+	Kind       string            `json:"kind"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	DurationMS float64           `json:"duration_ms"`
+	Status     string            `json:"status"`
+	StatusMsg  string            `json:"status_message,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Events     []SpanEvent       `json:"events,omitempty"`
+}
+
+// SpanEvent is an event recorded on a span.
+type SpanEvent struct {
+	Name       string            `json:"name"`
+	Time       time.Time         `json:"time"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// TraceSummary describes one trace in the trace list.
+type TraceSummary struct {
+	TraceID    string    `json:"trace_id"`
+	RootName   string    `json:"root_name"`
+	Service    string    `json:"service"`
+	Route      string    `json:"route,omitempty"`
+	Status     string    `json:"status"`
+	Start      time.Time `json:"start"`
+	DurationMS float64   `json:"duration_ms"`
+	SpanCount  int       `json:"span_count"`
+}
+
+// TraceFilter narrows down the traces returned by MemoryExporter.Traces.
+type TraceFilter struct {
+	// Route matches traces whose root route or name contains this value.
+	Route string
+	// Status is "ok" or "error". Empty matches both.
+	Status string
+	// MinDuration skips traces faster than this.
+	MinDuration time.Duration
+	// Limit caps the number of traces returned. Zero returns all of them.
+	Limit int
+}
+
+const (
+	SPAN_STATUS_OK    = "ok"
+	SPAN_STATUS_ERROR = "error"
+)
+
+// maxSpansPerStoredTrace bounds memory for runaway traces such as long loops.
+const maxSpansPerStoredTrace = 1000
+
+// storedTrace holds the spans of one trace, most recently updated last in the LRU list.
+type storedTrace struct {
+	id      string
+	spans   []SpanRecord
+	element *list.Element
+}
+
+// MemoryExporter is a span exporter that keeps the spans of the last N traces
+// in memory, so they can be browsed without a collector or Jaeger running.
+type MemoryExporter struct {
+	maxTraces int
+
+	mu     sync.RWMutex
+	traces map[string]*storedTrace
+	order  *list.List
+}
+
+// NewMemoryExporter returns an exporter that keeps at most maxTraces traces.
+func NewMemoryExporter(maxTraces int) *MemoryExporter {
+	if maxTraces <= 0 {
+		maxTraces = 100
+	}
+	return &MemoryExporter{
+		maxTraces: maxTraces,
+		traces:    make(map[string]*storedTrace),
+		order:     list.New(),
+	}
+}
+
+func (e *MemoryExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, span := range spans {
+		record := newSpanRecord(span)
+		st, ok := e.traces[record.TraceID]
+		if !ok {
+			for len(e.traces) >= e.maxTraces {
+				oldest := e.order.Remove(e.order.Front()).(*storedTrace)
+				delete(e.traces, oldest.id)
+			}
+			st = &storedTrace{id: record.TraceID}
+			st.element = e.order.PushBack(st)
+			e.traces[record.TraceID] = st
+		} else {
+			e.order.MoveToBack(st.element)
+		}
+		if len(st.spans) < maxSpansPerStoredTrace {
+			st.spans = append(st.spans, record)
+		}
+	}
+	return nil
+}
+
+func (e *MemoryExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// Traces returns the summaries of the stored traces that match the filter, newest first.
+func (e *MemoryExporter) Traces(filter TraceFilter) []TraceSummary {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	summaries := make([]TraceSummary, 0, len(e.traces))
+	for _, st := range e.traces {
+		summary := summarize(st.spans)
+		if !filter.matches(summary) {
+			continue
+		}
+		summaries = append(summaries, summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Start.After(summaries[j].Start)
+	})
+	if filter.Limit > 0 && len(summaries) > filter.Limit {
+		summaries = summaries[:filter.Limit]
+	}
+	return summaries
+}
+
+// Trace returns the spans of one trace ordered by start time.
+func (e *MemoryExporter) Trace(traceID string) ([]SpanRecord, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	st, ok := e.traces[traceID]
+	if !ok {
+		return nil, false
+	}
+	spans := make([]SpanRecord, len(st.spans))
+	copy(spans, st.spans)
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].Start.Before(spans[j].Start)
+	})
+	return spans, true
+}
+
+func (f TraceFilter) matches(summary TraceSummary) bool {
+	if f.Status != "" && f.Status != summary.Status {
+		return false
+	}
+	if f.MinDuration > 0 && summary.DurationMS < float64(f.MinDuration)/float64(time.Millisecond) {
+		return false
+	}
+	if f.Route != "" && !strings.Contains(summary.Route, f.Route) && !strings.Contains(summary.RootName, f.Route) {
+		return false
+	}
+	return true
+}
+
+// summarize builds a TraceSummary. The root is the span whose parent is not
+// part of the trace; the trace spans from the earliest start to the latest end.
+func summarize(spans []SpanRecord) TraceSummary {
+	ids := make(map[string]bool, len(spans))
+	for _, span := range spans {
+		ids[span.SpanID] = true
+	}
+
+	summary := TraceSummary{SpanCount: len(spans), Status: SPAN_STATUS_OK}
+	var end time.Time
+	var root *SpanRecord
+	for i := range spans {
+		span := &spans[i]
+		if summary.TraceID == "" {
+			summary.TraceID = span.TraceID
+		}
+		if summary.Start.IsZero() || span.Start.Before(summary.Start) {
+			summary.Start = span.Start
+		}
+		if span.End.After(end) {
+			end = span.End
+		}
+		if span.Status == SPAN_STATUS_ERROR {
+			summary.Status = SPAN_STATUS_ERROR
+		}
+		if !ids[span.ParentID] && (root == nil || span.Start.Before(root.Start)) {
+			root = span
+		}
+	}
+
+	if root != nil {
+		summary.RootName = root.Name
+		summary.Service = root.Service
+		summary.Route = spanRoute(root.Attributes)
+	}
+	summary.DurationMS = float64(end.Sub(summary.Start)) / float64(time.Millisecond)
+	return summary
+}
+
+// spanRoute returns the HTTP route or path recorded on a span.
+func spanRoute(attrs map[string]string) string {
+	for _, key := range []string{"http.route", "url.path", "http.target"} {
+		if value, ok := attrs[key]; ok {
+			route, _, _ := strings.Cut(value, "?")
+			return route
+		}
+	}
+	return ""
+}
+
+func newSpanRecord(span sdktrace.ReadOnlySpan) SpanRecord {
+	record := SpanRecord{
+		TraceID:    span.SpanContext().TraceID().String(),
+		SpanID:     span.SpanContext().SpanID().String(),
+		Name:       span.Name(),
+		Kind:       span.SpanKind().String(),
+		Start:      span.StartTime(),
+		End:        span.EndTime(),
+		DurationMS: float64(span.EndTime().Sub(span.StartTime())) / float64(time.Millisecond),
+		Status:     SPAN_STATUS_OK,
+		Attributes: attributesToMap(span.Attributes()),
+	}
+	if span.Parent().IsValid() {
+		record.ParentID = span.Parent().SpanID().String()
+	}
+	if span.Status().Code == codes.Error {
+		record.Status = SPAN_STATUS_ERROR
+		record.StatusMsg = span.Status().Description
+	}
+	if service, ok := span.Resource().Set().Value(semconv.ServiceNameKey); ok {
+		record.Service = service.AsString()
+	}
+	for _, event := range span.Events() {
+		record.Events = append(record.Events, SpanEvent{
+			Name:       event.Name,
+			Time:       event.Time,
+			Attributes: attributesToMap(event.Attributes),
+		})
+	}
+	return record
+}
+
+func attributesToMap(attrs []attribute.KeyValue) map[string]string {
+	if len(attrs) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(attrs))
+	for _, attr := range attrs {
+		m[string(attr.Key)] = attr.Value.Emit()
+	}
+	return m
+}
@@ -0,0 +1,142 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// spanAt builds an ended span of trace traceID that starts offset after testStart.
+func spanAt(traceID, spanID, parentID byte, name string, offset, duration time.Duration, failed bool, attrs ...attribute.KeyValue) sdktrace.ReadOnlySpan {
+	stub := tracetest.SpanStub{
+		Name:        name,
+		SpanContext: spanContext(traceID, spanID, false),
+		StartTime:   testStart.Add(offset),
+		EndTime:     testStart.Add(offset + duration),
+		Attributes:  attrs,
+	}
+	if parentID != 0 {
+		stub.Parent = spanContext(traceID, parentID, false)
+	}
+	if failed {
+		stub.Status = sdktrace.Status{Code: codes.Error, Description: "boom"}
+	}
+	return stub.Snapshot()
+}
+
+func traceIDOf(id byte) string {
+	return spanContext(id, 1, false).TraceID().String()
+}
+
+func TestMemoryExporterEviction(t *testing.T) {
+	exporter := NewMemoryExporter(2)
+	export := func(spans ...sdktrace.ReadOnlySpan) {
+		if err := exporter.ExportSpans(context.Background(), spans); err != nil {
+			t.Fatalf("ExportSpans() error = %v", err)
+		}
+	}
+
+	export(spanAt(1, 1, 0, "GET /a", 0, time.Millisecond, false))
+	export(spanAt(2, 1, 0, "GET /b", 0, time.Millisecond, false))
+	// A new span of trace 1 makes trace 2 the least recently updated.
+	export(spanAt(1, 2, 1, "SELECT", 0, time.Millisecond, false))
+	export(spanAt(3, 1, 0, "GET /c", 0, time.Millisecond, false))
+
+	for id, want := range map[byte]bool{1: true, 2: false, 3: true} {
+		if _, ok := exporter.Trace(traceIDOf(id)); ok != want {
+			t.Errorf("trace %d stored = %v, want %v", id, ok, want)
+		}
+	}
+	if spans, _ := exporter.Trace(traceIDOf(1)); len(spans) != 2 {
+		t.Errorf("trace 1 has %d spans, want 2", len(spans))
+	}
+}
+
+func TestMemoryExporterSpanCap(t *testing.T) {
+	exporter := NewMemoryExporter(1)
+	spans := make([]sdktrace.ReadOnlySpan, 0, maxSpansPerStoredTrace+10)
+	for i := 0; i < maxSpansPerStoredTrace+10; i++ {
+		spans = append(spans, spanAt(1, byte(i%250+1), 0, "loop", 0, time.Millisecond, false))
+	}
+	exporter.ExportSpans(context.Background(), spans)
+
+	if stored, _ := exporter.Trace(traceIDOf(1)); len(stored) != maxSpansPerStoredTrace {
+		t.Errorf("%d spans stored, want %d", len(stored), maxSpansPerStoredTrace)
+	}
+}
+
+func TestMemoryExporterTrace(t *testing.T) {
+	exporter := NewMemoryExporter(10)
+	exporter.ExportSpans(context.Background(), []sdktrace.ReadOnlySpan{
+		spanAt(1, 3, 1, "INSERT", 30*time.Millisecond, 5*time.Millisecond, true),
+		spanAt(1, 2, 1, "SELECT", 10*time.Millisecond, 5*time.Millisecond, false),
+		spanAt(1, 1, 0, "POST /apps", 0, 50*time.Millisecond, false),
+	})
+
+	spans, ok := exporter.Trace(traceIDOf(1))
+	if !ok {
+		t.Fatal("Trace() did not find the trace")
+	}
+	var names []string
+	for _, span := range spans {
+		names = append(names, span.Name)
+	}
+	if len(names) != 3 || names[0] != "POST /apps" || names[1] != "SELECT" || names[2] != "INSERT" {
+		t.Errorf("spans = %v, want them ordered by start", names)
+	}
+	if spans[2].Status != SPAN_STATUS_ERROR || spans[2].StatusMsg != "boom" || spans[2].ParentID != spans[0].SpanID {
+		t.Errorf("INSERT span = %+v, want a failed child of the root", spans[2])
+	}
+
+	if _, ok := exporter.Trace(traceIDOf(9)); ok {
+		t.Error("Trace() found an unknown trace")
+	}
+}
+
+func TestMemoryExporterTraces(t *testing.T) {
+	exporter := NewMemoryExporter(10)
+	exporter.ExportSpans(context.Background(), []sdktrace.ReadOnlySpan{
+		spanAt(1, 1, 0, "GET /apps", 0, 10*time.Millisecond, false, attribute.String("http.route", "/apps")),
+		spanAt(2, 1, 0, "POST /apps/plan", time.Second, 300*time.Millisecond, false, attribute.String("url.path", "/apps/plan?app=billing")),
+		spanAt(2, 2, 1, "UPDATE", time.Second, 100*time.Millisecond, true),
+		spanAt(3, 1, 0, "GET /health", 2*time.Second, time.Millisecond, false),
+	})
+
+	tests := []struct {
+		name   string
+		filter TraceFilter
+		want   []byte
+	}{
+		{name: "all, newest first", want: []byte{3, 2, 1}},
+		{name: "errors", filter: TraceFilter{Status: SPAN_STATUS_ERROR}, want: []byte{2}},
+		{name: "successful", filter: TraceFilter{Status: SPAN_STATUS_OK}, want: []byte{3, 1}},
+		{name: "slow", filter: TraceFilter{MinDuration: 200 * time.Millisecond}, want: []byte{2}},
+		{name: "route", filter: TraceFilter{Route: "/apps"}, want: []byte{2, 1}},
+		{name: "route by root name", filter: TraceFilter{Route: "health"}, want: []byte{3}},
+		{name: "limit", filter: TraceFilter{Limit: 1}, want: []byte{3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := exporter.Traces(tt.filter)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Traces() returned %d traces, want %d", len(got), len(tt.want))
+			}
+			for i, id := range tt.want {
+				if got[i].TraceID != traceIDOf(id) {
+					t.Errorf("trace %d = %s, want trace %d", i, got[i].RootName, id)
+				}
+			}
+		})
+	}
+
+	summary := exporter.Traces(TraceFilter{Status: SPAN_STATUS_ERROR})[0]
+	if summary.RootName != "POST /apps/plan" || summary.Route != "/apps/plan" || summary.SpanCount != 2 || summary.DurationMS != 300 {
+		t.Errorf("summary = %+v", summary)
+	}
+}
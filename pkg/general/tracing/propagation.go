@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Supported propagation formats.
+const (
+	PROPAGATOR_TRACECONTEXT = "tracecontext"
+	PROPAGATOR_BAGGAGE      = "baggage"
+	PROPAGATOR_B3           = "b3"      // single "b3" header
+	PROPAGATOR_B3_MULTI     = "b3multi" // X-B3-TraceId, X-B3-SpanId, ... headers
+	PROPAGATOR_JAEGER       = "jaeger"  // uber-trace-id header
+)
+
+// multiFormatPropagator injects the configured formats but extracts from any
+// supported one, so that traces stay connected across callers and proxies
+// that only speak B3 or Jaeger.
+type multiFormatPropagator struct {
+	inject     propagation.TextMapPropagator
+	extractors []propagation.TextMapPropagator
+	baggage    propagation.TextMapPropagator
+}
+
+// NewPropagator returns a propagator that injects the given formats and
+// extracts trace context from W3C TraceContext, B3 (single and multi header)
+// or Jaeger headers, whichever is present first in that order.
+func NewPropagator(inject ...string) (propagation.TextMapPropagator, error) {
+	if len(inject) == 0 {
+		inject = []string{PROPAGATOR_TRACECONTEXT, PROPAGATOR_BAGGAGE}
+	}
+
+	injectors := make([]propagation.TextMapPropagator, 0, len(inject))
+	for _, name := range inject {
+		switch name {
+		case PROPAGATOR_TRACECONTEXT:
+			injectors = append(injectors, propagation.TraceContext{})
+		case PROPAGATOR_BAGGAGE:
+			injectors = append(injectors, propagation.Baggage{})
+		case PROPAGATOR_B3:
+			injectors = append(injectors, b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)))
+		case PROPAGATOR_B3_MULTI:
+			injectors = append(injectors, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		case PROPAGATOR_JAEGER:
+			injectors = append(injectors, jaeger.Jaeger{})
+		default:
+			return nil, fmt.Errorf("unsupported propagator : %s", name)
+		}
+	}
+
+	return &multiFormatPropagator{
+		inject: propagation.NewCompositeTextMapPropagator(injectors...),
+		extractors: []propagation.TextMapPropagator{
+			propagation.TraceContext{},
+			// The b3 extractor understands both encodings; the inject encoding
+			// only matters here for Fields.
+			b3.New(b3.WithInjectEncoding(b3.B3SingleHeader | b3.B3MultipleHeader)),
+			jaeger.Jaeger{},
+		},
+		baggage: propagation.Baggage{},
+	}, nil
+}
+
+func (p *multiFormatPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	p.inject.Inject(ctx, carrier)
+}
+
+// Extract uses the first format that carries a valid span context. Baggage is
+// always extracted.
+func (p *multiFormatPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	ctx = p.baggage.Extract(ctx, carrier)
+	for _, extractor := range p.extractors {
+		extracted := extractor.Extract(ctx, carrier)
+		if trace.SpanContextFromContext(extracted).IsValid() {
+			return extracted
+		}
+	}
+	return ctx
+}
+
+// Fields lists every header the propagator reads or writes.
+func (p *multiFormatPropagator) Fields() []string {
+	seen := make(map[string]bool)
+	var fields []string
+	for _, propagator := range append([]propagation.TextMapPropagator{p.inject, p.baggage}, p.extractors...) {
+		for _, field := range propagator.Fields() {
+			if !seen[field] {
+				seen[field] = true
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields
+}
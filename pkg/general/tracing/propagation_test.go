@@ -0,0 +1,127 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func testSpanContext(t *testing.T, traceID, spanID string) trace.SpanContext {
+	t.Helper()
+	tid, err := trace.TraceIDFromHex(traceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sid, err := trace.SpanIDFromHex(spanID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return trace.NewSpanContext(trace.SpanContextConfig{TraceID: tid, SpanID: sid, TraceFlags: trace.FlagsSampled, Remote: true})
+}
+
+func TestPropagatorRoundTrip(t *testing.T) {
+	sc := testSpanContext(t, "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7")
+
+	tests := []struct {
+		format      string
+		wantHeader  string
+		otherHeader []string
+	}{
+		{format: PROPAGATOR_TRACECONTEXT, wantHeader: "Traceparent", otherHeader: []string{"B3", "X-B3-Traceid", "Uber-Trace-Id"}},
+		{format: PROPAGATOR_B3, wantHeader: "B3", otherHeader: []string{"Traceparent", "X-B3-Traceid", "Uber-Trace-Id"}},
+		{format: PROPAGATOR_B3_MULTI, wantHeader: "X-B3-Traceid", otherHeader: []string{"Traceparent", "B3", "Uber-Trace-Id"}},
+		{format: PROPAGATOR_JAEGER, wantHeader: "Uber-Trace-Id", otherHeader: []string{"Traceparent", "B3", "X-B3-Traceid"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			injector, err := NewPropagator(tt.format)
+			if err != nil {
+				t.Fatalf("NewPropagator() error = %v", err)
+			}
+			header := http.Header{}
+			injector.Inject(trace.ContextWithRemoteSpanContext(context.Background(), sc), propagation.HeaderCarrier(header))
+
+			if header.Get(tt.wantHeader) == "" {
+				t.Errorf("%s header not injected: %v", tt.wantHeader, header)
+			}
+			for _, name := range tt.otherHeader {
+				if header.Get(name) != "" {
+					t.Errorf("%s header injected for %s", name, tt.format)
+				}
+			}
+
+			// A service that injects W3C only still understands the other formats.
+			extractor, err := NewPropagator()
+			if err != nil {
+				t.Fatalf("NewPropagator() error = %v", err)
+			}
+			got := trace.SpanContextFromContext(extractor.Extract(context.Background(), propagation.HeaderCarrier(header)))
+			if got.TraceID() != sc.TraceID() || got.SpanID() != sc.SpanID() || !got.IsSampled() {
+				t.Errorf("extracted %s/%s sampled=%v, want %s/%s sampled", got.TraceID(), got.SpanID(), got.IsSampled(), sc.TraceID(), sc.SpanID())
+			}
+		})
+	}
+}
+
+func TestPropagatorPrefersTraceContext(t *testing.T) {
+	w3c := testSpanContext(t, "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7")
+	b3sc := testSpanContext(t, "a3ce929d0e0e47364bf92f3577b34da6", "b7ad6b7169203331")
+
+	header := http.Header{}
+	for format, sc := range map[string]trace.SpanContext{PROPAGATOR_TRACECONTEXT: w3c, PROPAGATOR_B3: b3sc} {
+		p, _ := NewPropagator(format)
+		p.Inject(trace.ContextWithRemoteSpanContext(context.Background(), sc), propagation.HeaderCarrier(header))
+	}
+
+	p, _ := NewPropagator()
+	got := trace.SpanContextFromContext(p.Extract(context.Background(), propagation.HeaderCarrier(header)))
+	if got.TraceID() != w3c.TraceID() {
+		t.Errorf("extracted trace %s, want the W3C trace %s", got.TraceID(), w3c.TraceID())
+	}
+}
+
+func TestPropagatorBaggage(t *testing.T) {
+	member, _ := baggage.NewMember("tenant", "acme")
+	bag, _ := baggage.New(member)
+	ctx := baggage.ContextWithBaggage(context.Background(), bag)
+
+	p, _ := NewPropagator()
+	header := http.Header{}
+	p.Inject(ctx, propagation.HeaderCarrier(header))
+
+	// Baggage is extracted even without a span context.
+	got := baggage.FromContext(p.Extract(context.Background(), propagation.HeaderCarrier(header)))
+	if value := got.Member("tenant").Value(); value != "acme" {
+		t.Errorf("baggage tenant = %q, want acme", value)
+	}
+}
+
+func TestNewPropagatorUnknownFormat(t *testing.T) {
+	if _, err := NewPropagator(PROPAGATOR_TRACECONTEXT, "xray"); err == nil {
+		t.Error("NewPropagator() accepted an unknown format")
+	}
+}
+
+func TestPropagatorFields(t *testing.T) {
+	p, _ := NewPropagator(PROPAGATOR_JAEGER)
+	fields := p.Fields()
+
+	for _, want := range []string{"traceparent", "baggage", "b3", "x-b3-traceid", "uber-trace-id"} {
+		if !slices.Contains(fields, want) {
+			t.Errorf("Fields() = %v, missing %s", fields, want)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, field := range fields {
+		if seen[field] {
+			t.Errorf("Fields() lists %s twice", field)
+		}
+		seen[field] = true
+	}
+}
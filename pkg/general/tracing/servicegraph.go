@@ -0,0 +1,304 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.20.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// EXTERNAL_CALLER is the caller recorded for requests that start a trace in this service.
+const EXTERNAL_CALLER = "external"
+
+// maxEdgeSamples bounds the calls kept per edge for the rate and latency figures.
+const maxEdgeSamples = 2048
+
+// ServiceGraphConfig configures how spans are turned into graph edges.
+type ServiceGraphConfig struct {
+	// Window is the period over which rates, error rates and percentiles are computed.
+	Window time.Duration
+
+	// Peers maps a client span's peer address ("host:port" or "host") to a
+	// logical service name, e.g. "localhost:8080" -> "onboarding". A peer.service
+	// attribute on the span takes precedence.
+	Peers map[string]string
+}
+
+// Edge is one caller -> callee dependency with its statistics over the window.
+type Edge struct {
+	Caller       string  `json:"caller"`
+	Callee       string  `json:"callee"`
+	Kind         string  `json:"kind"`
+	Requests     int     `json:"requests"`
+	RequestRate  float64 `json:"request_rate_per_second"`
+	ErrorRate    float64 `json:"error_rate"`
+	P95LatencyMS float64 `json:"p95_latency_ms"`
+	TotalCalls   int64   `json:"total_calls"`
+}
+
+// Graph is the service dependency graph served as JSON.
+type Graph struct {
+	WindowSeconds float64  `json:"window_seconds"`
+	Services      []string `json:"services"`
+	Edges         []Edge   `json:"edges"`
+}
+
+type edgeKey struct {
+	caller, callee, kind string
+}
+
+type edgeSample struct {
+	at       time.Time
+	duration time.Duration
+	failed   bool
+}
+
+type edgeStats struct {
+	samples []edgeSample
+	total   int64
+}
+
+// ServiceGraph is a span processor that derives caller -> callee edges from
+// client spans (HTTP calls made through otelhttp, DB calls made through sqldb)
+// and from server spans that start a trace. Each service only sees its own
+// spans, so it reports its incoming entry points and outgoing dependencies.
+type ServiceGraph struct {
+	config ServiceGraphConfig
+
+	mu    sync.Mutex
+	edges map[edgeKey]*edgeStats
+}
+
+// serviceGraph is set by InitTracer when WithServiceGraph is used.
+var serviceGraph *ServiceGraph
+
+// NewServiceGraph returns an empty graph. Register it on the tracer provider
+// with sdktrace.WithSpanProcessor.
+func NewServiceGraph(config ServiceGraphConfig) *ServiceGraph {
+	if config.Window <= 0 {
+		config.Window = time.Minute
+	}
+	return &ServiceGraph{
+		config: config,
+		edges:  make(map[edgeKey]*edgeStats),
+	}
+}
+
+// DefaultServiceGraph returns the graph installed by WithServiceGraph, or nil.
+func DefaultServiceGraph() *ServiceGraph {
+	return serviceGraph
+}
+
+func (g *ServiceGraph) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {}
+
+func (g *ServiceGraph) OnEnd(s sdktrace.ReadOnlySpan) {
+	key, ok := g.edgeFor(s)
+	if !ok {
+		return
+	}
+
+	sample := edgeSample{
+		at:       s.EndTime(),
+		duration: s.EndTime().Sub(s.StartTime()),
+		failed:   s.Status().Code == codes.Error,
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	stats, ok := g.edges[key]
+	if !ok {
+		stats = &edgeStats{}
+		g.edges[key] = stats
+	}
+	stats.total++
+	stats.samples = append(stats.samples, sample)
+	if len(stats.samples) > maxEdgeSamples {
+		stats.samples = stats.samples[len(stats.samples)-maxEdgeSamples:]
+	}
+}
+
+func (g *ServiceGraph) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (g *ServiceGraph) ForceFlush(ctx context.Context) error {
+	return nil
+}
+
+// edgeFor maps a span to an edge. Only client spans and trace entry server
+// spans describe a dependency; everything else is ignored.
+func (g *ServiceGraph) edgeFor(s sdktrace.ReadOnlySpan) (edgeKey, bool) {
+	service := "unknown"
+	if value, ok := s.Resource().Set().Value(semconv.ServiceNameKey); ok {
+		service = value.AsString()
+	}
+
+	attrs := make(map[attribute.Key]attribute.Value, len(s.Attributes()))
+	for _, attr := range s.Attributes() {
+		attrs[attr.Key] = attr.Value
+	}
+
+	switch s.SpanKind() {
+	case trace.SpanKindClient:
+		if system, ok := attrs[semconv.DBSystemKey]; ok {
+			callee := system.AsString()
+			if name, ok := attrs[semconv.DBNameKey]; ok {
+				callee = fmt.Sprintf("%s/%s", callee, name.AsString())
+			}
+			return edgeKey{caller: service, callee: callee, kind: "db"}, true
+		}
+		return edgeKey{caller: service, callee: g.peerName(attrs), kind: "http"}, true
+
+	case trace.SpanKindServer:
+		if s.Parent().IsValid() {
+			// The caller's own graph records this call as one of its client edges.
+			return edgeKey{}, false
+		}
+		return edgeKey{caller: EXTERNAL_CALLER, callee: service, kind: "http"}, true
+	}
+	return edgeKey{}, false
+}
+
+// peerName resolves the callee of an HTTP client span to a logical service name.
+func (g *ServiceGraph) peerName(attrs map[attribute.Key]attribute.Value) string {
+	if peer, ok := attrs[semconv.PeerServiceKey]; ok {
+		return peer.AsString()
+	}
+
+	host := ""
+	for _, key := range []attribute.Key{semconv.NetPeerNameKey, attribute.Key("server.address")} {
+		if value, ok := attrs[key]; ok {
+			host = value.AsString()
+			break
+		}
+	}
+	port := ""
+	for _, key := range []attribute.Key{semconv.NetPeerPortKey, attribute.Key("server.port")} {
+		if value, ok := attrs[key]; ok {
+			port = value.Emit()
+			break
+		}
+	}
+	if host == "" {
+		return "unknown"
+	}
+
+	address := host
+	if port != "" {
+		address = fmt.Sprintf("%s:%s", host, port)
+	}
+	if name, ok := g.config.Peers[address]; ok {
+		return name
+	}
+	if name, ok := g.config.Peers[host]; ok {
+		return name
+	}
+	return address
+}
+
+// Snapshot computes the graph over the configured window.
+func (g *ServiceGraph) Snapshot() Graph {
+	now := time.Now()
+	since := now.Add(-g.config.Window)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	services := make(map[string]bool)
+	graph := Graph{WindowSeconds: g.config.Window.Seconds(), Edges: []Edge{}}
+	for key, stats := range g.edges {
+		// Drop samples that fell out of the window.
+		first := sort.Search(len(stats.samples), func(i int) bool {
+			return stats.samples[i].at.After(since)
+		})
+		stats.samples = stats.samples[first:]
+
+		edge := Edge{Caller: key.caller, Callee: key.callee, Kind: key.kind, TotalCalls: stats.total}
+		if n := len(stats.samples); n > 0 {
+			durations := make([]time.Duration, n)
+			errorCount := 0
+			for i, sample := range stats.samples {
+				durations[i] = sample.duration
+				if sample.failed {
+					errorCount++
+				}
+			}
+			sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+			edge.Requests = n
+			edge.RequestRate = float64(n) / g.config.Window.Seconds()
+			edge.ErrorRate = float64(errorCount) / float64(n)
+			edge.P95LatencyMS = float64(durations[(n*95-1)/100]) / float64(time.Millisecond)
+		}
+		graph.Edges = append(graph.Edges, edge)
+		services[key.caller] = true
+		services[key.callee] = true
+	}
+
+	for service := range services {
+		graph.Services = append(graph.Services, service)
+	}
+	sort.Strings(graph.Services)
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].Caller != graph.Edges[j].Caller {
+			return graph.Edges[i].Caller < graph.Edges[j].Caller
+		}
+		return graph.Edges[i].Callee < graph.Edges[j].Callee
+	})
+	return graph
+}
+
+// DOT renders the graph in Graphviz DOT format. Edges with errors are drawn in red.
+func (graph Graph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph services {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, style=rounded];\n")
+	for _, service := range graph.Services {
+		fmt.Fprintf(&b, "  %q;\n", service)
+	}
+	for _, edge := range graph.Edges {
+		color := "black"
+		if edge.ErrorRate > 0 {
+			color = "red"
+		}
+		label := fmt.Sprintf("%.2f req/s\\nerr %.1f%%\\np95 %.1fms", edge.RequestRate, edge.ErrorRate*100, edge.P95LatencyMS)
+		fmt.Fprintf(&b, "  %q -> %q [label=\"%s\", color=%s];\n", edge.Caller, edge.Callee, label, color)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// ServiceGraphHandler serves the graph installed by WithServiceGraph as JSON,
+// or as Graphviz DOT with ?format=dot.
+func ServiceGraphHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		graph := DefaultServiceGraph()
+		if graph == nil {
+			http.Error(w, "Service graph disabled. Enable tracing.service_graph in the configuration.", http.StatusNotFound)
+			return
+		}
+
+		snapshot := graph.Snapshot()
+		if r.URL.Query().Get("format") == "dot" {
+			w.Header().Set("Content-Type", "text/vnd.graphviz")
+			w.Write([]byte(snapshot.DOT()))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+			http.Error(w, "Error formatting response", http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package tracing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.20.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// graphSpan builds a span of service that ended at end.
+func graphSpan(service string, kind trace.SpanKind, hasParent bool, end time.Time, duration time.Duration, failed bool, attrs ...attribute.KeyValue) sdktrace.ReadOnlySpan {
+	stub := tracetest.SpanStub{
+		Name:        "span",
+		SpanKind:    kind,
+		SpanContext: spanContext(1, 2, false),
+		StartTime:   end.Add(-duration),
+		EndTime:     end,
+		Attributes:  attrs,
+		Resource:    resource.NewSchemaless(semconv.ServiceName(service)),
+	}
+	if hasParent {
+		stub.Parent = spanContext(1, 1, true)
+	}
+	if failed {
+		stub.Status = sdktrace.Status{Code: codes.Error}
+	}
+	return stub.Snapshot()
+}
+
+// testGraph holds the spans of a test-service request that calls onboarding
+// twenty times and queries MySQL once.
+func testGraph() *ServiceGraph {
+	graph := NewServiceGraph(ServiceGraphConfig{Window: time.Minute, Peers: map[string]string{"localhost:8080": "onboarding"}})
+	now := time.Now()
+	onboarding := []attribute.KeyValue{semconv.NetPeerName("localhost"), semconv.NetPeerPort(8080)}
+
+	// A call that fell out of the window only counts in the total.
+	graph.OnEnd(graphSpan("test-service", trace.SpanKindClient, true, now.Add(-2*time.Minute), time.Second, true, onboarding...))
+	graph.OnEnd(graphSpan("test-service", trace.SpanKindServer, false, now, 50*time.Millisecond, false))
+	for i := 1; i <= 20; i++ {
+		graph.OnEnd(graphSpan("test-service", trace.SpanKindClient, true, now, time.Duration(i)*time.Millisecond, i <= 2, onboarding...))
+	}
+	graph.OnEnd(graphSpan("test-service", trace.SpanKindClient, true, now, time.Millisecond, false,
+		semconv.DBSystemMySQL, semconv.DBName("apps")))
+	graph.OnEnd(graphSpan("test-service", trace.SpanKindClient, true, now, time.Millisecond, false,
+		semconv.PeerService("registry"), semconv.NetPeerName("localhost"), semconv.NetPeerPort(8080)))
+
+	// Onboarding's side of a call and internal spans describe no new edge.
+	graph.OnEnd(graphSpan("onboarding", trace.SpanKindServer, true, now, time.Millisecond, false))
+	graph.OnEnd(graphSpan("test-service", trace.SpanKindInternal, true, now, time.Millisecond, false))
+	return graph
+}
+
+func TestServiceGraphEdges(t *testing.T) {
+	snapshot := testGraph().Snapshot()
+
+	want := []Edge{
+		{Caller: EXTERNAL_CALLER, Callee: "test-service", Kind: "http", Requests: 1, TotalCalls: 1},
+		{Caller: "test-service", Callee: "mysql/apps", Kind: "db", Requests: 1, TotalCalls: 1},
+		{Caller: "test-service", Callee: "onboarding", Kind: "http", Requests: 20, TotalCalls: 21, ErrorRate: 0.1, P95LatencyMS: 19},
+		{Caller: "test-service", Callee: "registry", Kind: "http", Requests: 1, TotalCalls: 1},
+	}
+	if len(snapshot.Edges) != len(want) {
+		t.Fatalf("edges = %+v, want %d edges", snapshot.Edges, len(want))
+	}
+	for i, edge := range snapshot.Edges {
+		w := want[i]
+		if edge.Caller != w.Caller || edge.Callee != w.Callee || edge.Kind != w.Kind || edge.Requests != w.Requests || edge.TotalCalls != w.TotalCalls {
+			t.Errorf("edge %d = %+v, want %+v", i, edge, w)
+		}
+		if w.P95LatencyMS != 0 && (edge.ErrorRate != w.ErrorRate || edge.P95LatencyMS != w.P95LatencyMS) {
+			t.Errorf("%s -> %s error rate %v p95 %vms, want %v and %vms", edge.Caller, edge.Callee, edge.ErrorRate, edge.P95LatencyMS, w.ErrorRate, w.P95LatencyMS)
+		}
+	}
+	if got := strings.Join(snapshot.Services, ","); got != "external,mysql/apps,onboarding,registry,test-service" {
+		t.Errorf("services = %s", got)
+	}
+}
+
+func TestServiceGraphHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	ServiceGraphHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/servicegraph", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status without a graph = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	serviceGraph = testGraph()
+	t.Cleanup(func() { serviceGraph = nil })
+
+	rec = httptest.NewRecorder()
+	ServiceGraphHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/servicegraph", nil))
+	var graph Graph
+	if err := json.Unmarshal(rec.Body.Bytes(), &graph); err != nil {
+		t.Fatalf("JSON response: %v\n%s", err, rec.Body)
+	}
+	if rec.Header().Get("Content-Type") != "application/json" || len(graph.Edges) != 4 || graph.WindowSeconds != 60 {
+		t.Errorf("JSON graph = %+v", graph)
+	}
+
+	rec = httptest.NewRecorder()
+	ServiceGraphHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/servicegraph?format=dot", nil))
+	dot := rec.Body.String()
+	if rec.Header().Get("Content-Type") != "text/vnd.graphviz" || !strings.HasPrefix(dot, "digraph services {") {
+		t.Fatalf("DOT response:\n%s", dot)
+	}
+	for _, want := range []string{
+		`"test-service" -> "onboarding" [label="0.33 req/s\nerr 10.0%\np95 19.0ms", color=red];`,
+		`"external" -> "test-service"`,
+		`"test-service" -> "mysql/apps" [label="0.02 req/s\nerr 0.0%\np95 1.0ms", color=black];`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("DOT output lacks %s:\n%s", want, dot)
+		}
+	}
+}
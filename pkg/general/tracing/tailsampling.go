@@ -0,0 +1,301 @@
+package tracing
+
+import (
+	"container/list"
+	"context"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"chaits.org/go-microservices-repo/pkg/general/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Reasons reported on the trace_sampling_* metrics.
+const (
+	SAMPLING_REASON_ERROR    = "error"
+	SAMPLING_REASON_LATENCY  = "latency"
+	SAMPLING_REASON_ROUTE    = "route"
+	SAMPLING_REASON_BASELINE = "baseline"
+	SAMPLING_REASON_NONE     = "none"
+
+	DROP_REASON_BUFFER_FULL     = "buffer_full"
+	DROP_REASON_TRACE_TOO_LARGE = "trace_too_large"
+)
+
+// TailSamplingConfig holds the rules used to keep or drop a trace once its
+// local root span has ended. A trace is kept when any rule matches.
+type TailSamplingConfig struct {
+	// LatencyThreshold keeps traces whose root span took at least this long. Zero disables the rule.
+	LatencyThreshold time.Duration
+
+	// Routes keeps traces whose root span matches one of these paths or span names.
+	Routes []string
+
+	// BaselineRatio is the fraction of the remaining traces that are kept anyway.
+	BaselineRatio float64
+
+	// MaxTraces bounds the number of traces buffered while waiting for their root span.
+	// The oldest trace is dropped when the buffer is full.
+	MaxTraces int
+
+	// MaxSpansPerTrace bounds the spans buffered for a single trace. Extra spans are dropped.
+	MaxSpansPerTrace int
+
+	// TraceTimeout decides traces whose root span has not ended in time, e.g. long
+	// running background work. The error rule is still applied to the spans seen so far.
+	TraceTimeout time.Duration
+}
+
+func defaultTailSamplingConfig() TailSamplingConfig {
+	return TailSamplingConfig{
+		LatencyThreshold: 500 * time.Millisecond,
+		BaselineRatio:    0.1,
+		MaxTraces:        10000,
+		MaxSpansPerTrace: 1000,
+		TraceTimeout:     30 * time.Second,
+	}
+}
+
+// bufferedTrace holds the spans of one trace until it is decided.
+type bufferedTrace struct {
+	id       trace.TraceID
+	spans    []sdktrace.ReadOnlySpan
+	hasError bool
+	dropped  int
+	created  time.Time
+	element  *list.Element
+}
+
+// tailSamplingProcessor buffers spans per trace and forwards the whole trace to
+// the next processor only if it is kept. Decisions are remembered for a while
+// so that spans ending after their root follow the same decision.
+type tailSamplingProcessor struct {
+	next   sdktrace.SpanProcessor
+	config TailSamplingConfig
+
+	mu        sync.Mutex
+	traces    map[trace.TraceID]*bufferedTrace
+	order     *list.List // oldest trace first
+	decisions map[trace.TraceID]bool
+	decided   *list.List // oldest decision first
+	random    *rand.Rand
+}
+
+// NewTailSamplingProcessor wraps next, typically a batch span processor, with
+// tail-based sampling. The tracer provider must record every span (always-on
+// head sampling) for the rules to see complete traces.
+func NewTailSamplingProcessor(next sdktrace.SpanProcessor, config TailSamplingConfig) sdktrace.SpanProcessor {
+	defaults := defaultTailSamplingConfig()
+	if config.MaxTraces <= 0 {
+		config.MaxTraces = defaults.MaxTraces
+	}
+	if config.MaxSpansPerTrace <= 0 {
+		config.MaxSpansPerTrace = defaults.MaxSpansPerTrace
+	}
+	if config.TraceTimeout <= 0 {
+		config.TraceTimeout = defaults.TraceTimeout
+	}
+
+	return &tailSamplingProcessor{
+		next:      next,
+		config:    config,
+		traces:    make(map[trace.TraceID]*bufferedTrace),
+		order:     list.New(),
+		decisions: make(map[trace.TraceID]bool),
+		decided:   list.New(),
+		random:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (p *tailSamplingProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+func (p *tailSamplingProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	var forward []sdktrace.ReadOnlySpan
+
+	p.mu.Lock()
+	traceID := s.SpanContext().TraceID()
+
+	if keep, ok := p.decisions[traceID]; ok {
+		// Late span of an already decided trace.
+		p.mu.Unlock()
+		if keep {
+			p.next.OnEnd(s)
+		}
+		return
+	}
+
+	bt, ok := p.traces[traceID]
+	if !ok {
+		if len(p.traces) >= p.config.MaxTraces {
+			p.evictOldest()
+		}
+		bt = &bufferedTrace{id: traceID, created: time.Now()}
+		bt.element = p.order.PushBack(bt)
+		p.traces[traceID] = bt
+	}
+
+	if s.Status().Code == codes.Error {
+		bt.hasError = true
+	}
+	if len(bt.spans) < p.config.MaxSpansPerTrace {
+		bt.spans = append(bt.spans, s)
+	} else {
+		bt.dropped++
+	}
+
+	if isLocalRoot(s) {
+		keep, reason := p.decide(bt, s)
+		forward = p.complete(bt, keep, reason)
+	}
+
+	forward = append(forward, p.expire()...)
+	metrics.UpdateTraceSamplingBufferedTraces(len(p.traces))
+	p.mu.Unlock()
+
+	for _, span := range forward {
+		p.next.OnEnd(span)
+	}
+}
+
+// decide applies the sampling rules to a trace whose root span has ended.
+func (p *tailSamplingProcessor) decide(bt *bufferedTrace, root sdktrace.ReadOnlySpan) (bool, string) {
+	if bt.hasError {
+		return true, SAMPLING_REASON_ERROR
+	}
+	if p.config.LatencyThreshold > 0 && root.EndTime().Sub(root.StartTime()) >= p.config.LatencyThreshold {
+		return true, SAMPLING_REASON_LATENCY
+	}
+	if matchesRoute(root, p.config.Routes) {
+		return true, SAMPLING_REASON_ROUTE
+	}
+	if p.config.BaselineRatio > 0 && p.random.Float64() < p.config.BaselineRatio {
+		return true, SAMPLING_REASON_BASELINE
+	}
+	return false, SAMPLING_REASON_NONE
+}
+
+// complete records the decision for a trace, removes it from the buffer and
+// returns the spans to forward. Must be called with p.mu held.
+func (p *tailSamplingProcessor) complete(bt *bufferedTrace, keep bool, reason string) []sdktrace.ReadOnlySpan {
+	p.order.Remove(bt.element)
+	delete(p.traces, bt.id)
+
+	p.decisions[bt.id] = keep
+	p.decided.PushBack(bt.id)
+	// Remember as many decisions as traces we may buffer.
+	for p.decided.Len() > p.config.MaxTraces {
+		oldest := p.decided.Remove(p.decided.Front()).(trace.TraceID)
+		delete(p.decisions, oldest)
+	}
+
+	metrics.RecordTraceSamplingDecision(keep, reason)
+	if bt.dropped > 0 {
+		metrics.RecordTraceSamplingDroppedSpans(DROP_REASON_TRACE_TOO_LARGE, bt.dropped)
+	}
+	if !keep {
+		return nil
+	}
+	return bt.spans
+}
+
+// evictOldest drops the oldest buffered trace to make room. Must be called with p.mu held.
+func (p *tailSamplingProcessor) evictOldest() {
+	front := p.order.Front()
+	if front == nil {
+		return
+	}
+	bt := p.order.Remove(front).(*bufferedTrace)
+	delete(p.traces, bt.id)
+	metrics.RecordTraceSamplingDroppedSpans(DROP_REASON_BUFFER_FULL, len(bt.spans)+bt.dropped)
+}
+
+// expire decides traces that have waited longer than TraceTimeout. Without a
+// root span only the error rule can be applied. Must be called with p.mu held.
+func (p *tailSamplingProcessor) expire() []sdktrace.ReadOnlySpan {
+	var forward []sdktrace.ReadOnlySpan
+	deadline := time.Now().Add(-p.config.TraceTimeout)
+	for front := p.order.Front(); front != nil; front = p.order.Front() {
+		bt := front.Value.(*bufferedTrace)
+		if bt.created.After(deadline) {
+			break
+		}
+		if bt.hasError {
+			forward = append(forward, p.complete(bt, true, SAMPLING_REASON_ERROR)...)
+		} else {
+			p.complete(bt, false, SAMPLING_REASON_NONE)
+		}
+	}
+	return forward
+}
+
+func (p *tailSamplingProcessor) Shutdown(ctx context.Context) error {
+	p.flushBuffered()
+	return p.next.Shutdown(ctx)
+}
+
+func (p *tailSamplingProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+// flushBuffered decides every trace still waiting so nothing with an error is
+// lost on shutdown.
+func (p *tailSamplingProcessor) flushBuffered() {
+	var forward []sdktrace.ReadOnlySpan
+
+	p.mu.Lock()
+	for front := p.order.Front(); front != nil; front = p.order.Front() {
+		bt := front.Value.(*bufferedTrace)
+		if bt.hasError {
+			forward = append(forward, p.complete(bt, true, SAMPLING_REASON_ERROR)...)
+		} else {
+			p.complete(bt, false, SAMPLING_REASON_NONE)
+		}
+	}
+	metrics.UpdateTraceSamplingBufferedTraces(0)
+	p.mu.Unlock()
+
+	for _, span := range forward {
+		p.next.OnEnd(span)
+	}
+}
+
+// isLocalRoot reports whether the span is the first span of the trace in this process.
+func isLocalRoot(s sdktrace.ReadOnlySpan) bool {
+	parent := s.Parent()
+	return !parent.IsValid() || parent.IsRemote()
+}
+
+// matchesRoute compares the root span against the configured routes using its
+// name and the usual HTTP path attributes.
+func matchesRoute(root sdktrace.ReadOnlySpan, routes []string) bool {
+	if len(routes) == 0 {
+		return false
+	}
+
+	candidates := []string{root.Name()}
+	for _, attr := range root.Attributes() {
+		switch attr.Key {
+		case attribute.Key("http.route"), attribute.Key("url.path"):
+			candidates = append(candidates, attr.Value.AsString())
+		case attribute.Key("http.target"):
+			target, _, _ := strings.Cut(attr.Value.AsString(), "?")
+			candidates = append(candidates, target)
+		}
+	}
+
+	for _, route := range routes {
+		for _, candidate := range candidates {
+			if candidate == route {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var testStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func spanContext(traceID, spanID byte, remote bool) trace.SpanContext {
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{traceID},
+		SpanID:     trace.SpanID{spanID},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     remote,
+	})
+}
+
+// testSpan builds an ended span of trace traceID. A parentID of zero makes it
+// the root of the trace.
+func testSpan(traceID, spanID, parentID byte, name string, duration time.Duration, failed bool, attrs ...attribute.KeyValue) sdktrace.ReadOnlySpan {
+	stub := tracetest.SpanStub{
+		Name:        name,
+		SpanContext: spanContext(traceID, spanID, false),
+		StartTime:   testStart,
+		EndTime:     testStart.Add(duration),
+		Attributes:  attrs,
+	}
+	if parentID != 0 {
+		stub.Parent = spanContext(traceID, parentID, false)
+	}
+	if failed {
+		stub.Status = sdktrace.Status{Code: codes.Error}
+	}
+	return stub.Snapshot()
+}
+
+func TestTailSamplingDecision(t *testing.T) {
+	config := TailSamplingConfig{LatencyThreshold: 500 * time.Millisecond, Routes: []string{"/apps/plan"}}
+	fast := 10 * time.Millisecond
+
+	tests := []struct {
+		name     string
+		config   TailSamplingConfig
+		child    sdktrace.ReadOnlySpan
+		root     sdktrace.ReadOnlySpan
+		wantKept bool
+	}{
+		{name: "fast and successful", config: config,
+			child: testSpan(1, 2, 1, "SELECT", fast, false), root: testSpan(1, 1, 0, "GET /apps", fast, false)},
+		{name: "error in a child", config: config,
+			child: testSpan(1, 2, 1, "SELECT", fast, true), root: testSpan(1, 1, 0, "GET /apps", fast, false), wantKept: true},
+		{name: "error in the root", config: config,
+			child: testSpan(1, 2, 1, "SELECT", fast, false), root: testSpan(1, 1, 0, "GET /apps", fast, true), wantKept: true},
+		{name: "slow root", config: config,
+			child: testSpan(1, 2, 1, "SELECT", fast, false), root: testSpan(1, 1, 0, "GET /apps", time.Second, false), wantKept: true},
+		{name: "slow child only", config: config,
+			child: testSpan(1, 2, 1, "SELECT", time.Second, false), root: testSpan(1, 1, 0, "GET /apps", fast, false)},
+		{name: "latency rule disabled", config: TailSamplingConfig{},
+			child: testSpan(1, 2, 1, "SELECT", fast, false), root: testSpan(1, 1, 0, "GET /apps", time.Hour, false)},
+		{name: "route by span name", config: config,
+			child: testSpan(1, 2, 1, "SELECT", fast, false), root: testSpan(1, 1, 0, "/apps/plan", fast, false), wantKept: true},
+		{name: "route by target without query", config: config,
+			child: testSpan(1, 2, 1, "SELECT", fast, false),
+			root:  testSpan(1, 1, 0, "HTTP POST", fast, false, attribute.String("http.target", "/apps/plan?dry_run=1")), wantKept: true},
+		{name: "route prefix does not match", config: config,
+			child: testSpan(1, 2, 1, "SELECT", fast, false),
+			root:  testSpan(1, 1, 0, "HTTP GET", fast, false, attribute.String("url.path", "/apps/plans"))},
+		{name: "baseline keeps all", config: TailSamplingConfig{BaselineRatio: 1},
+			child: testSpan(1, 2, 1, "SELECT", fast, false), root: testSpan(1, 1, 0, "GET /apps", fast, false), wantKept: true},
+		{name: "root with a remote parent", config: config,
+			child: testSpan(1, 2, 1, "SELECT", fast, true),
+			root: tracetest.SpanStub{Name: "GET /apps", SpanContext: spanContext(1, 1, false), Parent: spanContext(1, 9, true),
+				StartTime: testStart, EndTime: testStart.Add(fast)}.Snapshot(), wantKept: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			processor := NewTailSamplingProcessor(recorder, tt.config)
+
+			processor.OnEnd(tt.child)
+			if n := len(recorder.Ended()); n != 0 {
+				t.Fatalf("%d spans forwarded before the root ended", n)
+			}
+			processor.OnEnd(tt.root)
+
+			want := 0
+			if tt.wantKept {
+				want = 2
+			}
+			if n := len(recorder.Ended()); n != want {
+				t.Errorf("%d spans forwarded, want %d", n, want)
+			}
+		})
+	}
+}
+
+func TestTailSamplingLateSpans(t *testing.T) {
+	tests := []struct {
+		name       string
+		rootFailed bool
+		want       int
+	}{
+		{name: "kept trace", rootFailed: true, want: 2},
+		{name: "dropped trace", rootFailed: false, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			processor := NewTailSamplingProcessor(recorder, TailSamplingConfig{})
+
+			processor.OnEnd(testSpan(1, 1, 0, "GET /jobs", time.Millisecond, tt.rootFailed))
+			processor.OnEnd(testSpan(1, 2, 1, "async work", time.Second, false))
+			if n := len(recorder.Ended()); n != tt.want {
+				t.Errorf("%d spans forwarded, want %d", n, tt.want)
+			}
+		})
+	}
+}
+
+func TestTailSamplingLimits(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	processor := NewTailSamplingProcessor(recorder, TailSamplingConfig{MaxTraces: 1, MaxSpansPerTrace: 2})
+
+	// Trace 1 is evicted when trace 2 arrives, so its root finds nothing buffered.
+	processor.OnEnd(testSpan(1, 2, 1, "SELECT", time.Millisecond, true))
+	processor.OnEnd(testSpan(2, 2, 1, "SELECT", time.Millisecond, true))
+	processor.OnEnd(testSpan(2, 3, 1, "SELECT", time.Millisecond, false))
+	processor.OnEnd(testSpan(2, 4, 1, "SELECT", time.Millisecond, false))
+	processor.OnEnd(testSpan(2, 1, 0, "GET /apps", time.Millisecond, false))
+
+	ended := recorder.Ended()
+	if len(ended) != 2 {
+		t.Fatalf("%d spans forwarded, want the 2 buffered spans of trace 2", len(ended))
+	}
+	for _, span := range ended {
+		if span.SpanContext().TraceID() != (trace.TraceID{2}) {
+			t.Errorf("span of trace %s forwarded, want only trace 2", span.SpanContext().TraceID())
+		}
+	}
+}
+
+func TestTailSamplingShutdownKeepsErrors(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	processor := NewTailSamplingProcessor(recorder, TailSamplingConfig{})
+
+	processor.OnEnd(testSpan(1, 2, 1, "SELECT", time.Millisecond, true))
+	processor.OnEnd(testSpan(2, 2, 1, "SELECT", time.Millisecond, false))
+	if err := processor.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	ended := recorder.Ended()
+	if len(ended) != 1 || ended[0].SpanContext().TraceID() != (trace.TraceID{1}) {
+		t.Errorf("forwarded %d spans on shutdown, want the failed span of trace 1", len(ended))
+	}
+}
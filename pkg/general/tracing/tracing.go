@@ -2,57 +2,102 @@ package tracing
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"log"
+	"os"
+	"runtime/debug"
 	"time"
 
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
-	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.20.0"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc/credentials"
 )
 
-func InitTracer(ctx context.Context, serviceName string) func() error {
+// InitTracer configures the global tracer provider and propagators. Tracing is
+// never fatal: if the exporter cannot be built the service keeps running with a
+// noop tracer provider.
+func InitTracer(ctx context.Context, serviceName string, opts ...Option) func() error {
+	cfg := defaultConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
 
-	// Create an OTLP trace exporter
-	exporter, err := otlptracegrpc.New(ctx,
-		otlptracegrpc.WithInsecure(),
-		otlptracegrpc.WithEndpoint(GRPC_COLLECTOR_ENDPOINT))
+	// Set the propagator. This is crucial for distributed tracing
+	// to pass context between services via HTTP headers.
+	propagator, err := NewPropagator(cfg.Propagators...)
+	if err != nil {
+		log.Printf("invalid propagators %v, using tracecontext and baggage: %v", cfg.Propagators, err)
+		propagator, _ = NewPropagator()
+	}
+	otel.SetTextMapPropagator(propagator)
 
+	exporter, err := newExporter(ctx, cfg)
 	if err != nil {
-		log.Fatalf("failed to create OTLP trace exporter: %v", err)
+		log.Printf("failed to create %s trace exporter: %v", cfg.Exporter, err)
+		exporter = nil
+	}
+	if exporter == nil && cfg.DebugMaxTraces <= 0 && cfg.ServiceGraph == nil {
+		log.Println("Tracing disabled, using noop tracer.")
+		return useNoopTracer()
 	}
 
-	// Create a resource with service name and instance ID
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName(serviceName),
-			attribute.String("service.version", "1.0.0"),
-		),
-	)
+	// Create a resource describing this service instance.
+	res, err := newResource(ctx, serviceName, cfg)
 	if err != nil {
-		log.Fatalf("failed to create resource: %v", err)
+		// resource.New returns the attributes it could detect alongside the error.
+		log.Printf("failed to detect some resource attributes: %v", err)
 	}
 
-	// Create a new trace provider with the exporter
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter, sdktrace.WithBatchTimeout(time.Second*5)),
+	sampler := sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))
+	if cfg.TailSampling != nil {
+		// The tail sampler needs to see every span to make its decision.
+		sampler = sdktrace.AlwaysSample()
+	}
+	tpOpts := []sdktrace.TracerProviderOption{
 		sdktrace.WithResource(res),
-	)
+		sdktrace.WithSampler(sampler),
+	}
+
+	if exporter != nil {
+		var processor sdktrace.SpanProcessor = sdktrace.NewBatchSpanProcessor(exporter, sdktrace.WithBatchTimeout(time.Second*5))
+		if cfg.TailSampling != nil {
+			processor = NewTailSamplingProcessor(processor, *cfg.TailSampling)
+		}
+		tpOpts = append(tpOpts, sdktrace.WithSpanProcessor(processor))
+	}
+
+	// The local trace viewer sees every recorded span, before tail sampling.
+	if cfg.DebugMaxTraces > 0 {
+		debugExporter = NewMemoryExporter(cfg.DebugMaxTraces)
+		tpOpts = append(tpOpts, sdktrace.WithSpanProcessor(sdktrace.NewSimpleSpanProcessor(debugExporter)))
+		log.Printf("Trace viewer enabled at /debug/traces, keeping the last %d traces.", cfg.DebugMaxTraces)
+	}
+
+	if cfg.ServiceGraph != nil {
+		serviceGraph = NewServiceGraph(*cfg.ServiceGraph)
+		tpOpts = append(tpOpts, sdktrace.WithSpanProcessor(serviceGraph))
+		log.Println("Service graph enabled at /debug/servicegraph.")
+	}
+
+	// Create a new trace provider with the exporters
+	tp := sdktrace.NewTracerProvider(tpOpts...)
 
 	// Register the global trace provider
 	otel.SetTracerProvider(tp)
 
-	// Set the propagator. This is crucial for distributed tracing
-	// to pass context between services via HTTP headers.
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
-		propagation.TraceContext{},
-		propagation.Baggage{},
-	))
-
-	log.Println("OpenTelemetry tracer initialized.")
+	if cfg.TailSampling != nil {
+		log.Printf("OpenTelemetry tracer initialized. Exporter: %s, Tail Sampling: enabled", cfg.Exporter)
+	} else {
+		log.Printf("OpenTelemetry tracer initialized. Exporter: %s, Sample Ratio: %v", cfg.Exporter, cfg.SampleRatio)
+	}
 
 	// The shutdown function ensures all spans are flushed before the application exits.
 	shutdown := func() error {
@@ -61,3 +106,148 @@ func InitTracer(ctx context.Context, serviceName string) func() error {
 
 	return shutdown
 }
+
+func useNoopTracer() func() error {
+	otel.SetTracerProvider(noop.NewTracerProvider())
+	return func() error { return nil }
+}
+
+// newExporter builds the span exporter selected by cfg.Exporter.
+// It returns a nil exporter when tracing is disabled.
+func newExporter(ctx context.Context, cfg *Config) (sdktrace.SpanExporter, error) {
+	switch cfg.Exporter {
+	case EXPORTER_OTLP_GRPC:
+		endpoint := cfg.Endpoint
+		if endpoint == "" {
+			endpoint = GRPC_COLLECTOR_ENDPOINT
+		}
+		grpcOpts := []otlptracegrpc.Option{
+			otlptracegrpc.WithEndpoint(endpoint),
+			otlptracegrpc.WithHeaders(cfg.Headers),
+		}
+		if cfg.Insecure {
+			grpcOpts = append(grpcOpts, otlptracegrpc.WithInsecure())
+		} else {
+			tlsConfig, err := newTLSConfig(cfg)
+			if err != nil {
+				return nil, err
+			}
+			grpcOpts = append(grpcOpts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+		}
+		return otlptracegrpc.New(ctx, grpcOpts...)
+
+	case EXPORTER_OTLP_HTTP:
+		endpoint := cfg.Endpoint
+		if endpoint == "" {
+			endpoint = HTTP_COLLECTOR_ENDPOINT
+		}
+		httpOpts := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(endpoint),
+			otlptracehttp.WithHeaders(cfg.Headers),
+		}
+		if cfg.Insecure {
+			httpOpts = append(httpOpts, otlptracehttp.WithInsecure())
+		} else {
+			tlsConfig, err := newTLSConfig(cfg)
+			if err != nil {
+				return nil, err
+			}
+			httpOpts = append(httpOpts, otlptracehttp.WithTLSClientConfig(tlsConfig))
+		}
+		return otlptracehttp.New(ctx, httpOpts...)
+
+	case EXPORTER_STDOUT:
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+
+	case EXPORTER_NONE:
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported trace exporter : %s", cfg.Exporter)
+	}
+}
+
+// newTLSConfig builds the collector TLS configuration from the PEM files in cfg.
+// Without a CA file the system roots are used.
+func newTLSConfig(cfg *Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName: cfg.TLSServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if cfg.TLSCAFile != "" {
+		caPEM, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file. Error: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in CA file : %s", cfg.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate. Error: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// newResource describes the service instance: name, version, environment and host.
+func newResource(ctx context.Context, serviceName string, cfg *Config) (*resource.Resource, error) {
+	version := cfg.Version
+	if version == "" {
+		version = buildVersion()
+	}
+
+	attrs := []resource.Option{
+		resource.WithAttributes(
+			semconv.ServiceName(serviceName),
+			semconv.ServiceVersion(version),
+		),
+		resource.WithHost(),
+		resource.WithProcessRuntimeVersion(),
+	}
+	if cfg.Environment != "" {
+		attrs = append(attrs, resource.WithAttributes(semconv.DeploymentEnvironment(cfg.Environment)))
+	}
+
+	return resource.New(ctx, attrs...)
+}
+
+// buildVersion returns the main module version, or the VCS revision for
+// development builds where the module version is "(devel)".
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+
+	revision, modified := "", false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "unknown"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return revision
+}
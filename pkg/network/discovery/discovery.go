@@ -0,0 +1,251 @@
+package discovery
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Instance is one running copy of a service.
+type Instance struct {
+	ID       string            `json:"id"`
+	Service  string            `json:"service"`
+	Address  string            `json:"address"`
+	Weight   int               `json:"weight,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Resolver looks up the instances of a service.
+type Resolver interface {
+	Resolve(ctx context.Context, service string) ([]Instance, error)
+}
+
+// ResolverFunc adapts a function to the Resolver interface.
+type ResolverFunc func(ctx context.Context, service string) ([]Instance, error)
+
+func (f ResolverFunc) Resolve(ctx context.Context, service string) ([]Instance, error) {
+	return f(ctx, service)
+}
+
+// Discovery caches the answers of a Resolver and notifies subscribers when
+// the instances of a service change.
+type Discovery struct {
+	resolver        Resolver
+	cacheTTL        time.Duration
+	refreshInterval time.Duration
+	resolveTimeout  time.Duration
+
+	mu       sync.Mutex
+	cache    map[string]cacheEntry
+	watchers map[string]*watcher
+	nextID   int
+	closed   bool
+}
+
+type cacheEntry struct {
+	instances []Instance
+	fetched   time.Time
+}
+
+// watcher polls one service for all of its subscribers.
+type watcher struct {
+	service     string
+	subscribers map[int]func([]Instance)
+	last        []Instance
+	// ready is closed once the first resolve has set last.
+	ready chan struct{}
+	stop  chan struct{}
+}
+
+type Option func(*Discovery)
+
+// WithCacheTTL sets how long a resolved answer is served from the cache. Defaults to 10 seconds.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(d *Discovery) {
+		d.cacheTTL = ttl
+	}
+}
+
+// WithRefreshInterval sets how often subscribed services are resolved again. Defaults to 10 seconds.
+func WithRefreshInterval(interval time.Duration) Option {
+	return func(d *Discovery) {
+		d.refreshInterval = interval
+	}
+}
+
+// WithResolveTimeout bounds each call to the resolver. Defaults to 5 seconds.
+func WithResolveTimeout(timeout time.Duration) Option {
+	return func(d *Discovery) {
+		d.resolveTimeout = timeout
+	}
+}
+
+// NewDiscovery returns a caching front for resolver. Call Close to stop the
+// background refreshes of subscribed services.
+func NewDiscovery(resolver Resolver, opts ...Option) *Discovery {
+	d := &Discovery{
+		resolver:        resolver,
+		cacheTTL:        10 * time.Second,
+		refreshInterval: 10 * time.Second,
+		resolveTimeout:  5 * time.Second,
+		cache:           make(map[string]cacheEntry),
+		watchers:        make(map[string]*watcher),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Resolve returns the instances of service. Answers are cached for the cache
+// TTL; when the resolver fails, the last known answer is returned instead.
+func (d *Discovery) Resolve(ctx context.Context, service string) ([]Instance, error) {
+	d.mu.Lock()
+	entry, ok := d.cache[service]
+	d.mu.Unlock()
+	if ok && time.Since(entry.fetched) < d.cacheTTL {
+		return entry.instances, nil
+	}
+
+	instances, err := d.refresh(ctx, service)
+	if err != nil && ok {
+		log.Printf("Resolving %s failed, using cached instances: %v", service, err)
+		return entry.instances, nil
+	}
+	return instances, err
+}
+
+// refresh asks the resolver and updates the cache.
+func (d *Discovery) refresh(ctx context.Context, service string) ([]Instance, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.resolveTimeout)
+	defer cancel()
+
+	instances, err := d.resolver.Resolve(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	sortInstances(instances)
+
+	d.mu.Lock()
+	d.cache[service] = cacheEntry{instances: instances, fetched: time.Now()}
+	d.mu.Unlock()
+	return instances, nil
+}
+
+// Subscribe calls fn with the current instances of service and again whenever
+// they change. The returned function cancels the subscription.
+func (d *Discovery) Subscribe(service string, fn func([]Instance)) func() {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return func() {}
+	}
+	w, ok := d.watchers[service]
+	if !ok {
+		w = &watcher{service: service, subscribers: make(map[int]func([]Instance)), ready: make(chan struct{}), stop: make(chan struct{})}
+		d.watchers[service] = w
+	}
+	d.nextID++
+	id := d.nextID
+	w.subscribers[id] = fn
+	d.mu.Unlock()
+
+	if !ok {
+		// Resolve once up front so the subscriber starts with the instances.
+		instances, err := d.Resolve(context.Background(), service)
+		if err != nil {
+			log.Printf("Resolving %s failed: %v", service, err)
+		} else {
+			d.mu.Lock()
+			w.last = instances
+			d.mu.Unlock()
+		}
+		close(w.ready)
+		go d.watch(w)
+	}
+
+	// Later subscribers wait for the first resolve instead of seeing no instances.
+	<-w.ready
+	d.mu.Lock()
+	last := w.last
+	d.mu.Unlock()
+	if last != nil {
+		fn(last)
+	}
+
+	return func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		delete(w.subscribers, id)
+		if len(w.subscribers) == 0 && d.watchers[service] == w {
+			delete(d.watchers, service)
+			close(w.stop)
+		}
+	}
+}
+
+// watch refreshes a subscribed service and notifies the subscribers of changes.
+func (d *Discovery) watch(w *watcher) {
+	ticker := time.NewTicker(d.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+
+		instances, err := d.refresh(context.Background(), w.service)
+		if err != nil {
+			log.Printf("Resolving %s failed: %v", w.service, err)
+		} else {
+			d.mu.Lock()
+			changed := !equalInstances(w.last, instances)
+			if changed {
+				w.last = instances
+			}
+			subscribers := make([]func([]Instance), 0, len(w.subscribers))
+			for _, fn := range w.subscribers {
+				subscribers = append(subscribers, fn)
+			}
+			d.mu.Unlock()
+
+			if changed {
+				for _, fn := range subscribers {
+					fn(instances)
+				}
+			}
+		}
+	}
+}
+
+// Close stops all subscriptions.
+func (d *Discovery) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+	for service, w := range d.watchers {
+		close(w.stop)
+		delete(d.watchers, service)
+	}
+}
+
+func sortInstances(instances []Instance) {
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Address < instances[j].Address
+	})
+}
+
+func equalInstances(a, b []Instance) bool {
+	if a == nil || len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Address != b[i].Address || a[i].Weight != b[i].Weight {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package discovery
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSubscribeDuringFirstResolve(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	d := NewDiscovery(ResolverFunc(func(ctx context.Context, service string) ([]Instance, error) {
+		close(started)
+		<-release
+		return []Instance{{ID: "billing-1", Service: service, Address: "10.0.0.1:8080"}}, nil
+	}), WithRefreshInterval(time.Hour))
+	defer d.Close()
+
+	got := make(chan []Instance, 2)
+	go d.Subscribe("billing", func(instances []Instance) { got <- instances })
+	<-started
+	// The second subscriber arrives while the first resolve is still running.
+	second := make(chan func())
+	go func() { second <- d.Subscribe("billing", func(instances []Instance) { got <- instances }) }()
+	select {
+	case <-second:
+		t.Fatal("Subscribe() returned before the first resolve finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		select {
+		case instances := <-got:
+			if len(instances) != 1 || instances[0].Address != "10.0.0.1:8080" {
+				t.Errorf("subscriber %d got %+v", i+1, instances)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("subscriber %d was not called with the instances", i+1)
+		}
+	}
+	(<-second)()
+}
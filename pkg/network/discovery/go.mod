@@ -0,0 +1,3 @@
+module chaits.org/go-microservices-repo/pkg/network/discovery
+
+go 1.24.5
@@ -0,0 +1,149 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Registrar keeps one instance registered with the registry service by
+// sending heartbeats, and registers again if the registry forgot it.
+type Registrar struct {
+	url      string
+	token    string
+	instance Instance
+	ttl      time.Duration
+	client   *http.Client
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewInstanceID returns a unique ID such as "onboarding-localhost-8080-1a2b3c4d".
+func NewInstanceID(service, address string) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%s-%s", service, strings.NewReplacer(":", "-", ".", "-").Replace(address), hex.EncodeToString(suffix))
+}
+
+// Register registers instance with the registry at registryURL, authenticated
+// with token, and starts sending heartbeats every third of ttl. The
+// registration is retried in the background if the registry is not reachable
+// yet. Call Deregister on shutdown.
+func Register(registryURL, token string, instance Instance, ttl time.Duration) *Registrar {
+	if ttl <= 0 {
+		ttl = DEFAULT_INSTANCE_TTL
+	}
+	if instance.ID == "" {
+		instance.ID = NewInstanceID(instance.Service, instance.Address)
+	}
+	r := &Registrar{
+		url:      strings.TrimSuffix(registryURL, "/"),
+		token:    token,
+		instance: instance,
+		ttl:      ttl,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+func (r *Registrar) run() {
+	defer close(r.done)
+	registered := r.register() == nil
+	ticker := time.NewTicker(r.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+
+		if registered {
+			found, err := r.heartbeat()
+			if err != nil {
+				log.Printf("Heartbeat for %s failed: %v", r.instance.ID, err)
+				continue
+			}
+			registered = found
+		}
+		if !registered {
+			registered = r.register() == nil
+		}
+	}
+}
+
+func (r *Registrar) register() error {
+	body, err := json.Marshal(Registration{Instance: r.instance, TTLSeconds: int(r.ttl / time.Second)})
+	if err != nil {
+		return err
+	}
+	err = r.send(http.MethodPut, "/v1/instances", body, http.StatusNoContent)
+	if err != nil {
+		log.Printf("Registering %s with %s failed: %v", r.instance.ID, r.url, err)
+		return err
+	}
+	log.Printf("Registered %s as %s at %s", r.instance.Service, r.instance.ID, r.instance.Address)
+	return nil
+}
+
+// heartbeat reports false when the registry no longer knows the instance.
+func (r *Registrar) heartbeat() (bool, error) {
+	err := r.send(http.MethodPut, "/v1/instances/"+url.PathEscape(r.instance.ID)+"/heartbeat", nil, http.StatusNoContent)
+	if err == errNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+var errNotFound = fmt.Errorf("not found")
+
+func (r *Registrar) send(method, path string, body []byte, want int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, r.url+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case want:
+		return nil
+	case http.StatusNotFound:
+		return errNotFound
+	default:
+		return fmt.Errorf("registry returned %d", resp.StatusCode)
+	}
+}
+
+// Deregister stops the heartbeats and removes the instance from the registry.
+func (r *Registrar) Deregister() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+		<-r.done
+		if err := r.send(http.MethodDelete, "/v1/instances/"+url.PathEscape(r.instance.ID), nil, http.StatusNoContent); err != nil {
+			log.Printf("Deregistering %s failed: %v", r.instance.ID, err)
+		}
+	})
+}
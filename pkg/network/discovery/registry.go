@@ -0,0 +1,241 @@
+package discovery
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DEFAULT_INSTANCE_TTL is how long an instance stays registered without a heartbeat.
+const DEFAULT_INSTANCE_TTL = 30 * time.Second
+
+// DEFAULT_EXPIRY_INTERVAL is how often a Registry drops instances whose TTL passed.
+const DEFAULT_EXPIRY_INTERVAL = 5 * time.Second
+
+// Registration is the body of a register request.
+type Registration struct {
+	Instance
+	// TTLSeconds is how long the instance stays registered without a heartbeat.
+	TTLSeconds int `json:"ttl_seconds,omitempty"`
+}
+
+type registeredInstance struct {
+	Instance
+	ttl      time.Duration
+	lastSeen time.Time
+}
+
+// Registry is an in-memory service registry. Instances register on start,
+// send heartbeats and are dropped once their TTL passes without one.
+type Registry struct {
+	token          string
+	expiryInterval time.Duration
+
+	mu        sync.Mutex
+	instances map[string]*registeredInstance
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+type RegistryOption func(*Registry)
+
+// WithRegistryToken requires the requests that change the registry to carry
+// "Authorization: Bearer <token>". Reads stay open to the resolvers.
+func WithRegistryToken(token string) RegistryOption {
+	return func(r *Registry) {
+		r.token = token
+	}
+}
+
+// WithExpiryInterval sets how often instances whose TTL passed are dropped.
+// Defaults to DEFAULT_EXPIRY_INTERVAL.
+func WithExpiryInterval(interval time.Duration) RegistryOption {
+	return func(r *Registry) {
+		r.expiryInterval = interval
+	}
+}
+
+// NewRegistry returns a registry that drops expired instances in the
+// background until Close is called.
+func NewRegistry(opts ...RegistryOption) *Registry {
+	r := &Registry{
+		expiryInterval: DEFAULT_EXPIRY_INTERVAL,
+		instances:      make(map[string]*registeredInstance),
+		stop:           make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	go r.expireLoop()
+	return r
+}
+
+// Close stops the background expiry.
+func (r *Registry) Close() {
+	r.closeOnce.Do(func() { close(r.stop) })
+}
+
+func (r *Registry) expireLoop() {
+	ticker := time.NewTicker(r.expiryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.mu.Lock()
+			r.expire()
+			r.mu.Unlock()
+		}
+	}
+}
+
+// Register adds or replaces an instance.
+func (r *Registry) Register(instance Instance, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = DEFAULT_INSTANCE_TTL
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.instances[instance.ID]; !ok {
+		log.Printf("Registered %s instance %s at %s", instance.Service, instance.ID, instance.Address)
+	}
+	r.instances[instance.ID] = &registeredInstance{Instance: instance, ttl: ttl, lastSeen: time.Now()}
+}
+
+// Heartbeat renews an instance. It returns false if the instance is unknown,
+// e.g. because it expired or the registry restarted, so it must register again.
+func (r *Registry) Heartbeat(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	instance, ok := r.instances[id]
+	if ok {
+		instance.lastSeen = time.Now()
+	}
+	return ok
+}
+
+// Deregister removes an instance.
+func (r *Registry) Deregister(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if instance, ok := r.instances[id]; ok {
+		log.Printf("Deregistered %s instance %s", instance.Service, id)
+		delete(r.instances, id)
+	}
+}
+
+// Instances returns the live instances of service.
+func (r *Registry) Instances(service string) []Instance {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire()
+	instances := []Instance{}
+	for _, instance := range r.instances {
+		if instance.Service == service {
+			instances = append(instances, instance.Instance)
+		}
+	}
+	sortInstances(instances)
+	return instances
+}
+
+// Services returns the names of the services with live instances.
+func (r *Registry) Services() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire()
+	seen := make(map[string]bool)
+	services := []string{}
+	for _, instance := range r.instances {
+		if !seen[instance.Service] {
+			seen[instance.Service] = true
+			services = append(services, instance.Service)
+		}
+	}
+	sort.Strings(services)
+	return services
+}
+
+// expire drops instances whose TTL has passed. Must be called with r.mu held.
+func (r *Registry) expire() {
+	now := time.Now()
+	for id, instance := range r.instances {
+		if now.Sub(instance.lastSeen) > instance.ttl {
+			log.Printf("Expired %s instance %s after missing heartbeats", instance.Service, id)
+			delete(r.instances, id)
+		}
+	}
+}
+
+// Handler serves the registry API:
+//
+//	PUT    /v1/instances                 register (Registration body)
+//	PUT    /v1/instances/{id}/heartbeat  renew, 404 if unknown
+//	DELETE /v1/instances/{id}            deregister
+//	GET    /v1/services                  service names
+//	GET    /v1/services/{service}        live instances of a service
+//
+// With WithRegistryToken, the PUT and DELETE requests without the token get 401.
+func (r *Registry) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /v1/instances", r.authorized(func(w http.ResponseWriter, req *http.Request) {
+		var registration Registration
+		if err := json.NewDecoder(req.Body).Decode(&registration); err != nil {
+			http.Error(w, "Error with request body", http.StatusBadRequest)
+			return
+		}
+		if registration.ID == "" || registration.Service == "" || registration.Address == "" {
+			http.Error(w, "Bad request: id, service and address are required", http.StatusBadRequest)
+			return
+		}
+		r.Register(registration.Instance, time.Duration(registration.TTLSeconds)*time.Second)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.HandleFunc("PUT /v1/instances/{id}/heartbeat", r.authorized(func(w http.ResponseWriter, req *http.Request) {
+		if !r.Heartbeat(req.PathValue("id")) {
+			http.Error(w, "Instance not registered", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.HandleFunc("DELETE /v1/instances/{id}", r.authorized(func(w http.ResponseWriter, req *http.Request) {
+		r.Deregister(req.PathValue("id"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.HandleFunc("GET /v1/services", func(w http.ResponseWriter, req *http.Request) {
+		writeJSON(w, r.Services())
+	})
+	mux.HandleFunc("GET /v1/services/{service}", func(w http.ResponseWriter, req *http.Request) {
+		writeJSON(w, r.Instances(req.PathValue("service")))
+	})
+	return mux
+}
+
+// authorized rejects requests without the registry token, if there is one.
+func (r *Registry) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if r.token != "" {
+			token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(r.token)) != 1 {
+				log.Printf("Rejected %s %s without a valid registry token", req.Method, req.URL.Path)
+				http.Error(w, "Unauthorized: Invalid Registry Token", http.StatusUnauthorized)
+				return
+			}
+		}
+		next(w, req)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		http.Error(w, "Error formatting response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,116 @@
+package discovery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistryHandlerToken(t *testing.T) {
+	const registration = `{"id":"billing-1","service":"billing","address":"10.0.0.1:8080"}`
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		body          string
+		authorization string
+		wantStatus    int
+	}{
+		{name: "register", method: http.MethodPut, path: "/v1/instances", body: registration, authorization: "Bearer s3cret", wantStatus: http.StatusNoContent},
+		{name: "register without token", method: http.MethodPut, path: "/v1/instances", body: registration, wantStatus: http.StatusUnauthorized},
+		{name: "register with wrong token", method: http.MethodPut, path: "/v1/instances", body: registration, authorization: "Bearer guess", wantStatus: http.StatusUnauthorized},
+		{name: "register with other scheme", method: http.MethodPut, path: "/v1/instances", body: registration, authorization: "Basic s3cret", wantStatus: http.StatusUnauthorized},
+		{name: "register without address", method: http.MethodPut, path: "/v1/instances", body: `{"id":"billing-1","service":"billing"}`, authorization: "Bearer s3cret", wantStatus: http.StatusBadRequest},
+		{name: "heartbeat of unknown instance", method: http.MethodPut, path: "/v1/instances/billing-2/heartbeat", authorization: "Bearer s3cret", wantStatus: http.StatusNotFound},
+		{name: "heartbeat without token", method: http.MethodPut, path: "/v1/instances/billing-1/heartbeat", wantStatus: http.StatusUnauthorized},
+		{name: "deregister without token", method: http.MethodDelete, path: "/v1/instances/billing-1", wantStatus: http.StatusUnauthorized},
+		{name: "deregister", method: http.MethodDelete, path: "/v1/instances/billing-1", authorization: "Bearer s3cret", wantStatus: http.StatusNoContent},
+		{name: "reads need no token", method: http.MethodGet, path: "/v1/services/billing", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewRegistry(WithRegistryToken("s3cret"))
+			defer registry.Close()
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			registry.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusUnauthorized && len(registry.Instances("billing")) != 0 {
+				t.Errorf("rejected request changed the registry")
+			}
+		})
+	}
+}
+
+func TestRegistryExpiry(t *testing.T) {
+	registry := NewRegistry(WithExpiryInterval(5 * time.Millisecond))
+	defer registry.Close()
+
+	registry.Register(Instance{ID: "billing-1", Service: "billing", Address: "10.0.0.1:8080"}, 20*time.Millisecond)
+	registry.Register(Instance{ID: "billing-2", Service: "billing", Address: "10.0.0.2:8080"}, time.Hour)
+	if got := len(registry.Instances("billing")); got != 2 {
+		t.Fatalf("%d instances registered, want 2", got)
+	}
+
+	// The instance is dropped in the background, without anyone reading the registry.
+	time.Sleep(100 * time.Millisecond)
+	registry.mu.Lock()
+	_, expired := registry.instances["billing-1"]
+	_, live := registry.instances["billing-2"]
+	registry.mu.Unlock()
+	if expired || !live {
+		t.Errorf("after the TTL: billing-1 registered = %v, billing-2 registered = %v, want false and true", expired, live)
+	}
+	if registry.Heartbeat("billing-1") {
+		t.Errorf("Heartbeat() of an expired instance = true, want false so it registers again")
+	}
+}
+
+func TestRegistrar(t *testing.T) {
+	tests := []struct {
+		name           string
+		token          string
+		wantRegistered bool
+	}{
+		{name: "with the registry token", token: "s3cret", wantRegistered: true},
+		{name: "with a wrong token", token: "guess", wantRegistered: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewRegistry(WithRegistryToken("s3cret"))
+			defer registry.Close()
+			server := httptest.NewServer(registry.Handler())
+			defer server.Close()
+			resolver := NewRegistryResolver(server.URL)
+
+			registrar := Register(server.URL, tt.token, Instance{Service: "billing", Address: "10.0.0.1:8080"}, 3*time.Second)
+			registered := false
+			for deadline := time.Now().Add(time.Second); time.Now().Before(deadline) && !registered; time.Sleep(10 * time.Millisecond) {
+				instances, err := resolver.Resolve(context.Background(), "billing")
+				if err != nil {
+					t.Fatalf("Resolve() error = %v", err)
+				}
+				registered = len(instances) == 1
+			}
+			if registered != tt.wantRegistered {
+				t.Fatalf("registered = %v, want %v", registered, tt.wantRegistered)
+			}
+
+			registrar.Deregister()
+			if instances, _ := resolver.Resolve(context.Background(), "billing"); len(instances) != 0 {
+				t.Errorf("Resolve() after Deregister() = %v, want no instances", instances)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"chaits.org/go-microservices-repo/pkg/errors"
+	"chaits.org/go-microservices-repo/pkg/general/config"
+)
+
+// Resolver names accepted by NewResolverFromConfig.
+const (
+	RESOLVER_CONFIG   = "config"
+	RESOLVER_DNS      = "dns"
+	RESOLVER_REGISTRY = "registry"
+)
+
+// StaticResolver answers from a fixed map of service name to addresses.
+type StaticResolver map[string][]string
+
+func (s StaticResolver) Resolve(ctx context.Context, service string) ([]Instance, error) {
+	addresses, ok := s[service]
+	if !ok {
+		return nil, errors.New(errors.SERVICE_NOT_FOUND_ERROR, fmt.Sprintf("service %s is not configured", service))
+	}
+	return addressInstances(service, addresses, nil), nil
+}
+
+// ConfigResolver reads services.<service>.endpoints and the optional
+// services.<service>.weights from the configuration files.
+type ConfigResolver struct {
+	appConfig *config.AppConfig
+}
+
+func NewConfigResolver(appConfig *config.AppConfig) *ConfigResolver {
+	return &ConfigResolver{appConfig: appConfig}
+}
+
+func (c *ConfigResolver) Resolve(ctx context.Context, service string) ([]Instance, error) {
+	prefix := "services." + service + "."
+	if !c.appConfig.IsSet(prefix + "endpoints") {
+		return nil, errors.New(errors.SERVICE_NOT_FOUND_ERROR, fmt.Sprintf("no endpoints configured for service %s", service))
+	}
+	weights := c.appConfig.GetStringMapString(prefix + "weights")
+	return addressInstances(service, c.appConfig.GetStringSlice(prefix+"endpoints"), weights), nil
+}
+
+func addressInstances(service string, addresses []string, weights map[string]string) []Instance {
+	instances := make([]Instance, 0, len(addresses))
+	for _, address := range addresses {
+		weight, _ := strconv.Atoi(weights[address])
+		instances = append(instances, Instance{ID: address, Service: service, Address: address, Weight: weight})
+	}
+	return instances
+}
+
+// DNSResolver looks up SRV records first and falls back to A/AAAA records.
+// For service "onboarding" with suffix ".svc.local" it queries
+// _http._tcp.onboarding.svc.local, then onboarding.svc.local on DefaultPort.
+// With an empty suffix, "localhost" style names resolve from /etc/hosts.
+type DNSResolver struct {
+	Suffix      string
+	PortName    string
+	DefaultPort int
+	Resolver    *net.Resolver
+}
+
+func (r *DNSResolver) Resolve(ctx context.Context, service string) ([]Instance, error) {
+	resolver := r.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	portName := r.PortName
+	if portName == "" {
+		portName = "http"
+	}
+	name := service + r.Suffix
+
+	if _, records, err := resolver.LookupSRV(ctx, portName, "tcp", name); err == nil && len(records) > 0 {
+		instances := make([]Instance, 0, len(records))
+		for _, record := range records {
+			address := net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port)))
+			instances = append(instances, Instance{ID: address, Service: service, Address: address, Weight: int(record.Weight)})
+		}
+		return instances, nil
+	}
+
+	if r.DefaultPort == 0 {
+		return nil, errors.New(errors.SERVICE_NOT_FOUND_ERROR, fmt.Sprintf("no SRV records for %s and no default port", name))
+	}
+	hosts, err := resolver.LookupHost(ctx, name)
+	if err != nil {
+		return nil, errors.Wrap(errors.SERVICE_NOT_FOUND_ERROR, fmt.Sprintf("resolving %s", name), err)
+	}
+	port := strconv.Itoa(r.DefaultPort)
+	instances := make([]Instance, 0, len(hosts))
+	for _, host := range hosts {
+		address := net.JoinHostPort(host, port)
+		instances = append(instances, Instance{ID: address, Service: service, Address: address})
+	}
+	return instances, nil
+}
+
+// RegistryResolver asks the registry service (cmd/registry) for the live instances.
+type RegistryResolver struct {
+	url    string
+	client *http.Client
+}
+
+func NewRegistryResolver(registryURL string) *RegistryResolver {
+	return &RegistryResolver{url: strings.TrimSuffix(registryURL, "/"), client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (r *RegistryResolver) Resolve(ctx context.Context, service string) ([]Instance, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url+"/v1/services/"+url.PathEscape(service), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(errors.SERVICE_NOT_FOUND_ERROR, fmt.Sprintf("registry returned %d for service %s", resp.StatusCode, service))
+	}
+	var instances []Instance
+	if err := json.NewDecoder(resp.Body).Decode(&instances); err != nil {
+		return nil, err
+	}
+	return instances, nil
+}
+
+// ChainResolver returns the answer of the first resolver that knows the service.
+type ChainResolver []Resolver
+
+func (c ChainResolver) Resolve(ctx context.Context, service string) ([]Instance, error) {
+	var lastErr error
+	for _, resolver := range c {
+		instances, err := resolver.Resolve(ctx, service)
+		if err == nil && len(instances) > 0 {
+			return instances, nil
+		}
+		if err != nil {
+			lastErr = err
+		}
+	}
+	if lastErr == nil {
+		lastErr = errors.New(errors.SERVICE_NOT_FOUND_ERROR, fmt.Sprintf("no instances of service %s", service))
+	}
+	return nil, lastErr
+}
+
+// NewResolverFromConfig builds the resolver selected by discovery.resolver.
+// The registry and DNS resolvers fall back to the configured endpoints.
+func NewResolverFromConfig(appConfig *config.AppConfig) Resolver {
+	configResolver := NewConfigResolver(appConfig)
+	switch appConfig.GetConfig("discovery.resolver") {
+	case RESOLVER_DNS:
+		return ChainResolver{&DNSResolver{
+			Suffix:      appConfig.GetConfig("discovery.dns.suffix"),
+			PortName:    appConfig.GetConfig("discovery.dns.port_name"),
+			DefaultPort: appConfig.GetInt("discovery.dns.default_port"),
+		}, configResolver}
+	case RESOLVER_REGISTRY:
+		return ChainResolver{NewRegistryResolver(appConfig.GetConfig("discovery.registry.url")), configResolver}
+	default:
+		return configResolver
+	}
+}
+
+// NewDiscoveryFromConfig builds a Discovery from the discovery section of the configuration.
+func NewDiscoveryFromConfig(appConfig *config.AppConfig) *Discovery {
+	var opts []Option
+	if appConfig.IsSet("discovery.refresh_interval") {
+		interval := appConfig.GetDuration("discovery.refresh_interval")
+		opts = append(opts, WithRefreshInterval(interval), WithCacheTTL(interval))
+	}
+	return NewDiscovery(NewResolverFromConfig(appConfig), opts...)
+}
+
+// RegistrationURL returns the registry a service registers with on start, or
+// "" when discovery.register is off.
+func RegistrationURL(appConfig *config.AppConfig) string {
+	if !appConfig.GetBool("discovery.register") {
+		return ""
+	}
+	return appConfig.GetConfig("discovery.registry.url")
+}
+
+// RegistrationToken returns the registry token, read from the environment
+// variable named by discovery.registry.token_secret, or "" when
+// discovery.register is off. A service that registers must not start without it.
+func RegistrationToken(appConfig *config.AppConfig) (string, error) {
+	if !appConfig.GetBool("discovery.register") {
+		return "", nil
+	}
+	name := appConfig.GetConfig("discovery.registry.token_secret")
+	token := os.Getenv(name)
+	if token == "" {
+		return "", errors.New(errors.SECRET_NOT_FOUND_ERROR, fmt.Sprintf("registry token %s is not set", name))
+	}
+	return token, nil
+}
@@ -0,0 +1,49 @@
+package httpclient
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+)
+
+// DEFAULT_MAX_BUFFERED_BODY_BYTES is how much of a request body without
+// GetBody is buffered in memory so it can be retried.
+const DEFAULT_MAX_BUFFERED_BODY_BYTES = 1 << 20
+
+// SetFileBody makes the file at path the body of req. Every attempt reopens the
+// file, so the upload can be retried and hedged without holding it in memory.
+func SetFileBody(req *http.Request, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	req.Body = file
+	req.ContentLength = info.Size()
+	req.GetBody = func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}
+	return nil
+}
+
+// readPrefix reads up to limit bytes of body. complete reports whether that was all of it.
+func readPrefix(body io.Reader, limit int64) (prefix []byte, complete bool, err error) {
+	prefix, err = io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return prefix, false, err
+	}
+	return prefix, int64(len(prefix)) <= limit, nil
+}
+
+// withPrefix puts a prefix read by readPrefix back in front of the rest of body.
+func withPrefix(prefix []byte, body io.ReadCloser) io.ReadCloser {
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(prefix), body), body}
+}
@@ -0,0 +1,146 @@
+package httpclient
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"chaits.org/go-microservices-repo/pkg/errors"
+)
+
+const testUpload = `{"name":"billing","plan":"free"}`
+
+// failingUpload is a dependency that never answers and records the bodies it was sent.
+func failingUpload(bodies *[]string) RoundTripperFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		body := ""
+		if req.Body != nil {
+			data, _ := io.ReadAll(req.Body)
+			body = string(data)
+		}
+		*bodies = append(*bodies, body)
+		return nil, errors.New(errors.INTERNAL_ERROR, "connection reset")
+	}
+}
+
+func TestSetFileBody(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upload.json")
+	if err := os.WriteFile(path, []byte(testUpload), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var bodies []string
+	client := NewHTTPClient(WithRetryPolicy(RetryPolicy{MaxRetries: 3, Backoff: time.Millisecond, MaxBufferedBody: -1}))
+	client.httpclient.Transport = Chain(failingUpload(&bodies), client.defaultChain()...)
+
+	req, _ := http.NewRequest(http.MethodPut, "http://onboarding/apps/billing", nil)
+	if err := SetFileBody(req, path); err != nil {
+		t.Fatalf("SetFileBody() error = %v", err)
+	}
+	if req.ContentLength != int64(len(testUpload)) {
+		t.Errorf("ContentLength = %d, want %d", req.ContentLength, len(testUpload))
+	}
+	_, err := client.Do(req.Context(), req)
+
+	var appErr *errors.AppError
+	if !errors.As(err, &appErr) || appErr.Code != errors.ALL_RETRIES_FAILED_ERROR {
+		t.Errorf("Do() error = %v, want %s", err, errors.ALL_RETRIES_FAILED_ERROR)
+	}
+	// Buffering is off, so every attempt reopened the file through GetBody.
+	if len(bodies) != 3 {
+		t.Fatalf("dependency saw %d attempts, want 3", len(bodies))
+	}
+	for i, body := range bodies {
+		if body != testUpload {
+			t.Errorf("attempt %d sent %q, want the file", i+1, body)
+		}
+	}
+
+	if err := SetFileBody(req, filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("SetFileBody() accepted a missing file")
+	}
+}
+
+func TestReplayableBody(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxBuffered   int64
+		body          func() io.Reader
+		contentLength int64
+		wantAttempts  int
+		wantCode      string
+	}{
+		{name: "one-shot body is buffered", body: oneShot,
+			wantAttempts: 3, wantCode: errors.ALL_RETRIES_FAILED_ERROR},
+		{name: "body with GetBody is not buffered", maxBuffered: -1,
+			body: func() io.Reader { return strings.NewReader(testUpload) }, wantAttempts: 3, wantCode: errors.ALL_RETRIES_FAILED_ERROR},
+		{name: "one-shot body above the buffer", maxBuffered: 8, body: oneShot,
+			wantAttempts: 1, wantCode: errors.BODY_NOT_REPLAYABLE_ERROR},
+		{name: "declared length above the buffer", maxBuffered: 8, body: oneShot, contentLength: int64(len(testUpload)),
+			wantAttempts: 1, wantCode: errors.BODY_NOT_REPLAYABLE_ERROR},
+		{name: "buffering disabled", maxBuffered: -1, body: oneShot,
+			wantAttempts: 1, wantCode: errors.BODY_NOT_REPLAYABLE_ERROR},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bodies []string
+			client := NewHTTPClient(WithRetryPolicy(RetryPolicy{MaxRetries: 3, Backoff: time.Millisecond, MaxBufferedBody: tt.maxBuffered}))
+			client.httpclient.Transport = Chain(failingUpload(&bodies), client.defaultChain()...)
+
+			req, _ := http.NewRequest(http.MethodPut, "http://onboarding/apps/billing", tt.body())
+			if tt.contentLength != 0 {
+				req.ContentLength = tt.contentLength
+			}
+			_, err := client.Do(req.Context(), req)
+
+			var appErr *errors.AppError
+			if !errors.As(err, &appErr) || appErr.Code != tt.wantCode {
+				t.Errorf("Do() error = %v, want %s", err, tt.wantCode)
+			}
+			if len(bodies) != tt.wantAttempts {
+				t.Fatalf("dependency saw %d attempts, want %d", len(bodies), tt.wantAttempts)
+			}
+			// No attempt may go out with an empty or partial body.
+			for i, body := range bodies {
+				if body != testUpload {
+					t.Errorf("attempt %d sent %q, want the whole body", i+1, body)
+				}
+			}
+		})
+	}
+}
+
+// oneShot returns a reader that http.NewRequest cannot rewind.
+func oneShot() io.Reader {
+	return io.MultiReader(strings.NewReader(testUpload))
+}
+
+func TestReadPrefix(t *testing.T) {
+	tests := []struct {
+		limit        int64
+		wantPrefix   string
+		wantComplete bool
+	}{
+		{limit: 64, wantPrefix: testUpload, wantComplete: true},
+		{limit: int64(len(testUpload)), wantPrefix: testUpload, wantComplete: true},
+		{limit: 8, wantPrefix: testUpload[:9], wantComplete: false},
+	}
+
+	for _, tt := range tests {
+		body := io.NopCloser(strings.NewReader(testUpload))
+		prefix, complete, err := readPrefix(body, tt.limit)
+		if err != nil || string(prefix) != tt.wantPrefix || complete != tt.wantComplete {
+			t.Errorf("readPrefix(%d) = %q, %v, %v, want %q, %v", tt.limit, prefix, complete, err, tt.wantPrefix, tt.wantComplete)
+		}
+		// withPrefix gives back the whole body either way.
+		rest, _ := io.ReadAll(withPrefix(prefix, body))
+		if string(rest) != testUpload {
+			t.Errorf("withPrefix() after readPrefix(%d) = %q", tt.limit, rest)
+		}
+	}
+}
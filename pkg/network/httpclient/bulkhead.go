@@ -0,0 +1,40 @@
+package httpclient
+
+import (
+	"net/http"
+
+	"chaits.org/go-microservices-repo/pkg/general/bulkhead"
+)
+
+// WithBulkhead caps the concurrent requests to each dependency, as named by
+// DependencyName. Requests over the cap wait in the bulkhead queue or fail
+// with BULKHEAD_FULL_ERROR or BULKHEAD_TIMEOUT_ERROR; they are not retried.
+func WithBulkhead(cfg bulkhead.Config) Option {
+	return func(h *HTTPClient) {
+		h.bulkheads = bulkhead.NewGroup(cfg)
+	}
+}
+
+// BulkheadInterceptor caps concurrent requests per dependency, see WithBulkhead.
+func BulkheadInterceptor(cfg bulkhead.Config) Interceptor {
+	return bulkheadInterceptor(bulkhead.NewGroup(cfg))
+}
+
+func bulkheadInterceptor(bulkheads *bulkhead.Group) Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			release, err := bulkheads.Get(DependencyName(req)).Acquire(req.Context())
+			if err != nil {
+				return nil, err
+			}
+			resp, err := next.RoundTrip(req)
+			if err != nil {
+				release()
+				return nil, err
+			}
+			// The slot is held until the caller is done with the body.
+			resp.Body = &closeHook{ReadCloser: resp.Body, hook: release}
+			return resp, nil
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package httpclient
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"chaits.org/go-microservices-repo/pkg/errors"
+	"chaits.org/go-microservices-repo/pkg/general/bulkhead"
+)
+
+func TestBulkheadInterceptor(t *testing.T) {
+	transport := BulkheadInterceptor(bulkhead.Config{MaxConcurrent: 1})(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "down" {
+			return nil, errors.New(errors.INTERNAL_ERROR, "connection refused")
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	}))
+	send := func(host string) (*http.Response, error) {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+host+"/items", nil)
+		return transport.RoundTrip(req)
+	}
+	isFull := func(err error) bool {
+		var appErr *errors.AppError
+		return errors.As(err, &appErr) && appErr.Code == errors.BULKHEAD_FULL_ERROR
+	}
+
+	resp, err := send("onboarding")
+	if err != nil {
+		t.Fatalf("first request error = %v", err)
+	}
+	// The slot is held while the body is open.
+	if _, err := send("onboarding"); !isFull(err) {
+		t.Errorf("request while a body is open error = %v, want %s", err, errors.BULKHEAD_FULL_ERROR)
+	}
+	other, err := send("registry")
+	if err != nil {
+		t.Errorf("request to another dependency error = %v", err)
+	} else {
+		other.Body.Close()
+	}
+
+	resp.Body.Close()
+	resp, err = send("onboarding")
+	if err != nil {
+		t.Fatalf("request after the body was closed error = %v", err)
+	}
+	resp.Body.Close()
+
+	// A failed request gives its slot back at once.
+	if _, err := send("down"); isFull(err) || err == nil {
+		t.Fatalf("failing request error = %v", err)
+	}
+	if _, err := send("down"); isFull(err) {
+		t.Errorf("slot of a failed request was not released: %v", err)
+	}
+}
+
+func TestBulkheadRejectionsAreNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	client := NewHTTPClient(
+		WithRetry(3, time.Millisecond, http.StatusServiceUnavailable),
+		WithBulkhead(bulkhead.Config{MaxConcurrent: 1}),
+	)
+	client.httpclient.Transport = Chain(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		calls.Add(1)
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	}), client.defaultChain()...)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://onboarding/items", nil)
+	held, err := client.Do(req.Context(), req)
+	if err != nil {
+		t.Fatalf("first request error = %v", err)
+	}
+	defer held.Body.Close()
+
+	req, _ = http.NewRequest(http.MethodGet, "http://onboarding/items", nil)
+	_, err = client.Do(req.Context(), req)
+	var appErr *errors.AppError
+	if !errors.As(err, &appErr) || appErr.Code != errors.BULKHEAD_FULL_ERROR {
+		t.Errorf("second request error = %v, want %s", err, errors.BULKHEAD_FULL_ERROR)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("dependency saw %d requests, want 1", got)
+	}
+}
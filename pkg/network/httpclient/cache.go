@@ -0,0 +1,472 @@
+package httpclient
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"chaits.org/go-microservices-repo/pkg/general/metrics"
+)
+
+// Cache results reported in http_client_cache_requests_total.
+const (
+	CACHE_HIT         = "hit"
+	CACHE_MISS        = "miss"
+	CACHE_REVALIDATED = "revalidated"
+	CACHE_COALESCED   = "coalesced"
+)
+
+// Default bounds of NewLRUCache.
+const (
+	DEFAULT_CACHE_MAX_ENTRIES = 1000
+	DEFAULT_CACHE_MAX_BYTES   = 32 << 20
+)
+
+// maxCachedBodyBytes is the largest response body that is cached and shared
+// with coalesced requests. Larger responses are streamed to the caller.
+const maxCachedBodyBytes = 8 << 20
+
+// CachedResponse is a response held by a CacheStore.
+type CachedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// StoredAt is when the response was received or last revalidated.
+	StoredAt time.Time
+	// Expires is when the response becomes stale. Stale responses are revalidated.
+	Expires time.Time
+	// Vary holds the values of the request headers named by the Vary header.
+	Vary map[string]string
+}
+
+// CacheStore holds cached responses by key. Implementations must be safe for
+// concurrent use and must not modify the responses they hold.
+type CacheStore interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, resp *CachedResponse)
+	Delete(key string)
+}
+
+// LRUCache is an in-memory CacheStore bounded by entry count and total body
+// size. The least recently used responses are evicted first.
+type LRUCache struct {
+	maxEntries int
+	maxBytes   int64
+
+	mu      sync.Mutex
+	entries *list.List
+	index   map[string]*list.Element
+	size    int64
+}
+
+type lruEntry struct {
+	key  string
+	resp *CachedResponse
+}
+
+// NewLRUCache returns an LRUCache. Zero bounds use DEFAULT_CACHE_MAX_ENTRIES
+// and DEFAULT_CACHE_MAX_BYTES.
+func NewLRUCache(maxEntries int, maxBytes int64) *LRUCache {
+	if maxEntries <= 0 {
+		maxEntries = DEFAULT_CACHE_MAX_ENTRIES
+	}
+	if maxBytes <= 0 {
+		maxBytes = DEFAULT_CACHE_MAX_BYTES
+	}
+	return &LRUCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		entries:    list.New(),
+		index:      make(map[string]*list.Element),
+	}
+}
+
+func (c *LRUCache) Get(key string) (*CachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.index[key]
+	if !ok {
+		return nil, false
+	}
+	c.entries.MoveToFront(element)
+	return element.Value.(*lruEntry).resp, true
+}
+
+// Set stores resp under key. Responses larger than the whole cache are not stored.
+func (c *LRUCache) Set(key string, resp *CachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(key)
+	if int64(len(resp.Body)) > c.maxBytes {
+		return
+	}
+	c.index[key] = c.entries.PushFront(&lruEntry{key: key, resp: resp})
+	c.grow(int64(len(resp.Body)))
+
+	for c.entries.Len() > c.maxEntries || c.size > c.maxBytes {
+		oldest := c.entries.Back()
+		c.remove(oldest.Value.(*lruEntry).key)
+		metrics.IncrementHTTPClientCacheEvictions()
+	}
+}
+
+func (c *LRUCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(key)
+}
+
+// Len returns the number of cached responses.
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries.Len()
+}
+
+func (c *LRUCache) remove(key string) {
+	element, ok := c.index[key]
+	if !ok {
+		return
+	}
+	c.entries.Remove(element)
+	delete(c.index, key)
+	c.grow(-int64(len(element.Value.(*lruEntry).resp.Body)))
+}
+
+func (c *LRUCache) grow(delta int64) {
+	c.size += delta
+	metrics.AddHTTPClientCacheBytes(delta)
+}
+
+// WithCache caches GET responses in store, honouring Cache-Control, ETag and
+// Last-Modified. Concurrent identical GETs share one request. Responses to
+// requests that carry their own credentials are only stored when they are
+// marked public, so they are never served to other callers. For example:
+//
+//	httpclient.NewHTTPClient(httpclient.WithCache(httpclient.NewLRUCache(500, 8<<20)))
+func WithCache(store CacheStore) Option {
+	return func(h *HTTPClient) {
+		h.cache = store
+	}
+}
+
+// CacheInterceptor caches responses in store, see WithCache. It belongs at the
+// outside of the chain, so cache hits are neither retried nor measured as
+// dependency requests.
+func CacheInterceptor(store CacheStore) Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &cachingTransport{next: next, store: store, calls: make(map[string]*cacheCall)}
+	}
+}
+
+// cachingTransport serves fresh responses from the store, revalidates stale
+// ones and coalesces concurrent identical requests.
+type cachingTransport struct {
+	next  http.RoundTripper
+	store CacheStore
+
+	mu    sync.Mutex
+	calls map[string]*cacheCall
+}
+
+// cacheCall is a request in flight that identical requests wait for. resp is
+// nil when the request failed or the response was too large to share.
+type cacheCall struct {
+	done chan struct{}
+	resp *CachedResponse
+	err  error
+}
+
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Range and caller-supplied conditional requests are passed through untouched.
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" ||
+		req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return t.next.RoundTrip(req)
+	}
+	requestDirectives := parseCacheControl(req.Header)
+	if _, ok := requestDirectives["no-store"]; ok {
+		return t.next.RoundTrip(req)
+	}
+
+	key := req.URL.String()
+	dependency := DependencyName(req)
+	if cached, ok := t.store.Get(key); ok && varyMatches(cached, req) && !mustRevalidate(requestDirectives) && time.Now().Before(cached.Expires) {
+		metrics.RecordHTTPClientCacheRequest(dependency, CACHE_HIT)
+		return cached.response(req), nil
+	}
+
+	callKey := coalescingKey(req)
+	t.mu.Lock()
+	if call, ok := t.calls[callKey]; ok {
+		t.mu.Unlock()
+		select {
+		case <-call.done:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		// A leader whose caller gave up or ran out of time says nothing
+		// about this request, which is then sent on its own.
+		if call.err != nil && !isContextError(call.err) {
+			return nil, call.err
+		}
+		if call.resp == nil {
+			metrics.RecordHTTPClientCacheRequest(dependency, CACHE_MISS)
+			return t.next.RoundTrip(req)
+		}
+		metrics.RecordHTTPClientCacheRequest(dependency, CACHE_COALESCED)
+		return call.resp.response(req), nil
+	}
+	call := &cacheCall{done: make(chan struct{})}
+	t.calls[callKey] = call
+	t.mu.Unlock()
+
+	var streamed *http.Response
+	var result string
+	call.resp, streamed, result, call.err = t.fetch(req, key)
+	t.mu.Lock()
+	delete(t.calls, callKey)
+	t.mu.Unlock()
+	close(call.done)
+
+	if call.err != nil {
+		return nil, call.err
+	}
+	metrics.RecordHTTPClientCacheRequest(dependency, result)
+	if streamed != nil {
+		return streamed, nil
+	}
+	return call.resp.response(req), nil
+}
+
+// fetch sends the request, conditional on the validators of a cached
+// response, and updates the store with the answer. Responses over
+// maxCachedBodyBytes are returned as streamed instead of being buffered.
+func (t *cachingTransport) fetch(req *http.Request, key string) (cachedResp *CachedResponse, streamed *http.Response, result string, err error) {
+	cached, ok := t.store.Get(key)
+	if ok && !varyMatches(cached, req) {
+		cached, ok = nil, false
+	}
+
+	out := req
+	etag, lastModified := "", ""
+	if ok {
+		etag, lastModified = cached.Header.Get("ETag"), cached.Header.Get("Last-Modified")
+	}
+	conditional := etag != "" || lastModified != ""
+	if conditional {
+		out = req.Clone(req.Context())
+		if etag != "" {
+			out.Header.Set("If-None-Match", etag)
+		}
+		if lastModified != "" {
+			out.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	resp, err := t.next.RoundTrip(out)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	now := time.Now()
+
+	if conditional && resp.StatusCode == http.StatusNotModified {
+		discard(resp)
+		updated := *cached
+		updated.Header = cached.Header.Clone()
+		for name, values := range resp.Header {
+			if name != "Content-Length" {
+				updated.Header[name] = values
+			}
+		}
+		updated.StoredAt = now
+		updated.Expires = expiresAt(updated.Header, now)
+		if storable(&updated, req) {
+			t.store.Set(key, &updated)
+		} else {
+			t.store.Delete(key)
+		}
+		return &updated, nil, CACHE_REVALIDATED, nil
+	}
+
+	body, complete, err := readPrefix(resp.Body, maxCachedBodyBytes)
+	if err != nil {
+		resp.Body.Close()
+		return nil, nil, "", err
+	}
+	if !complete {
+		resp.Body = withPrefix(body, resp.Body)
+		if ok {
+			t.store.Delete(key)
+		}
+		return nil, resp, CACHE_MISS, nil
+	}
+	resp.Body.Close()
+	fetched := &CachedResponse{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+		StoredAt:   now,
+		Expires:    expiresAt(resp.Header, now),
+		Vary:       varyValues(resp.Header, req),
+	}
+	if storable(fetched, req) {
+		t.store.Set(key, fetched)
+	} else if ok {
+		t.store.Delete(key)
+	}
+	return fetched, nil, CACHE_MISS, nil
+}
+
+// response builds a fresh *http.Response for req from the cached response.
+func (c *CachedResponse) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", c.StatusCode, http.StatusText(c.StatusCode)),
+		StatusCode:    c.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        c.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(c.Body)),
+		ContentLength: int64(len(c.Body)),
+		Request:       req,
+	}
+}
+
+// storable reports whether a response to req may be cached: a 200 without
+// no-store or Vary: *, with an expiry or a validator to revalidate it with. A
+// response to a request with credentials must also be marked public.
+func storable(c *CachedResponse, req *http.Request) bool {
+	if c.StatusCode != http.StatusOK || c.Header.Get("Vary") == "*" {
+		return false
+	}
+	directives := parseCacheControl(c.Header)
+	if _, ok := directives["no-store"]; ok {
+		return false
+	}
+	if _, ok := directives["private"]; ok {
+		return false
+	}
+	if _, public := directives["public"]; hasCredentials(req) && !public {
+		return false
+	}
+	return c.Expires.After(c.StoredAt) || c.Header.Get("ETag") != "" || c.Header.Get("Last-Modified") != ""
+}
+
+// expiresAt computes when a response received at now becomes stale, from
+// Cache-Control max-age, or Expires relative to Date. Without either the
+// response is stale at once and revalidated on every use.
+func expiresAt(header http.Header, now time.Time) time.Time {
+	directives := parseCacheControl(header)
+	if _, ok := directives["no-cache"]; ok {
+		return now
+	}
+	if maxAge, ok := directives["max-age"]; ok {
+		seconds, err := strconv.Atoi(maxAge)
+		if err != nil {
+			return now
+		}
+		age, _ := strconv.Atoi(header.Get("Age"))
+		return now.Add(time.Duration(seconds-age) * time.Second)
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		expiry, err := http.ParseTime(expires)
+		if err != nil {
+			return now
+		}
+		date, err := http.ParseTime(header.Get("Date"))
+		if err != nil {
+			date = now
+		}
+		return now.Add(expiry.Sub(date))
+	}
+	return now
+}
+
+// credentialHeaders identify the caller. A response to a request carrying one
+// of them may be specific to that caller.
+var credentialHeaders = []string{"Authorization", "X-API-Key", "Cookie"}
+
+func hasCredentials(req *http.Request) bool {
+	for _, name := range credentialHeaders {
+		if req.Header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// mustRevalidate reports whether the request refuses a cached response without revalidation.
+func mustRevalidate(requestDirectives map[string]string) bool {
+	_, noCache := requestDirectives["no-cache"]
+	return noCache || requestDirectives["max-age"] == "0"
+}
+
+// parseCacheControl returns the Cache-Control directives with lower-case names.
+func parseCacheControl(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, line := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(line, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name != "" {
+				directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+			}
+		}
+	}
+	return directives
+}
+
+// varyValues records the request headers that the response varies on.
+func varyValues(header http.Header, req *http.Request) map[string]string {
+	var values map[string]string
+	for _, line := range header.Values("Vary") {
+		for _, name := range strings.Split(line, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "" || name == "*" {
+				continue
+			}
+			if values == nil {
+				values = make(map[string]string)
+			}
+			values[name] = req.Header.Get(name)
+		}
+	}
+	return values
+}
+
+func varyMatches(cached *CachedResponse, req *http.Request) bool {
+	for name, value := range cached.Vary {
+		if req.Header.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// coalescingKey identifies identical requests: same URL and same headers.
+func coalescingKey(req *http.Request) string {
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var key strings.Builder
+	key.WriteString(req.URL.String())
+	for _, name := range names {
+		fmt.Fprintf(&key, "\n%s: %s", name, strings.Join(req.Header[name], ", "))
+	}
+	return key.String()
+}
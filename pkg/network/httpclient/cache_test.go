@@ -0,0 +1,302 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingOrigin answers with respond and counts the requests it receives.
+// Bodies default to "call <n>".
+type countingOrigin struct {
+	calls   atomic.Int32
+	respond func(n int32, req *http.Request) (*http.Response, error)
+}
+
+func (o *countingOrigin) RoundTrip(req *http.Request) (*http.Response, error) {
+	n := o.calls.Add(1)
+	return o.respond(n, req)
+}
+
+func okResponse(body string, header http.Header) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{StatusCode: http.StatusOK, Header: header.Clone(), Body: io.NopCloser(bytes.NewReader([]byte(body)))}
+}
+
+func cacheGet(t *testing.T, transport http.RoundTripper, ctx context.Context, header http.Header) (*http.Response, string, error) {
+	t.Helper()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://onboarding/apps", nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body), nil
+}
+
+func TestCacheStorage(t *testing.T) {
+	tests := []struct {
+		name      string
+		response  http.Header
+		first     http.Header
+		second    http.Header
+		wantCalls int32
+	}{
+		{name: "fresh response is served from the cache", response: http.Header{"Cache-Control": {"max-age=60"}}, wantCalls: 1},
+		{name: "no-store", response: http.Header{"Cache-Control": {"no-store, max-age=60"}}, wantCalls: 2},
+		{name: "private", response: http.Header{"Cache-Control": {"private, max-age=60"}}, wantCalls: 2},
+		{name: "no expiry or validator", response: http.Header{}, wantCalls: 2},
+		{name: "request no-cache", response: http.Header{"Cache-Control": {"max-age=60"}},
+			second: http.Header{"Cache-Control": {"no-cache"}}, wantCalls: 2},
+		{name: "request no-store", response: http.Header{"Cache-Control": {"max-age=60"}},
+			first: http.Header{"Cache-Control": {"no-store"}}, wantCalls: 2},
+		{name: "Age counts against max-age", response: http.Header{"Cache-Control": {"max-age=60"}, "Age": {"60"}}, wantCalls: 2},
+		{name: "Authorization is not shared", response: http.Header{"Cache-Control": {"max-age=60"}},
+			first: http.Header{"Authorization": {"Bearer a"}}, second: http.Header{"Authorization": {"Bearer b"}}, wantCalls: 2},
+		{name: "Authorization is not shared with anonymous callers", response: http.Header{"Cache-Control": {"max-age=60"}},
+			first: http.Header{"Authorization": {"Bearer a"}}, wantCalls: 2},
+		{name: "X-API-Key is not shared", response: http.Header{"Cache-Control": {"max-age=60"}},
+			first: http.Header{"X-Api-Key": {"k1"}}, second: http.Header{"X-Api-Key": {"k2"}}, wantCalls: 2},
+		{name: "public response to a request with credentials", response: http.Header{"Cache-Control": {"public, max-age=60"}},
+			first: http.Header{"Authorization": {"Bearer a"}}, second: http.Header{"Authorization": {"Bearer b"}}, wantCalls: 1},
+		{name: "Vary matches", response: http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"Accept"}},
+			first: http.Header{"Accept": {"application/json"}}, second: http.Header{"Accept": {"application/json"}}, wantCalls: 1},
+		{name: "Vary differs", response: http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"Accept"}},
+			first: http.Header{"Accept": {"application/json"}}, second: http.Header{"Accept": {"text/html"}}, wantCalls: 2},
+		{name: "Vary star", response: http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"*"}}, wantCalls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin := &countingOrigin{respond: func(n int32, req *http.Request) (*http.Response, error) {
+				return okResponse(fmt.Sprintf("call %d", n), tt.response), nil
+			}}
+			transport := CacheInterceptor(NewLRUCache(0, 0))(origin)
+
+			if _, _, err := cacheGet(t, transport, context.Background(), tt.first); err != nil {
+				t.Fatalf("first request error = %v", err)
+			}
+			_, body, err := cacheGet(t, transport, context.Background(), tt.second)
+			if err != nil {
+				t.Fatalf("second request error = %v", err)
+			}
+			if got := origin.calls.Load(); got != tt.wantCalls {
+				t.Errorf("origin saw %d requests, want %d", got, tt.wantCalls)
+			}
+			if want := fmt.Sprintf("call %d", tt.wantCalls); body != want {
+				t.Errorf("second response body = %q, want %q", body, want)
+			}
+		})
+	}
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		validator   http.Header
+		conditional string
+		value       string
+	}{
+		{name: "ETag", validator: http.Header{"Etag": {`"v1"`}}, conditional: "If-None-Match", value: `"v1"`},
+		{name: "Last-Modified", validator: http.Header{"Last-Modified": {"Mon, 01 Jan 2024 00:00:00 GMT"}},
+			conditional: "If-Modified-Since", value: "Mon, 01 Jan 2024 00:00:00 GMT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin := &countingOrigin{respond: func(n int32, req *http.Request) (*http.Response, error) {
+				if n == 1 {
+					header := tt.validator.Clone()
+					header.Set("Cache-Control", "no-cache")
+					return okResponse("original", header), nil
+				}
+				if got := req.Header.Get(tt.conditional); got != tt.value {
+					t.Errorf("%s = %q, want %q", tt.conditional, got, tt.value)
+				}
+				return &http.Response{StatusCode: http.StatusNotModified, Header: http.Header{"Cache-Control": {"max-age=60"}}, Body: http.NoBody}, nil
+			}}
+			transport := CacheInterceptor(NewLRUCache(0, 0))(origin)
+
+			cacheGet(t, transport, context.Background(), nil)
+			for i := 0; i < 2; i++ {
+				resp, body, err := cacheGet(t, transport, context.Background(), nil)
+				if err != nil {
+					t.Fatalf("request error = %v", err)
+				}
+				if resp.StatusCode != http.StatusOK || body != "original" {
+					t.Errorf("revalidated response = %d %q, want 200 \"original\"", resp.StatusCode, body)
+				}
+			}
+			// The 304 made the response fresh for 60 seconds, so the last request was a hit.
+			if got := origin.calls.Load(); got != 2 {
+				t.Errorf("origin saw %d requests, want 2", got)
+			}
+		})
+	}
+}
+
+func TestCacheBodySizeCap(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		wantCalls int32
+	}{
+		{name: "at the cap", size: maxCachedBodyBytes, wantCalls: 1},
+		{name: "over the cap", size: maxCachedBodyBytes + 1, wantCalls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := bytes.Repeat([]byte("a"), tt.size)
+			origin := &countingOrigin{respond: func(n int32, req *http.Request) (*http.Response, error) {
+				return okResponse(string(body), http.Header{"Cache-Control": {"max-age=60"}}), nil
+			}}
+			transport := CacheInterceptor(NewLRUCache(0, 0))(origin)
+
+			for i := 0; i < 2; i++ {
+				_, got, err := cacheGet(t, transport, context.Background(), nil)
+				if err != nil {
+					t.Fatalf("request error = %v", err)
+				}
+				if len(got) != tt.size {
+					t.Errorf("body of %d bytes, want %d", len(got), tt.size)
+				}
+			}
+			if got := origin.calls.Load(); got != tt.wantCalls {
+				t.Errorf("origin saw %d requests, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// blockingOrigin holds the first request until release is closed or the
+// request is canceled, then answers it with first. Later requests get a 200.
+func blockingOrigin(started chan<- struct{}, release <-chan struct{}, first func() (*http.Response, error)) *countingOrigin {
+	return &countingOrigin{respond: func(n int32, req *http.Request) (*http.Response, error) {
+		if n > 1 {
+			return okResponse(fmt.Sprintf("call %d", n), nil), nil
+		}
+		close(started)
+		select {
+		case <-release:
+			return first()
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}}
+}
+
+func TestCacheCoalescing(t *testing.T) {
+	const followers = 3
+	boom := errors.New("connection reset")
+	tests := []struct {
+		name      string
+		first     func() (*http.Response, error)
+		cancel    bool
+		wantCalls int32
+		wantErr   error
+		wantBody  string
+	}{
+		{name: "followers share the response", first: func() (*http.Response, error) { return okResponse("shared", nil), nil },
+			wantCalls: 1, wantBody: "shared"},
+		{name: "followers share an origin error", first: func() (*http.Response, error) { return nil, boom },
+			wantCalls: 1, wantErr: boom},
+		// Each follower sends its own request, so the bodies differ.
+		{name: "followers retry when the leader is canceled", cancel: true,
+			wantCalls: 1 + followers},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started, release := make(chan struct{}), make(chan struct{})
+			origin := blockingOrigin(started, release, tt.first)
+			transport := CacheInterceptor(NewLRUCache(0, 0))(origin)
+
+			leaderCtx, cancelLeader := context.WithCancel(context.Background())
+			defer cancelLeader()
+			go cacheGet(t, transport, leaderCtx, nil)
+			<-started
+
+			var wg sync.WaitGroup
+			bodies, errs := make([]string, followers), make([]error, followers)
+			for i := 0; i < followers; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					_, bodies[i], errs[i] = cacheGet(t, transport, context.Background(), nil)
+				}(i)
+			}
+			// Give the followers time to join the leader's call.
+			time.Sleep(50 * time.Millisecond)
+			if tt.cancel {
+				cancelLeader()
+			} else {
+				close(release)
+			}
+			wg.Wait()
+
+			for i := 0; i < followers; i++ {
+				if !errors.Is(errs[i], tt.wantErr) {
+					t.Errorf("follower %d error = %v, want %v", i, errs[i], tt.wantErr)
+				}
+				if tt.wantErr == nil && (bodies[i] == "" || tt.wantBody != "" && bodies[i] != tt.wantBody) {
+					t.Errorf("follower %d body = %q, want %q", i, bodies[i], tt.wantBody)
+				}
+			}
+			if got := origin.calls.Load(); got != tt.wantCalls {
+				t.Errorf("origin saw %d requests, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestLRUCacheEviction(t *testing.T) {
+	entry := func(size int) *CachedResponse {
+		return &CachedResponse{StatusCode: http.StatusOK, Body: make([]byte, size)}
+	}
+	tests := []struct {
+		name       string
+		maxEntries int
+		maxBytes   int64
+		sizes      map[string]int
+		want       []string
+	}{
+		{name: "entry bound", maxEntries: 2, maxBytes: 1 << 20, want: []string{"a", "c"}},
+		{name: "byte bound", maxEntries: 10, maxBytes: 25, sizes: map[string]int{"a": 10, "b": 10, "c": 10}, want: []string{"a", "c"}},
+		{name: "larger than the cache", maxEntries: 10, maxBytes: 25, sizes: map[string]int{"c": 30}, want: []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewLRUCache(tt.maxEntries, tt.maxBytes)
+			cache.Set("a", entry(tt.sizes["a"]))
+			cache.Set("b", entry(tt.sizes["b"]))
+			cache.Get("a") // b is now the least recently used.
+			cache.Set("c", entry(tt.sizes["c"]))
+
+			for _, key := range []string{"a", "b", "c"} {
+				_, ok := cache.Get(key)
+				want := false
+				for _, kept := range tt.want {
+					want = want || kept == key
+				}
+				if ok != want {
+					t.Errorf("%s cached = %v, want %v", key, ok, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,322 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"chaits.org/go-microservices-repo/pkg/errors"
+	"chaits.org/go-microservices-repo/pkg/general/metrics"
+)
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+const (
+	// StateClosed lets every call through and counts the outcomes.
+	StateClosed CircuitState = iota
+	// StateHalfOpen lets a few trial calls through to probe the dependency.
+	StateHalfOpen
+	// StateOpen fails every call fast until OpenTimeout has passed.
+	StateOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// windowBuckets is the number of buckets the rolling window is divided into.
+const windowBuckets = 10
+
+// CircuitBreakerSettings configures when a breaker trips and how it recovers.
+// Any trip condition that is set opens the breaker.
+type CircuitBreakerSettings struct {
+	// ConsecutiveFailures trips the breaker after this many failures in a row. Zero disables it.
+	ConsecutiveFailures int
+
+	// FailureRatio trips the breaker when failures/calls within Window reaches this ratio. Zero disables it.
+	FailureRatio float64
+
+	// SlowCallRatio trips the breaker when calls slower than SlowCallThreshold
+	// make up this ratio of the calls within Window. Zero disables it.
+	SlowCallRatio     float64
+	SlowCallThreshold time.Duration
+
+	// MinimumCalls is the number of calls within Window before the ratios are evaluated.
+	MinimumCalls int
+
+	// Window is the rolling period over which the ratios are computed.
+	Window time.Duration
+
+	// OpenTimeout is how long the breaker stays open before allowing trial calls.
+	OpenTimeout time.Duration
+
+	// HalfOpenMaxCalls is the number of trial calls allowed while half-open.
+	// The breaker closes once they all succeed and re-opens on the first failure.
+	HalfOpenMaxCalls int
+
+	// IsFailure classifies a call outcome. Defaults to transport errors other
+	// than cancellation, and 5xx responses. Calls whose caller gave up are never
+	// counted, whatever IsFailure says.
+	IsFailure func(resp *http.Response, err error) bool
+}
+
+// DefaultCircuitBreakerSettings trips after 5 consecutive failures or a 50%
+// failure ratio over 20 calls in 30 seconds, and probes again after 30 seconds.
+func DefaultCircuitBreakerSettings() CircuitBreakerSettings {
+	return CircuitBreakerSettings{
+		ConsecutiveFailures: 5,
+		FailureRatio:        0.5,
+		MinimumCalls:        20,
+		Window:              30 * time.Second,
+		OpenTimeout:         30 * time.Second,
+		HalfOpenMaxCalls:    1,
+	}
+}
+
+// WithCircuitBreaker fails calls fast with a CIRCUIT_OPEN_ERROR while the
+// target host is considered unhealthy. Each host has its own breaker, and with
+// WithLoadBalancer each endpoint does, so one failing replica leaves the others
+// reachable.
+func WithCircuitBreaker(settings CircuitBreakerSettings) Option {
+	return func(h *HTTPClient) {
+		h.breakers = newCircuitBreakers(settings)
+	}
+}
+
+func defaultIsFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	return resp.StatusCode >= http.StatusInternalServerError
+}
+
+// circuitBreakers holds one breaker per target host.
+type circuitBreakers struct {
+	settings CircuitBreakerSettings
+
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func newCircuitBreakers(settings CircuitBreakerSettings) *circuitBreakers {
+	defaults := DefaultCircuitBreakerSettings()
+	if settings.Window <= 0 {
+		settings.Window = defaults.Window
+	}
+	if settings.OpenTimeout <= 0 {
+		settings.OpenTimeout = defaults.OpenTimeout
+	}
+	if settings.HalfOpenMaxCalls <= 0 {
+		settings.HalfOpenMaxCalls = defaults.HalfOpenMaxCalls
+	}
+	if settings.IsFailure == nil {
+		settings.IsFailure = defaultIsFailure
+	}
+	return &circuitBreakers{
+		settings: settings,
+		breakers: make(map[string]*circuitBreaker),
+	}
+}
+
+func (c *circuitBreakers) get(host string) *circuitBreaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	breaker, ok := c.breakers[host]
+	if !ok {
+		breaker = &circuitBreaker{host: host, settings: &c.settings}
+		c.breakers[host] = breaker
+	}
+	return breaker
+}
+
+// bucket counts the outcomes of calls within one slice of the rolling window.
+type bucket struct {
+	start    time.Time
+	calls    int
+	failures int
+	slow     int
+}
+
+type circuitBreaker struct {
+	host     string
+	settings *CircuitBreakerSettings
+
+	mu                  sync.Mutex
+	state               CircuitState
+	generation          uint64
+	openedAt            time.Time
+	consecutiveFailures int
+	halfOpenInFlight    int
+	halfOpenSuccesses   int
+	buckets             [windowBuckets]bucket
+}
+
+// allow reports whether a call may proceed and returns the generation the call
+// belongs to, so that outcomes from before a state change are ignored.
+func (b *circuitBreaker) allow(now time.Time) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen && now.Sub(b.openedAt) >= b.settings.OpenTimeout {
+		b.transition(StateHalfOpen, now)
+	}
+
+	switch b.state {
+	case StateOpen:
+		metrics.IncrementCircuitBreakerRejections(b.host)
+		retryIn := b.settings.OpenTimeout - now.Sub(b.openedAt)
+		return 0, errors.New(errors.CIRCUIT_OPEN_ERROR, fmt.Sprintf("circuit breaker for %s is open, retry in %v", b.host, retryIn.Round(time.Millisecond)))
+	case StateHalfOpen:
+		if b.halfOpenInFlight >= b.settings.HalfOpenMaxCalls {
+			metrics.IncrementCircuitBreakerRejections(b.host)
+			return 0, errors.New(errors.CIRCUIT_OPEN_ERROR, fmt.Sprintf("circuit breaker for %s is half-open and its trial calls are in flight", b.host))
+		}
+		b.halfOpenInFlight++
+	}
+	return b.generation, nil
+}
+
+// record registers the outcome of a call allowed in the given generation.
+func (b *circuitBreaker) record(generation uint64, failed, slow bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	switch b.state {
+	case StateHalfOpen:
+		b.halfOpenInFlight--
+		if failed {
+			b.transition(StateOpen, now)
+			return
+		}
+		b.halfOpenSuccesses++
+		if b.halfOpenSuccesses >= b.settings.HalfOpenMaxCalls {
+			b.transition(StateClosed, now)
+		}
+
+	case StateClosed:
+		current := b.currentBucket(now)
+		current.calls++
+		if failed {
+			current.failures++
+			b.consecutiveFailures++
+		} else {
+			b.consecutiveFailures = 0
+		}
+		if slow {
+			current.slow++
+		}
+		if b.shouldTrip(now) {
+			b.transition(StateOpen, now)
+		}
+	}
+}
+
+// release gives back the half-open slot of a call whose outcome is not recorded.
+func (b *circuitBreaker) release(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation == b.generation && b.state == StateHalfOpen {
+		b.halfOpenInFlight--
+	}
+}
+
+// currentBucket returns the bucket for now, resetting it if it is stale.
+func (b *circuitBreaker) currentBucket(now time.Time) *bucket {
+	width := b.settings.Window / windowBuckets
+	start := now.Truncate(width)
+	current := &b.buckets[(start.UnixNano()/int64(width))%windowBuckets]
+	if !current.start.Equal(start) {
+		*current = bucket{start: start}
+	}
+	return current
+}
+
+func (b *circuitBreaker) shouldTrip(now time.Time) bool {
+	s := b.settings
+	if s.ConsecutiveFailures > 0 && b.consecutiveFailures >= s.ConsecutiveFailures {
+		return true
+	}
+
+	var calls, failures, slow int
+	for _, bkt := range b.buckets {
+		if now.Sub(bkt.start) < s.Window {
+			calls += bkt.calls
+			failures += bkt.failures
+			slow += bkt.slow
+		}
+	}
+	if calls == 0 || calls < s.MinimumCalls {
+		return false
+	}
+	if s.FailureRatio > 0 && float64(failures)/float64(calls) >= s.FailureRatio {
+		return true
+	}
+	if s.SlowCallRatio > 0 && float64(slow)/float64(calls) >= s.SlowCallRatio {
+		return true
+	}
+	return false
+}
+
+// transition moves to a new state and resets the counters. Must be called with b.mu held.
+func (b *circuitBreaker) transition(to CircuitState, now time.Time) {
+	from := b.state
+	b.state = to
+	b.generation++
+	b.consecutiveFailures = 0
+	b.halfOpenInFlight = 0
+	b.halfOpenSuccesses = 0
+	b.buckets = [windowBuckets]bucket{}
+	if to == StateOpen {
+		b.openedAt = now
+	}
+
+	log.Printf("Circuit breaker for %s changed from %s to %s", b.host, from, to)
+	metrics.RecordCircuitBreakerTransition(b.host, from.String(), to.String(), int(to))
+}
+
+// circuitBreakerTransport applies the per-host breakers to each attempt. It
+// sits outside the tracing transport, so rejected calls never touch the network.
+type circuitBreakerTransport struct {
+	next     http.RoundTripper
+	breakers *circuitBreakers
+}
+
+func (t *circuitBreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	breaker := t.breakers.get(req.URL.Host)
+	generation, err := breaker.allow(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	elapsed := time.Since(start)
+
+	if err != nil && req.Context().Err() != nil {
+		// The caller canceled or ran out of time, which says nothing about the host.
+		breaker.release(generation)
+		return resp, err
+	}
+
+	slow := t.breakers.settings.SlowCallThreshold > 0 && elapsed >= t.breakers.settings.SlowCallThreshold
+	breaker.record(generation, t.breakers.settings.IsFailure(resp, err), slow, time.Now())
+	return resp, err
+}
@@ -0,0 +1,210 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"chaits.org/go-microservices-repo/pkg/errors"
+)
+
+// breakerStep is one call through a breaker: "ok", "fail" and "slow" are
+// allowed and recorded, "pending" is allowed and never recorded, and "reject"
+// must be refused.
+type breakerStep struct {
+	at      time.Duration
+	outcome string
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	consecutive := CircuitBreakerSettings{ConsecutiveFailures: 3, OpenTimeout: 10 * time.Second, HalfOpenMaxCalls: 1}
+	ratio := CircuitBreakerSettings{FailureRatio: 0.5, MinimumCalls: 4, Window: time.Minute}
+	slow := CircuitBreakerSettings{SlowCallRatio: 0.5, MinimumCalls: 2, Window: time.Minute}
+
+	tests := []struct {
+		name     string
+		settings CircuitBreakerSettings
+		steps    []breakerStep
+		want     CircuitState
+	}{
+		{name: "success resets consecutive failures", settings: consecutive,
+			steps: []breakerStep{{0, "fail"}, {0, "fail"}, {0, "ok"}, {0, "fail"}, {0, "fail"}}, want: StateClosed},
+		{name: "opens after consecutive failures", settings: consecutive,
+			steps: []breakerStep{{0, "fail"}, {0, "fail"}, {0, "fail"}, {time.Second, "reject"}}, want: StateOpen},
+		{name: "half-open after the open timeout", settings: consecutive,
+			steps: []breakerStep{{0, "fail"}, {0, "fail"}, {0, "fail"}, {10 * time.Second, "pending"}}, want: StateHalfOpen},
+		{name: "half-open limits trial calls", settings: consecutive,
+			steps: []breakerStep{{0, "fail"}, {0, "fail"}, {0, "fail"}, {10 * time.Second, "pending"}, {10 * time.Second, "reject"}}, want: StateHalfOpen},
+		{name: "trial success closes", settings: consecutive,
+			steps: []breakerStep{{0, "fail"}, {0, "fail"}, {0, "fail"}, {10 * time.Second, "ok"}, {10 * time.Second, "ok"}}, want: StateClosed},
+		{name: "trial failure re-opens", settings: consecutive,
+			steps: []breakerStep{{0, "fail"}, {0, "fail"}, {0, "fail"}, {10 * time.Second, "fail"}, {15 * time.Second, "reject"}}, want: StateOpen},
+		{name: "failure ratio below minimum calls", settings: ratio,
+			steps: []breakerStep{{0, "fail"}, {0, "fail"}, {0, "fail"}}, want: StateClosed},
+		{name: "failure ratio reached", settings: ratio,
+			steps: []breakerStep{{0, "ok"}, {0, "fail"}, {0, "ok"}, {0, "fail"}}, want: StateOpen},
+		{name: "failures outside the window", settings: ratio,
+			steps: []breakerStep{{0, "fail"}, {0, "fail"}, {2 * time.Minute, "ok"}, {2 * time.Minute, "fail"}, {2 * time.Minute, "ok"}, {2 * time.Minute, "ok"}}, want: StateClosed},
+		{name: "slow call ratio reached", settings: slow,
+			steps: []breakerStep{{0, "ok"}, {0, "slow"}}, want: StateOpen},
+	}
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker := newCircuitBreakers(tt.settings).get("example.com")
+			for i, step := range tt.steps {
+				now := start.Add(step.at)
+				generation, err := breaker.allow(now)
+				if (err != nil) != (step.outcome == "reject") {
+					t.Fatalf("step %d (%s): allow() error = %v", i, step.outcome, err)
+				}
+				switch step.outcome {
+				case "ok", "fail", "slow":
+					breaker.record(generation, step.outcome == "fail", step.outcome == "slow", now)
+				}
+			}
+			if breaker.state != tt.want {
+				t.Errorf("state = %s, want %s", breaker.state, tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerIgnoresStaleOutcomes(t *testing.T) {
+	breaker := newCircuitBreakers(CircuitBreakerSettings{ConsecutiveFailures: 1}).get("example.com")
+	now := time.Now()
+	stale, _ := breaker.allow(now)
+	current, _ := breaker.allow(now)
+
+	breaker.record(current, true, false, now)
+	breaker.record(stale, false, false, now)
+	if breaker.state != StateOpen {
+		t.Errorf("state = %s, want %s: a call from before the trip must not close the breaker", breaker.state, StateOpen)
+	}
+}
+
+func TestDefaultIsFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		want   bool
+	}{
+		{name: "transport error", err: errors.New(errors.INTERNAL_ERROR, "connection refused"), want: true},
+		{name: "canceled", err: context.Canceled, want: false},
+		{name: "server error", status: http.StatusBadGateway, want: true},
+		{name: "client error", status: http.StatusNotFound, want: false},
+		{name: "success", status: http.StatusOK, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp *http.Response
+			if tt.err == nil {
+				resp = &http.Response{StatusCode: tt.status}
+			}
+			if got := defaultIsFailure(resp, tt.err); got != tt.want {
+				t.Errorf("defaultIsFailure() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCircuitBreakerCallerGaveUp covers calls that failed because their own
+// context ended: they must neither trip the breaker nor hold a half-open slot.
+func TestCircuitBreakerCallerGaveUp(t *testing.T) {
+	tests := []struct {
+		name    string
+		context func() (context.Context, context.CancelFunc)
+	}{
+		{name: "canceled", context: func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			return ctx, cancel
+		}},
+		{name: "caller deadline exceeded", context: func() (context.Context, context.CancelFunc) {
+			return context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breakers := newCircuitBreakers(CircuitBreakerSettings{ConsecutiveFailures: 1, OpenTimeout: time.Millisecond})
+			transport := &circuitBreakerTransport{breakers: breakers, next: RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				if err := req.Context().Err(); err != nil {
+					return nil, err
+				}
+				return nil, errors.New(errors.INTERNAL_ERROR, "connection refused")
+			})}
+			send := func(ctx context.Context) error {
+				req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+				_, err := transport.RoundTrip(req)
+				return err
+			}
+
+			ctx, cancel := tt.context()
+			defer cancel()
+			for i := 0; i < 3; i++ {
+				send(ctx)
+			}
+			if state := breakers.get("example.com").state; state != StateClosed {
+				t.Fatalf("state = %s after calls whose caller gave up, want %s", state, StateClosed)
+			}
+
+			// Trip the breaker, wait for half-open and give up on the trial call.
+			send(context.Background())
+			time.Sleep(2 * time.Millisecond)
+			send(ctx)
+			err := send(context.Background())
+			var appErr *errors.AppError
+			if errors.As(err, &appErr) && appErr.Code == errors.CIRCUIT_OPEN_ERROR {
+				t.Errorf("trial call rejected after the previous one was abandoned: %v", err)
+			}
+		})
+	}
+}
+
+// TestCircuitBreakerPerEndpoint checks that behind a load balancer a failing
+// replica trips only its own breaker.
+func TestCircuitBreakerPerEndpoint(t *testing.T) {
+	lb := NewLoadBalancer("svc", []Endpoint{{Address: "bad"}, {Address: "good"}}, LoadBalancerConfig{})
+	defer lb.Close()
+	client := NewHTTPClient(
+		WithLoadBalancer(lb),
+		WithCircuitBreaker(CircuitBreakerSettings{ConsecutiveFailures: 2, OpenTimeout: time.Hour}),
+	)
+	transport := Chain(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "bad" {
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	}), client.defaultChain()...)
+
+	succeeded := 0
+	for i := 0; i < 10; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://svc/items", nil)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			continue
+		}
+		if resp.StatusCode == http.StatusOK {
+			succeeded++
+		}
+		resp.Body.Close()
+	}
+
+	if state := client.breakers.get("bad").state; state != StateOpen {
+		t.Errorf("breaker of the failing endpoint is %s, want %s", state, StateOpen)
+	}
+	if state := client.breakers.get("good").state; state != StateClosed {
+		t.Errorf("breaker of the healthy endpoint is %s, want %s", state, StateClosed)
+	}
+	if _, ok := client.breakers.breakers["svc"]; ok {
+		t.Error("a breaker was created for the logical service")
+	}
+	if succeeded != 5 {
+		t.Errorf("%d calls succeeded, want the 5 sent to the healthy endpoint", succeeded)
+	}
+}
@@ -0,0 +1,229 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"chaits.org/go-microservices-repo/pkg/errors"
+	"chaits.org/go-microservices-repo/pkg/general/config"
+	jwtutil "chaits.org/go-microservices-repo/pkg/security/jwt"
+)
+
+// Credential types accepted in services.<name>.credentials.type.
+const (
+	CREDENTIALS_API_KEY = "api-key"
+	CREDENTIALS_JWT     = "jwt"
+	CREDENTIALS_NONE    = "none"
+)
+
+// ANY_TARGET maps credentials to every target without a mapping of its own.
+const ANY_TARGET = "*"
+
+// Credentials authenticate outgoing requests.
+type Credentials interface {
+	// Apply adds the credentials to the request.
+	Apply(ctx context.Context, req *http.Request) error
+	// Refresh drops cached credentials after the target rejected them.
+	Refresh(ctx context.Context) error
+}
+
+// SecretStore looks up secrets by name.
+type SecretStore interface {
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+// EnvSecretStore reads secrets from environment variables.
+type EnvSecretStore struct{}
+
+func (EnvSecretStore) GetSecret(ctx context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return "", errors.New(errors.SECRET_NOT_FOUND_ERROR, fmt.Sprintf("secret %s is not set", name))
+	}
+	return value, nil
+}
+
+// APIKeyCredentials sends X-App-Name and X-API-Key, as expected by
+// middleware.WithAPIKeyAuth. The key is read from the secret store once and
+// again after a refresh.
+type APIKeyCredentials struct {
+	appName    string
+	store      SecretStore
+	secretName string
+
+	mu     sync.Mutex
+	apiKey string
+}
+
+func NewAPIKeyCredentials(appName string, store SecretStore, secretName string) *APIKeyCredentials {
+	return &APIKeyCredentials{appName: appName, store: store, secretName: secretName}
+}
+
+func (c *APIKeyCredentials) Apply(ctx context.Context, req *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.apiKey == "" {
+		apiKey, err := c.store.GetSecret(ctx, c.secretName)
+		if err != nil {
+			return err
+		}
+		c.apiKey = apiKey
+	}
+	req.Header.Set("X-App-Name", c.appName)
+	req.Header.Set("X-API-Key", c.apiKey)
+	return nil
+}
+
+func (c *APIKeyCredentials) Refresh(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.apiKey = ""
+	return nil
+}
+
+// JWTCredentials sends a bearer token minted with pkg/security/jwt. The token
+// is cached and minted again once less than RefreshBefore of it is left.
+type JWTCredentials struct {
+	subject  string
+	roles    []string
+	audience string
+	ttl      time.Duration
+	// RefreshBefore is how long before expiry a new token is minted. Defaults to a fifth of the TTL.
+	RefreshBefore time.Duration
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func NewJWTCredentials(subject string, roles []string, audience string, ttl time.Duration) *JWTCredentials {
+	if ttl <= 0 {
+		ttl = 15 * time.Minute
+	}
+	return &JWTCredentials{subject: subject, roles: roles, audience: audience, ttl: ttl, RefreshBefore: ttl / 5}
+}
+
+func (c *JWTCredentials) Apply(ctx context.Context, req *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == "" || time.Until(c.expiresAt) < c.RefreshBefore {
+		token, expiresAt, err := jwtutil.GenerateTokenWithTTL(c.subject, c.roles, c.audience, c.ttl)
+		if err != nil {
+			return err
+		}
+		c.token, c.expiresAt = token, expiresAt
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	return nil
+}
+
+func (c *JWTCredentials) Refresh(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = ""
+	return nil
+}
+
+// WithCredentials authenticates requests to target, a host such as
+// "localhost:8080" or a load balanced service name such as "onboarding".
+// ANY_TARGET applies to targets without a mapping of their own.
+func WithCredentials(target string, credentials Credentials) Option {
+	return func(h *HTTPClient) {
+		if h.credentials == nil {
+			h.credentials = make(map[string]Credentials)
+		}
+		h.credentials[target] = credentials
+	}
+}
+
+// CredentialsFromConfig builds the credentials of services.<service>.credentials,
+// or returns nil when the service needs none.
+func CredentialsFromConfig(appConfig *config.AppConfig, service string) Credentials {
+	prefix := "services." + service + ".credentials."
+	switch appConfig.GetConfig(prefix + "type") {
+	case CREDENTIALS_API_KEY:
+		return NewAPIKeyCredentials(appConfig.GetConfig(prefix+"app_name"), EnvSecretStore{}, appConfig.GetConfig(prefix+"api_key_secret"))
+	case CREDENTIALS_JWT:
+		jwt := NewJWTCredentials(appConfig.GetConfig(prefix+"subject"), appConfig.GetStringSlice(prefix+"roles"),
+			appConfig.GetConfig(prefix+"audience"), appConfig.GetDuration(prefix+"ttl"))
+		if appConfig.IsSet(prefix + "refresh_before") {
+			jwt.RefreshBefore = appConfig.GetDuration(prefix + "refresh_before")
+		}
+		return jwt
+	default:
+		return nil
+	}
+}
+
+// LoadJWTSigningKey reads the secret named by auth.jwt.signing_key_secret from
+// store and sets it as the key that signs and validates bearer tokens.
+// Services that accept or send bearer tokens must not start if it fails.
+func LoadJWTSigningKey(ctx context.Context, appConfig *config.AppConfig, store SecretStore) error {
+	name := appConfig.GetConfig("auth.jwt.signing_key_secret")
+	if name == "" {
+		return errors.New(errors.SECRET_NOT_FOUND_ERROR, "auth.jwt.signing_key_secret is not configured")
+	}
+	key, err := store.GetSecret(ctx, name)
+	if err != nil {
+		return err
+	}
+	return jwtutil.SetSigningKey([]byte(key))
+}
+
+// credentialsTransport adds the credentials mapped to the target host. A 401
+// refreshes the credentials and the request is sent once more through the
+// rest of the chain.
+type credentialsTransport struct {
+	next        http.RoundTripper
+	credentials map[string]Credentials
+}
+
+func (t *credentialsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	credentials, ok := t.credentials[req.URL.Host]
+	if !ok {
+		credentials, ok = t.credentials[ANY_TARGET]
+	}
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+	out := req.Clone(ctx)
+	if err := credentials.Apply(ctx, out); err != nil {
+		return nil, errors.Wrap(errors.CREDENTIALS_ERROR, fmt.Sprintf("adding credentials for %s", req.URL.Host), err)
+	}
+	resp, err := t.next.RoundTrip(out)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// The body was consumed; only retry when it can be replayed.
+	hasBody := req.Body != nil && req.Body != http.NoBody
+	if hasBody && req.GetBody == nil {
+		return resp, nil
+	}
+	log.Printf("%s rejected the credentials, refreshing them and retrying once", req.URL.Host)
+	if err := credentials.Refresh(ctx); err != nil {
+		log.Printf("Refreshing credentials for %s failed: %v", req.URL.Host, err)
+		return resp, nil
+	}
+
+	retry := req.Clone(ctx)
+	if hasBody {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+	if err := credentials.Apply(ctx, retry); err != nil {
+		return resp, nil
+	}
+	discard(resp)
+	return t.next.RoundTrip(retry)
+}
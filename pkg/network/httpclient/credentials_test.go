@@ -0,0 +1,183 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwtutil "chaits.org/go-microservices-repo/pkg/security/jwt"
+)
+
+func TestJWTCredentialsRefreshWindow(t *testing.T) {
+	if err := jwtutil.SetSigningKey([]byte("0123456789abcdef0123456789abcdef")); err != nil {
+		t.Fatalf("SetSigningKey() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		expiresIn  time.Duration
+		refresh    bool
+		wantReused bool
+	}{
+		{name: "no token yet", wantReused: false},
+		{name: "outside the refresh window", token: "cached", expiresIn: 10 * time.Minute, wantReused: true},
+		{name: "inside the refresh window", token: "cached", expiresIn: 2 * time.Minute, wantReused: false},
+		{name: "expired", token: "cached", expiresIn: -time.Minute, wantReused: false},
+		{name: "refreshed after a 401", token: "cached", expiresIn: 10 * time.Minute, refresh: true, wantReused: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A 15 minute TTL is refreshed in its last 3 minutes.
+			creds := NewJWTCredentials("billing", []string{"reader"}, "onboarding", 15*time.Minute)
+			creds.token, creds.expiresAt = tt.token, time.Now().Add(tt.expiresIn)
+			if tt.refresh {
+				creds.Refresh(context.Background())
+			}
+
+			req, _ := http.NewRequest(http.MethodGet, "http://onboarding/hello", nil)
+			if err := creds.Apply(context.Background(), req); err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			reused := req.Header.Get("Authorization") == "Bearer cached"
+			if reused != tt.wantReused {
+				t.Errorf("cached token reused = %v, want %v", reused, tt.wantReused)
+			}
+			if !reused {
+				claims, err := jwtutil.ValidateToken(strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "), "onboarding")
+				if err != nil || claims.Subject != "billing" {
+					t.Errorf("minted token is not valid for onboarding: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// secretCounter is a SecretStore that counts its lookups.
+type secretCounter struct{ lookups atomic.Int32 }
+
+func (s *secretCounter) GetSecret(ctx context.Context, name string) (string, error) {
+	return fmt.Sprintf("key-%d", s.lookups.Add(1)), nil
+}
+
+func TestAPIKeyCredentials(t *testing.T) {
+	store := &secretCounter{}
+	creds := NewAPIKeyCredentials("billing", store, "BILLING_API_KEY")
+	apply := func() string {
+		req, _ := http.NewRequest(http.MethodGet, "http://onboarding/hello", nil)
+		if err := creds.Apply(context.Background(), req); err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+		if app := req.Header.Get("X-App-Name"); app != "billing" {
+			t.Errorf("X-App-Name = %q, want billing", app)
+		}
+		return req.Header.Get("X-API-Key")
+	}
+
+	if first, second := apply(), apply(); first != "key-1" || second != "key-1" {
+		t.Errorf("keys = %s, %s, want the key read once", first, second)
+	}
+	creds.Refresh(context.Background())
+	if key := apply(); key != "key-2" {
+		t.Errorf("key after Refresh() = %s, want it read again", key)
+	}
+}
+
+// versionedCredentials sends the number of refreshes as the credential.
+type versionedCredentials struct{ refreshes atomic.Int32 }
+
+func (c *versionedCredentials) Apply(ctx context.Context, req *http.Request) error {
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer v%d", c.refreshes.Load()))
+	return nil
+}
+
+func (c *versionedCredentials) Refresh(ctx context.Context) error {
+	c.refreshes.Add(1)
+	return nil
+}
+
+func TestCredentialsTransportRetriesOnce(t *testing.T) {
+	tests := []struct {
+		name string
+		// accepted is the credential the target accepts, empty for none.
+		accepted   string
+		body       func() io.Reader
+		wantCalls  int32
+		wantStatus int
+	}{
+		{name: "refreshed credentials accepted", accepted: "Bearer v1", wantCalls: 2, wantStatus: http.StatusOK},
+		{name: "refreshed credentials rejected too", wantCalls: 2, wantStatus: http.StatusUnauthorized},
+		{name: "replayable body is sent again", accepted: "Bearer v1",
+			body: func() io.Reader { return strings.NewReader(`{"name":"billing"}`) }, wantCalls: 2, wantStatus: http.StatusOK},
+		{name: "one-shot body is not retried", accepted: "Bearer v1",
+			body: func() io.Reader { return io.MultiReader(strings.NewReader(`{"name":"billing"}`)) }, wantCalls: 1, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			creds := &versionedCredentials{}
+			transport := AuthInterceptor(map[string]Credentials{"onboarding": creds})(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				calls.Add(1)
+				if req.Body != nil {
+					body, _ := io.ReadAll(req.Body)
+					if string(body) != `{"name":"billing"}` {
+						t.Errorf("attempt %d sent body %q", calls.Load(), body)
+					}
+				}
+				status := http.StatusUnauthorized
+				if tt.accepted != "" && req.Header.Get("Authorization") == tt.accepted {
+					status = http.StatusOK
+				}
+				return &http.Response{StatusCode: status, Body: http.NoBody}, nil
+			}))
+
+			var body io.Reader
+			method := http.MethodGet
+			if tt.body != nil {
+				body, method = tt.body(), http.MethodPost
+			}
+			req, _ := http.NewRequest(method, "http://onboarding/apps", body)
+			resp, err := transport.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("RoundTrip() error = %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("target saw %d requests, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCredentialsTransportTargets(t *testing.T) {
+	onboarding, fallback := &versionedCredentials{}, &versionedCredentials{}
+	fallback.refreshes.Store(7)
+	transport := AuthInterceptor(map[string]Credentials{"onboarding": onboarding, ANY_TARGET: fallback})(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	}))
+
+	for host, want := range map[string]string{"onboarding": "Bearer v0", "registry": "Bearer v7"} {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+host+"/hello", nil)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip() error = %v", err)
+		}
+		if got := resp.Request.Header.Get("Authorization"); got != want {
+			t.Errorf("%s got credential %q, want %q", host, got, want)
+		}
+		if req.Header.Get("Authorization") != "" {
+			t.Errorf("credentials were added to the caller's request")
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"chaits.org/go-microservices-repo/pkg/general/metrics"
+)
+
+// Outcomes reported on hedged_requests_total.
+const (
+	HEDGE_OUTCOME_SENT             = "sent"
+	HEDGE_OUTCOME_BUDGET_EXHAUSTED = "budget_exhausted"
+)
+
+const (
+	// hedgeLatencySamples is the number of recent call latencies kept for the percentile.
+	hedgeLatencySamples = 128
+	// hedgeMinSamples is the number of samples needed before the percentile replaces Delay.
+	hedgeMinSamples = 20
+	// maxHedgeTokens bounds the hedges that can be saved up while traffic is quiet.
+	maxHedgeTokens = 10
+)
+
+// HedgePolicy configures hedged requests: when a call has not answered after
+// a delay, the same request is sent again and the first good response wins.
+type HedgePolicy struct {
+	// Delay is how long to wait before sending a hedge. When Percentile is set
+	// it is only used until enough latencies have been observed. Defaults to 100ms.
+	Delay time.Duration
+
+	// Percentile, between 0 and 1, sends a hedge once the call has taken longer
+	// than this percentile of recent calls, e.g. 0.95.
+	Percentile float64
+
+	// MaxHedges is the number of extra requests a single call may send. Defaults to 1.
+	MaxHedges int
+
+	// MaxExtraLoad caps hedges as a fraction of all calls, e.g. 0.1 allows one
+	// hedge per ten calls on average. Defaults to 0.1.
+	MaxExtraLoad float64
+
+	// Methods are the request methods that are hedged. Defaults to GET and
+	// HEAD. Hedges run concurrently with the original request, so only add
+	// methods the server handles safely in parallel; an Idempotency-Key does
+	// not make that true.
+	Methods []string
+}
+
+// WithHedging sends hedged requests for GET and HEAD calls, or the methods of
+// policy.Methods, as described by policy. Latencies are tracked per client, so use one client per dependency.
+func WithHedging(policy HedgePolicy) Option {
+	return func(h *HTTPClient) {
+		h.hedger = newHedger(policy)
+	}
+}
+
+// hedger tracks recent latencies and the extra load budget of one client.
+type hedger struct {
+	policy HedgePolicy
+
+	mu        sync.Mutex
+	latencies [hedgeLatencySamples]time.Duration
+	count     int
+	next      int
+	tokens    float64
+}
+
+func newHedger(policy HedgePolicy) *hedger {
+	if policy.Delay <= 0 {
+		policy.Delay = 100 * time.Millisecond
+	}
+	if policy.MaxHedges <= 0 {
+		policy.MaxHedges = 1
+	}
+	if policy.MaxExtraLoad <= 0 {
+		policy.MaxExtraLoad = 0.1
+	}
+	if len(policy.Methods) == 0 {
+		policy.Methods = []string{http.MethodGet, http.MethodHead}
+	}
+	return &hedger{policy: policy}
+}
+
+// delay returns the wait before the next hedge.
+func (h *hedger) delay() time.Duration {
+	if h.policy.Percentile <= 0 || h.policy.Percentile >= 1 {
+		return h.policy.Delay
+	}
+
+	h.mu.Lock()
+	if h.count < hedgeMinSamples {
+		h.mu.Unlock()
+		return h.policy.Delay
+	}
+	samples := make([]time.Duration, h.count)
+	copy(samples, h.latencies[:h.count])
+	h.mu.Unlock()
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	return samples[int(float64(len(samples)-1)*h.policy.Percentile)]
+}
+
+func (h *hedger) observe(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.latencies[h.next] = latency
+	h.next = (h.next + 1) % hedgeLatencySamples
+	if h.count < hedgeLatencySamples {
+		h.count++
+	}
+}
+
+// deposit adds the share of a hedge that every call earns.
+func (h *hedger) deposit() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tokens += h.policy.MaxExtraLoad
+	if h.tokens > maxHedgeTokens {
+		h.tokens = maxHedgeTokens
+	}
+}
+
+// withdraw spends the budget for one hedge, if there is enough.
+func (h *hedger) withdraw() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.tokens < 1 {
+		return false
+	}
+	h.tokens--
+	return true
+}
+
+type hedgeResult struct {
+	index   int
+	resp    *http.Response
+	err     error
+	latency time.Duration
+}
+
+func (r hedgeResult) ok() bool {
+	return r.err == nil && r.resp.StatusCode < http.StatusInternalServerError
+}
+
+// hedgingTransport races the original request against hedges sent after the
+// hedger's delay. It sits outside the tracing transport, so every request it
+// sends is its own client span.
+type hedgingTransport struct {
+	next   http.RoundTripper
+	hedger *hedger
+}
+
+func (t *hedgingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.hedger.deposit()
+
+	// Only the hedged methods are sent more than once, and only when their body can be replayed.
+	hasBody := req.Body != nil && req.Body != http.NoBody
+	if !slices.Contains(t.hedger.policy.Methods, req.Method) || (hasBody && req.GetBody == nil) {
+		return t.next.RoundTrip(req)
+	}
+
+	dependency := DependencyName(req)
+	maxRequests := 1 + t.hedger.policy.MaxHedges
+	results := make(chan hedgeResult, maxRequests)
+	cancels := make([]context.CancelFunc, 0, maxRequests)
+
+	launch := func(index int) error {
+		ctx, cancel := context.WithCancel(req.Context())
+		attemptReq := req.Clone(ctx)
+		if index > 0 && hasBody {
+			body, err := req.GetBody()
+			if err != nil {
+				cancel()
+				return err
+			}
+			attemptReq.Body = body
+		}
+		cancels = append(cancels, cancel)
+		go func() {
+			start := time.Now()
+			resp, err := t.next.RoundTrip(attemptReq)
+			results <- hedgeResult{index: index, resp: resp, err: err, latency: time.Since(start)}
+		}()
+		return nil
+	}
+
+	if err := launch(0); err != nil {
+		return nil, err
+	}
+	inFlight := 1
+	timer := time.NewTimer(t.hedger.delay())
+	defer timer.Stop()
+
+	var fallback *hedgeResult
+	for {
+		select {
+		case <-timer.C:
+			if len(cancels) >= maxRequests {
+				continue
+			}
+			if !t.hedger.withdraw() {
+				metrics.RecordHedgedRequest(dependency, HEDGE_OUTCOME_BUDGET_EXHAUSTED)
+				continue
+			}
+			if err := launch(len(cancels)); err != nil {
+				continue
+			}
+			inFlight++
+			metrics.RecordHedgedRequest(dependency, HEDGE_OUTCOME_SENT)
+			if len(cancels) < maxRequests {
+				timer.Reset(t.hedger.delay())
+			}
+
+		case result := <-results:
+			inFlight--
+			if result.ok() {
+				t.hedger.observe(result.latency)
+				if result.index > 0 {
+					metrics.IncrementHedgeWins(dependency)
+				}
+				if fallback != nil {
+					discard(fallback.resp)
+					cancels[fallback.index]()
+				}
+				return t.finish(result, cancels, results, inFlight)
+			}
+
+			// Keep the first failure in case no request succeeds.
+			if fallback == nil {
+				fallback = &result
+			} else {
+				discard(result.resp)
+				cancels[result.index]()
+			}
+			if inFlight == 0 {
+				return t.finish(*fallback, cancels, results, inFlight)
+			}
+		}
+	}
+}
+
+// finish cancels the losing requests and returns the chosen result. The
+// winner's context is cancelled once its body is closed.
+func (t *hedgingTransport) finish(result hedgeResult, cancels []context.CancelFunc, results chan hedgeResult, inFlight int) (*http.Response, error) {
+	for i, cancel := range cancels {
+		if i != result.index {
+			cancel()
+		}
+	}
+	// Close whatever the losers return once they notice the cancellation.
+	go func() {
+		for ; inFlight > 0; inFlight-- {
+			discard((<-results).resp)
+		}
+	}()
+
+	if result.err != nil {
+		cancels[result.index]()
+		return nil, result.err
+	}
+	result.resp.Body = &closeHook{ReadCloser: result.resp.Body, hook: cancels[result.index]}
+	return result.resp, nil
+}
+
+// closeHook runs hook once when the response body is closed, e.g. to release
+// the request's context.
+type closeHook struct {
+	io.ReadCloser
+	once sync.Once
+	hook func()
+}
+
+func (b *closeHook) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.hook)
+	return err
+}
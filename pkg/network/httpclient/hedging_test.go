@@ -0,0 +1,158 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowFirstTransport answers the first request after 100ms, or when it is
+// canceled, and every later request at once. Bodies carry the request number.
+func slowFirstTransport(calls *atomic.Int32) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		n := calls.Add(1)
+		if n == 1 {
+			select {
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(strconv.Itoa(int(n))))}, nil
+	})
+}
+
+func TestHedgingMethods(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		methods    []string
+		body       string
+		getBody    bool
+		wantCalls  int32
+		wantWinner string
+	}{
+		{name: "GET is hedged", method: http.MethodGet, wantCalls: 2, wantWinner: "2"},
+		{name: "HEAD is hedged", method: http.MethodHead, wantCalls: 2, wantWinner: "2"},
+		{name: "POST is not hedged by default", method: http.MethodPost, body: "{}", getBody: true, wantCalls: 1, wantWinner: "1"},
+		{name: "PUT is not hedged by default", method: http.MethodPut, body: "{}", getBody: true, wantCalls: 1, wantWinner: "1"},
+		{name: "opted-in POST is hedged", method: http.MethodPost, methods: []string{http.MethodPost}, body: "{}", getBody: true, wantCalls: 2, wantWinner: "2"},
+		{name: "opted-in POST without GetBody is not hedged", method: http.MethodPost, methods: []string{http.MethodPost}, body: "{}", wantCalls: 1, wantWinner: "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			transport := &hedgingTransport{
+				next:   slowFirstTransport(&calls),
+				hedger: newHedger(HedgePolicy{Delay: 10 * time.Millisecond, MaxExtraLoad: 1, Methods: tt.methods}),
+			}
+			req, _ := http.NewRequest(tt.method, "http://example.com", nil)
+			if tt.body != "" {
+				req.Body = io.NopCloser(strings.NewReader(tt.body))
+				if tt.getBody {
+					req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(tt.body)), nil }
+				}
+			}
+
+			resp, err := transport.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("RoundTrip() error = %v", err)
+			}
+			winner, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("sent %d requests, want %d", got, tt.wantCalls)
+			}
+			if string(winner) != tt.wantWinner {
+				t.Errorf("response of request %s returned, want %s", winner, tt.wantWinner)
+			}
+		})
+	}
+}
+
+func TestHedgingBudget(t *testing.T) {
+	var calls atomic.Int32
+	transport := &hedgingTransport{
+		next:   slowFirstTransport(&calls),
+		hedger: newHedger(HedgePolicy{Delay: 10 * time.Millisecond, MaxExtraLoad: 0.5}),
+	}
+
+	// Each call earns half a hedge, so only the second call may send one.
+	for i, wantCalls := range []int32{1, 2} {
+		calls.Store(0)
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip() error = %v", err)
+		}
+		resp.Body.Close()
+		if got := calls.Load(); got != wantCalls {
+			t.Errorf("call %d sent %d requests, want %d", i, got, wantCalls)
+		}
+	}
+}
+
+func TestHedgerDelay(t *testing.T) {
+	tests := []struct {
+		name       string
+		percentile float64
+		samples    int
+		want       time.Duration
+	}{
+		{name: "fixed delay", samples: 100, want: 50 * time.Millisecond},
+		{name: "too few samples", percentile: 0.9, samples: hedgeMinSamples - 1, want: 50 * time.Millisecond},
+		{name: "percentile", percentile: 0.9, samples: 100, want: 90 * time.Millisecond},
+		{name: "percentile of the latest samples", percentile: 0.5, samples: hedgeLatencySamples + 100, want: 164 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHedger(HedgePolicy{Delay: 50 * time.Millisecond, Percentile: tt.percentile})
+			for i := 1; i <= tt.samples; i++ {
+				h.observe(time.Duration(i) * time.Millisecond)
+			}
+			if got := h.delay(); got != tt.want {
+				t.Errorf("delay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHedgingCancelsLosers(t *testing.T) {
+	loserDone := make(chan error, 1)
+	var calls atomic.Int32
+	transport := &hedgingTransport{
+		next: RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if calls.Add(1) == 1 {
+				<-req.Context().Done()
+				loserDone <- req.Context().Err()
+				return nil, req.Context().Err()
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}),
+		hedger: newHedger(HedgePolicy{Delay: time.Millisecond, MaxExtraLoad: 1}),
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	select {
+	case err := <-loserDone:
+		if err != context.Canceled {
+			t.Errorf("losing request ended with %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("losing request was not canceled")
+	}
+}
@@ -1,105 +1,157 @@
 package httpclient
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"io"
-	"log"
 	"net/http"
 	"time"
 
 	"chaits.org/go-microservices-repo/pkg/errors"
+	"chaits.org/go-microservices-repo/pkg/general/bulkhead"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type HTTPClient struct {
-	httpclient   *http.Client
-	retryOptions *retryOptions
-}
-
-type retryOptions struct {
-	// MaxRetries is the maximum number of times to retry a failed request.
-	MaxRetries int
+const tracerName = "httpclient"
 
-	// Backoff is the base time duration for exponential backoff between retries.
-	Backoff time.Duration
-
-	// RetryableStatusCodes is a map of HTTP status codes that should trigger a retry.
-	RetryableStatusCodes map[int]bool
+type HTTPClient struct {
+	httpclient  *http.Client
+	retryPolicy *RetryPolicy
+
+	// dependencyName labels spans and dependency metrics. Defaults to the request host.
+	dependencyName string
+	tracer         trace.Tracer
+
+	// idempotencyKeys is set by WithIdempotencyKeys.
+	idempotencyKeys bool
+	// maxResponseBytes limits bodies read by the JSON helpers. Zero means DEFAULT_MAX_RESPONSE_BYTES.
+	maxResponseBytes int64
+
+	// bulkheads is nil unless WithBulkhead is used.
+	bulkheads *bulkhead.Group
+	// breakers is nil unless WithCircuitBreaker is used.
+	breakers *circuitBreakers
+	// hedger is nil unless WithHedging is used.
+	hedger *hedger
+	// balancers maps logical service names to their load balancers.
+	balancers map[string]*LoadBalancer
+	// credentials maps target hosts to the credentials sent to them.
+	credentials map[string]Credentials
+
+	// cache is nil unless WithCache is used.
+	cache CacheStore
+	// recorder is nil unless WithRecorder is used.
+	recorder *Recorder
+
+	// timeout is the per-attempt timeout set by WithTimeout.
+	timeout time.Duration
+	// requestLogging is set by WithRequestLogging.
+	requestLogging bool
+	// connectionTiming and slowThreshold are set by WithConnectionTiming.
+	connectionTiming bool
+	slowThreshold    time.Duration
+	// interceptors are the custom interceptors of the default chain.
+	interceptors []Interceptor
+	// chain replaces the default chain when set by WithChain.
+	chain []Interceptor
 }
 
 type Option func(*HTTPClient)
 
+// NewHTTPClient returns a client whose requests are traced and measured. Each
+// attempt is a client span that carries the trace context to the callee.
+// Requests go through the interceptors enabled by the options, or through the
+// explicit chain given with WithChain.
 func NewHTTPClient(opts ...Option) *HTTPClient {
 	httpClient := &HTTPClient{
-		httpclient:   &http.Client{},
-		retryOptions: nil,
+		httpclient:  &http.Client{},
+		retryPolicy: nil,
+		tracer:      otel.Tracer(tracerName),
 	}
 
 	for _, opt := range opts {
 		opt(httpClient)
 	}
+
+	baseTransport := httpClient.httpclient.Transport
+	if baseTransport == nil {
+		baseTransport = http.DefaultTransport
+	}
+	chain := httpClient.chain
+	if chain == nil {
+		chain = httpClient.defaultChain()
+	}
+	httpClient.httpclient.Transport = Chain(baseTransport, chain...)
 	return httpClient
 }
 
+// WithTimeout bounds each attempt, including reading the response body.
 func WithTimeout(timeDuration time.Duration) Option {
 	return func(h *HTTPClient) {
-		h.httpclient.Timeout = timeDuration
+		h.timeout = timeDuration
 	}
 }
 
-func WithRetry(maxRetries int, backOffDuration time.Duration, retryableStatusCodes ...int) Option {
+// WithDependencyName sets the name under which calls are reported in spans
+// and in the dependency_* metrics, e.g. "onboarding".
+func WithDependencyName(name string) Option {
 	return func(h *HTTPClient) {
-		statusCodeMap := make(map[int]bool)
-		for _, statusCode := range retryableStatusCodes {
-			statusCodeMap[statusCode] = true
-		}
-		h.retryOptions = &retryOptions{
-			MaxRetries:           maxRetries,
-			Backoff:              backOffDuration,
-			RetryableStatusCodes: statusCodeMap,
-		}
+		h.dependencyName = name
 	}
 }
 
+// Do sends the request with ctx through the interceptor chain. The whole call,
+// including retries, is one span with a "retry" event per retry.
 func (h *HTTPClient) Do(ctx context.Context, req *http.Request) (*http.Response, error) {
-
-	// No retry options configured, just execute the request once.
-	if h.retryOptions == nil {
-		return h.httpclient.Do(req)
-	}
-
-	var resp *http.Response
-	var err error
-
-	var reqBody []byte
-	if req.Body != nil {
-		reqBody, err = io.ReadAll(req.Body)
-		if err != nil {
+	dependency := h.dependencyFor(req)
+	ctx, span := h.tracer.Start(withDependencyName(ctx, dependency), fmt.Sprintf("%s %s", req.Method, dependency),
+		trace.WithAttributes(
+			attribute.String("http.method", req.Method),
+			attribute.String("http.url", req.URL.String()),
+			attribute.String("peer.service", dependency),
+		))
+	defer span.End()
+	req = req.WithContext(ctx)
+
+	if h.idempotencyKeys {
+		if err := ensureIdempotencyKey(req); err != nil {
 			return nil, err
 		}
-		req.Body.Close()
 	}
 
-	for i := 0; i < h.retryOptions.MaxRetries; i++ {
-		if reqBody != nil {
-			req.Body = io.NopCloser(bytes.NewBuffer(reqBody))
-		}
-
-		resp, err = h.httpclient.Do(req)
-		if err == nil && !h.retryOptions.RetryableStatusCodes[resp.StatusCode] {
-			log.Printf("Not Retrying because Status Code : %d\n", resp.StatusCode)
-			return resp, nil
+	resp, err := h.send(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+		if resp.StatusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
 		}
+	}
+	return resp, err
+}
 
-		if i == h.retryOptions.MaxRetries {
-			return resp, errors.New(errors.ALL_RETRIES_FAILED_ERROR, fmt.Sprintf("all %d attempts failed, last error: %v", h.retryOptions.MaxRetries, err))
+// send runs the request through the chain. Errors raised by the interceptors,
+// such as circuit breaker rejections and exhausted retries, are returned as the
+// *errors.AppError itself rather than wrapped in a *url.Error.
+func (h *HTTPClient) send(req *http.Request) (*http.Response, error) {
+	resp, err := h.httpclient.Do(req)
+	if err != nil {
+		var appErr *errors.AppError
+		if errors.As(err, &appErr) {
+			return nil, appErr
 		}
-
-		backOffDuration := h.retryOptions.Backoff * (1 << i)
-		log.Printf("Request Failed. (attempt %d of %d). Retrying in %v seconds.", i+1, h.retryOptions.MaxRetries, backOffDuration)
-		time.Sleep(backOffDuration)
 	}
+	return resp, err
+}
 
-	return nil, fmt.Errorf("unexpected error after all retries")
+// dependencyFor returns the configured dependency name, or the request host.
+func (h *HTTPClient) dependencyFor(req *http.Request) string {
+	if h.dependencyName != "" {
+		return h.dependencyName
+	}
+	return req.URL.Host
 }
@@ -0,0 +1,131 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"chaits.org/go-microservices-repo/pkg/errors"
+	"chaits.org/go-microservices-repo/pkg/general/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanAttr returns the value of key on span, or an invalid value.
+func spanAttr(span tracetest.SpanStub, key string) attribute.Value {
+	for _, attr := range span.Attributes {
+		if string(attr.Key) == key {
+			return attr.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestDoSpanAndMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus string
+		wantCode   codes.Code
+		wantErr    bool
+	}{
+		{name: "success", url: server.URL + "/hello", wantStatus: "200", wantCode: codes.Unset},
+		{name: "server error", url: server.URL + "/down", wantStatus: "503", wantCode: codes.Error},
+		{name: "transport error", url: "http://127.0.0.1:1/hello", wantStatus: "error", wantCode: codes.Error, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := tracetest.NewInMemoryExporter()
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			client := NewHTTPClient(WithDependencyName("onboarding-do"))
+			client.tracer = provider.Tracer(tracerName)
+			requests := metrics.DependencyRequestsTotal.WithLabelValues("onboarding-do", tt.wantStatus)
+			before := testutil.ToFloat64(requests)
+
+			req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+			resp, err := client.Do(context.Background(), req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				resp.Body.Close()
+			}
+
+			if got := testutil.ToFloat64(requests) - before; got != 1 {
+				t.Errorf("dependency_requests_total{status=%q} grew by %v, want 1", tt.wantStatus, got)
+			}
+			// The attempt span ends when its body is closed, so it may end last.
+			spans := exporter.GetSpans()
+			if len(spans) != 2 {
+				t.Fatalf("%d spans ended, want the call and its attempt", len(spans))
+			}
+			span, attempt := spans[0], spans[1]
+			if span.Parent.IsValid() {
+				span, attempt = attempt, span
+			}
+			if attempt.Parent.SpanID() != span.SpanContext.SpanID() || attempt.SpanKind != trace.SpanKindClient {
+				t.Errorf("attempt span %q is not a client span under the call span", attempt.Name)
+			}
+			if span.Name != "GET onboarding-do" || spanAttr(span, "peer.service").AsString() != "onboarding-do" {
+				t.Errorf("span %q peer.service %q, want GET onboarding-do", span.Name, spanAttr(span, "peer.service").AsString())
+			}
+			if span.Status.Code != tt.wantCode {
+				t.Errorf("span status = %v, want %v", span.Status.Code, tt.wantCode)
+			}
+			if status := spanAttr(span, "http.status_code"); !tt.wantErr && status.AsInt64() == 0 {
+				t.Error("span lacks http.status_code")
+			}
+			if tt.wantErr && len(span.Events) == 0 {
+				t.Error("span did not record the error")
+			}
+		})
+	}
+}
+
+func TestSendUnwrapsAppError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantAppErr bool
+	}{
+		{name: "interceptor error", err: errors.New(errors.CIRCUIT_OPEN_ERROR, "circuit open"), wantAppErr: true},
+		{name: "transport error", err: context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewHTTPClient()
+			client.httpclient.Transport = RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return nil, tt.err
+			})
+
+			req, _ := http.NewRequest(http.MethodGet, "http://onboarding/hello", nil)
+			_, err := client.Do(context.Background(), req)
+			if _, ok := err.(*errors.AppError); ok != tt.wantAppErr {
+				t.Errorf("Do() error = %T %v, want an *errors.AppError: %v", err, err, tt.wantAppErr)
+			}
+			if _, ok := err.(*url.Error); ok == tt.wantAppErr {
+				t.Errorf("Do() error = %T %v, want a *url.Error: %v", err, err, !tt.wantAppErr)
+			}
+			if !errors.Is(err, tt.err) && err != tt.err {
+				t.Errorf("Do() error = %v, want it to wrap %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package httpclient
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+)
+
+// IDEMPOTENCY_KEY_HEADER lets the server recognise repeated attempts of the
+// same non-idempotent request.
+const IDEMPOTENCY_KEY_HEADER = "Idempotency-Key"
+
+// WithIdempotencyKeys attaches a generated Idempotency-Key to POST and PATCH
+// requests that do not carry one. The same key is sent on every attempt, which
+// makes these requests eligible for retries.
+func WithIdempotencyKeys() Option {
+	return func(h *HTTPClient) {
+		h.idempotencyKeys = true
+	}
+}
+
+// isIdempotent reports whether repeating the request cannot cause a duplicate
+// side effect: the method is idempotent per RFC 9110, or the request carries
+// an Idempotency-Key.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get(IDEMPOTENCY_KEY_HEADER) != ""
+}
+
+// ensureIdempotencyKey sets an Idempotency-Key on non-idempotent requests that
+// lack one. req must be a copy owned by the client: its Header is replaced by
+// a clone, so the caller's headers, which may be shared between requests, are
+// left alone.
+func ensureIdempotencyKey(req *http.Request) error {
+	if isIdempotent(req) {
+		return nil
+	}
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	req.Header = req.Header.Clone()
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	req.Header.Set(IDEMPOTENCY_KEY_HEADER, hex.EncodeToString(key))
+	return nil
+}
+
+// writeTracker records whether any part of the request reached the connection.
+// An error before that point (DNS, dial, TLS handshake) means the server never
+// saw the request, so it is safe to retry whatever the method.
+type writeTracker struct {
+	started atomic.Bool
+}
+
+func (t *writeTracker) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		WroteHeaderField: func(string, []string) { t.started.Store(true) },
+		WroteRequest:     func(httptrace.WroteRequestInfo) { t.started.Store(true) },
+	}
+}
+
+// withWriteTracker returns a copy of req that reports its writes to a new tracker.
+func withWriteTracker(req *http.Request) (*http.Request, *writeTracker) {
+	tracker := &writeTracker{}
+	ctx := httptrace.WithClientTrace(req.Context(), tracker.trace())
+	return req.WithContext(ctx), tracker
+}
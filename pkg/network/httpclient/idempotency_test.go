@@ -0,0 +1,59 @@
+package httpclient
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestEnsureIdempotencyKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		key     string
+		wantKey bool
+	}{
+		{name: "POST gets a key", method: http.MethodPost, wantKey: true},
+		{name: "PATCH gets a key", method: http.MethodPatch, wantKey: true},
+		{name: "existing key is kept", method: http.MethodPost, key: "abc", wantKey: true},
+		{name: "GET is idempotent", method: http.MethodGet},
+		{name: "PUT is idempotent", method: http.MethodPut},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shared := http.Header{"X-Request-Source": {"test"}}
+			if tt.key != "" {
+				shared.Set(IDEMPOTENCY_KEY_HEADER, tt.key)
+			}
+			req, _ := http.NewRequest(tt.method, "http://example.com", nil)
+			req.Header = shared
+
+			if err := ensureIdempotencyKey(req); err != nil {
+				t.Fatalf("ensureIdempotencyKey() error = %v", err)
+			}
+			key := req.Header.Get(IDEMPOTENCY_KEY_HEADER)
+			if (key != "") != tt.wantKey {
+				t.Errorf("Idempotency-Key = %q, want one: %v", key, tt.wantKey)
+			}
+			if tt.key != "" && key != tt.key {
+				t.Errorf("Idempotency-Key = %q, want the caller's %q", key, tt.key)
+			}
+			if shared.Get(IDEMPOTENCY_KEY_HEADER) != tt.key {
+				t.Errorf("caller's headers were modified: %v", shared)
+			}
+		})
+	}
+}
+
+func TestEnsureIdempotencyKeyIsUnique(t *testing.T) {
+	shared := http.Header{}
+	first, _ := http.NewRequest(http.MethodPost, "http://example.com", nil)
+	second, _ := http.NewRequest(http.MethodPost, "http://example.com", nil)
+	first.Header, second.Header = shared, shared
+
+	ensureIdempotencyKey(first)
+	ensureIdempotencyKey(second)
+	if first.Header.Get(IDEMPOTENCY_KEY_HEADER) == second.Header.Get(IDEMPOTENCY_KEY_HEADER) {
+		t.Errorf("requests sharing a header got the same Idempotency-Key %q", first.Header.Get(IDEMPOTENCY_KEY_HEADER))
+	}
+}
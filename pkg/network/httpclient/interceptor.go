@@ -0,0 +1,361 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"chaits.org/go-microservices-repo/pkg/general/logger"
+	"chaits.org/go-microservices-repo/pkg/general/metrics"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxLoggedBodyBytes caps how much of a body LoggingInterceptor buffers.
+const maxLoggedBodyBytes = 64 << 10
+
+// Interceptor wraps the transport of outgoing requests, like the server side
+// middleware wraps an http.Handler.
+type Interceptor func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts a function to the http.RoundTripper interface.
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Chain wraps base with the interceptors. The interceptors run in the order
+// given: Chain(base, i1, i2) sends requests through i1 -> i2 -> base.
+func Chain(base http.RoundTripper, interceptors ...Interceptor) http.RoundTripper {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		base = interceptors[i](base)
+	}
+	return base
+}
+
+// WithInterceptors adds custom interceptors to the default chain. They run
+// per attempt, after load balancing and before logging and tracing.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(h *HTTPClient) {
+		h.interceptors = append(h.interceptors, interceptors...)
+	}
+}
+
+// WithChain replaces the chain built from the other options with an explicit
+// one, outermost first. For example:
+//
+//	WithChain(
+//		MetricsInterceptor(),
+//		RetryInterceptor(policy),
+//		AuthInterceptor(map[string]Credentials{ANY_TARGET: creds}),
+//		CircuitBreakerInterceptor(DefaultCircuitBreakerSettings()),
+//		LoggingInterceptor(),
+//		TimeoutInterceptor(2*time.Second),
+//		TracingInterceptor(),
+//	)
+//
+// WithCache, WithRetry, WithBulkhead, WithCircuitBreaker, WithRecorder,
+// WithHedging, WithLoadBalancer, WithCredentials, WithTimeout, WithInterceptors,
+// WithRequestLogging and WithConnectionTiming have no effect on the chain then.
+func WithChain(interceptors ...Interceptor) Option {
+	return func(h *HTTPClient) {
+		h.chain = interceptors
+	}
+}
+
+// WithRequestLogging logs every attempt with LoggingInterceptor.
+func WithRequestLogging() Option {
+	return func(h *HTTPClient) {
+		h.requestLogging = true
+	}
+}
+
+// defaultChain orders the interceptors enabled by the options, outermost first:
+// cache, metrics, retry, auth, bulkhead, recorder, hedging, load balancing,
+// circuit breaker, custom interceptors, logging, timeout, tracing and
+// connection timing.
+func (h *HTTPClient) defaultChain() []Interceptor {
+	var chain []Interceptor
+	if h.cache != nil {
+		chain = append(chain, CacheInterceptor(h.cache))
+	}
+	chain = append(chain, MetricsInterceptor())
+	if h.retryPolicy != nil {
+		chain = append(chain, RetryInterceptor(*h.retryPolicy))
+	}
+	if len(h.credentials) > 0 {
+		chain = append(chain, AuthInterceptor(h.credentials))
+	}
+	if h.bulkheads != nil {
+		chain = append(chain, bulkheadInterceptor(h.bulkheads))
+	}
+	if h.recorder != nil {
+		chain = append(chain, h.recorder.Interceptor())
+	}
+	if h.hedger != nil {
+		chain = append(chain, hedgingInterceptor(h.hedger))
+	}
+	if len(h.balancers) > 0 {
+		chain = append(chain, loadBalancingInterceptor(h.balancers))
+	}
+	// Inside load balancing each resolved endpoint has its own breaker.
+	if h.breakers != nil {
+		chain = append(chain, circuitBreakerInterceptor(h.breakers))
+	}
+	chain = append(chain, h.interceptors...)
+	if h.requestLogging {
+		chain = append(chain, LoggingInterceptor())
+	}
+	if h.timeout > 0 {
+		chain = append(chain, TimeoutInterceptor(h.timeout))
+	}
+	chain = append(chain, TracingInterceptor())
+	if h.connectionTiming {
+		chain = append(chain, TimingInterceptor(h.slowThreshold))
+	}
+	return chain
+}
+
+// TracingInterceptor starts a client span per request and injects the trace headers.
+func TracingInterceptor() Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return otelhttp.NewTransport(next)
+	}
+}
+
+// MetricsInterceptor records each call with RecordDependencyRequest under its
+// DependencyName. Placed outside RetryInterceptor it measures the whole call.
+func MetricsInterceptor() Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			status := "error"
+			if err == nil {
+				status = strconv.Itoa(resp.StatusCode)
+			}
+			metrics.RecordDependencyRequest(DependencyName(req), status, time.Since(start))
+			return resp, err
+		})
+	}
+}
+
+// RetryInterceptor retries failed requests as described by policy.
+func RetryInterceptor(policy RetryPolicy) Interceptor {
+	if policy.RetryableStatusCodes == nil {
+		policy.RetryableStatusCodes = map[int]bool{}
+	}
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &retryTransport{next: next, policy: policy}
+	}
+}
+
+// AuthInterceptor adds the credentials mapped to each target, see WithCredentials.
+func AuthInterceptor(credentials map[string]Credentials) Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &credentialsTransport{next: next, credentials: credentials}
+	}
+}
+
+// CircuitBreakerInterceptor applies per-host circuit breakers, see WithCircuitBreaker.
+func CircuitBreakerInterceptor(settings CircuitBreakerSettings) Interceptor {
+	return circuitBreakerInterceptor(newCircuitBreakers(settings))
+}
+
+func circuitBreakerInterceptor(breakers *circuitBreakers) Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &circuitBreakerTransport{next: next, breakers: breakers}
+	}
+}
+
+// HedgingInterceptor hedges slow idempotent requests, see WithHedging.
+func HedgingInterceptor(policy HedgePolicy) Interceptor {
+	return hedgingInterceptor(newHedger(policy))
+}
+
+func hedgingInterceptor(hedger *hedger) Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &hedgingTransport{next: next, hedger: hedger}
+	}
+}
+
+// LoadBalancingInterceptor sends requests for the balancers' services to one
+// of their endpoints, see WithLoadBalancer.
+func LoadBalancingInterceptor(balancers ...*LoadBalancer) Interceptor {
+	byService := make(map[string]*LoadBalancer, len(balancers))
+	for _, lb := range balancers {
+		byService[lb.Service()] = lb
+	}
+	return loadBalancingInterceptor(byService)
+}
+
+func loadBalancingInterceptor(balancers map[string]*LoadBalancer) Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &loadBalancingTransport{next: next, balancers: balancers}
+	}
+}
+
+// TimeoutInterceptor bounds each request, including reading its body, to d.
+// Placed inside RetryInterceptor every attempt gets its own timeout.
+func TimeoutInterceptor(d time.Duration) Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			ctx, cancel := context.WithTimeout(req.Context(), d)
+			resp, err := next.RoundTrip(req.WithContext(ctx))
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			// Keep the deadline until the caller is done with the body.
+			resp.Body = &closeHook{ReadCloser: resp.Body, hook: cancel}
+			return resp, nil
+		})
+	}
+}
+
+// LoggingInterceptor logs each request with the fields of middleware.WithLogging,
+// plus the host and dependency. Credentials in the query and in form and JSON
+// bodies are redacted. A response is logged when its body is closed, so that
+// streamed responses reach the caller as they arrive. Requests are not logged
+// until logger.Init has been called.
+func LoggingInterceptor() Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if logger.Logger == nil {
+				return next.RoundTrip(req)
+			}
+			start := time.Now()
+			reqBody, req := loggedRequestBody(req)
+
+			resp, err := next.RoundTrip(req)
+			fields := logrus.Fields{
+				"traceID":      traceID(req.Context()),
+				"method":       req.Method,
+				"host":         req.URL.Host,
+				"dependency":   DependencyName(req),
+				"path":         req.URL.Path,
+				"query":        logger.RedactQuery(req.URL.RawQuery),
+				"request_body": reqBody,
+			}
+			if err != nil {
+				fields["duration_ms"] = time.Since(start).Milliseconds()
+				logger.Logger.WithFields(fields).WithError(err).Error("HTTP request failed.")
+				return nil, err
+			}
+
+			fields["status_code"] = resp.StatusCode
+			fields["duration_ms"] = time.Since(start).Milliseconds()
+			resp.Body = &loggingBody{
+				ReadCloser:  resp.Body,
+				contentType: resp.Header.Get("Content-Type"),
+				log: func(body string) {
+					fields["response_body"] = body
+					logger.Logger.WithFields(fields).Info("HTTP request sent.")
+				},
+				eof: resp.ContentLength == 0,
+			}
+			return resp, nil
+		})
+	}
+}
+
+// loggedRequestBody returns the body to log and a request whose body can still
+// be read. At most maxLoggedBodyBytes are read, so large uploads stay streamed.
+func loggedRequestBody(req *http.Request) (string, *http.Request) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return "", req
+	}
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			defer body.Close()
+			prefix, complete, _ := readPrefix(body, maxLoggedBodyBytes)
+			return loggedBody(prefix, complete, req.Header.Get("Content-Type")), req
+		}
+	}
+	prefix, complete, err := readPrefix(req.Body, maxLoggedBodyBytes)
+	if err != nil {
+		logger.Logger.WithError(err).Error("Failed to read request body for logging.")
+	}
+	out := req.Clone(req.Context())
+	out.Body = withPrefix(prefix, req.Body)
+	return loggedBody(prefix, complete, req.Header.Get("Content-Type")), out
+}
+
+// loggedBody redacts a body for the log. Bodies that were cut off are not
+// logged, as a truncated JSON document cannot be redacted.
+func loggedBody(body []byte, complete bool, contentType string) string {
+	if !complete {
+		return fmt.Sprintf("[body over %d bytes not logged]", maxLoggedBodyBytes)
+	}
+	return logger.RedactBody(body, contentType)
+}
+
+// loggingBody keeps the first bytes the caller reads from a response body and
+// logs them when the body is closed.
+type loggingBody struct {
+	io.ReadCloser
+	contentType string
+	log         func(body string)
+
+	buf  bytes.Buffer
+	eof  bool
+	once sync.Once
+}
+
+func (b *loggingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	// One byte more than is logged tells a body at the limit from a longer one.
+	if room := maxLoggedBodyBytes + 1 - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(n, room)])
+	}
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+func (b *loggingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		switch {
+		case b.buf.Len() > maxLoggedBodyBytes:
+			b.log(loggedBody(nil, false, b.contentType))
+		case !b.eof:
+			b.log("[body not read to the end, not logged]")
+		default:
+			b.log(loggedBody(b.buf.Bytes(), true, b.contentType))
+		}
+	})
+	return err
+}
+
+func traceID(ctx context.Context) string {
+	spanCtx := trace.SpanFromContext(ctx).SpanContext()
+	if spanCtx.HasTraceID() {
+		return spanCtx.TraceID().String()
+	}
+	return "N/A"
+}
+
+type dependencyKey struct{}
+
+// withDependencyName records the dependency name of a call for the interceptors.
+func withDependencyName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, dependencyKey{}, name)
+}
+
+// DependencyName returns the name a request is reported under: the client's
+// WithDependencyName, or the request host.
+func DependencyName(req *http.Request) string {
+	if name, ok := req.Context().Value(dependencyKey{}).(string); ok && name != "" {
+		return name
+	}
+	return req.URL.Host
+}
@@ -0,0 +1,49 @@
+package httpclient
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLoggingBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		read        func(r io.Reader)
+		want        string
+	}{
+		{name: "read to the end", body: `{"token":"abc"}`, contentType: "application/json",
+			read: func(r io.Reader) { io.ReadAll(r) }, want: `{"token":"[REDACTED]"}`},
+		{name: "form body", body: "password=hunter2", contentType: "application/x-www-form-urlencoded",
+			read: func(r io.Reader) { io.ReadAll(r) }, want: "password=%5BREDACTED%5D"},
+		{name: "closed early", body: `{"items":[1,2,3]}`, contentType: "application/json",
+			read: func(r io.Reader) { r.Read(make([]byte, 4)) }, want: "[body not read to the end, not logged]"},
+		{name: "at the limit", body: strings.Repeat("a", maxLoggedBodyBytes), contentType: "text/plain",
+			read: func(r io.Reader) { io.ReadAll(r) }, want: strings.Repeat("a", maxLoggedBodyBytes)},
+		{name: "over the limit", body: strings.Repeat("a", maxLoggedBodyBytes+1), contentType: "text/plain",
+			read: func(r io.Reader) { io.ReadAll(r) }, want: loggedBody(nil, false, "")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logged []string
+			body := &loggingBody{
+				ReadCloser:  io.NopCloser(strings.NewReader(tt.body)),
+				contentType: tt.contentType,
+				log:         func(body string) { logged = append(logged, body) },
+			}
+			tt.read(body)
+			if len(logged) != 0 {
+				t.Fatalf("logged before Close: %q", logged)
+			}
+			body.Close()
+			body.Close()
+
+			if len(logged) != 1 || logged[0] != tt.want {
+				t.Errorf("logged %q, want exactly %q", logged, tt.want)
+			}
+		})
+	}
+}
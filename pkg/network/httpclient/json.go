@@ -0,0 +1,219 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"chaits.org/go-microservices-repo/pkg/errors"
+)
+
+// DEFAULT_MAX_RESPONSE_BYTES is the largest response body the JSON helpers read
+// unless WithMaxResponseBytes says otherwise.
+const DEFAULT_MAX_RESPONSE_BYTES int64 = 1 << 20
+
+// maxErrorMessageBytes bounds the plain-text error body copied into an AppError.
+const maxErrorMessageBytes = 512
+
+// WithMaxResponseBytes limits the response bodies read by the JSON helpers and CheckResponse.
+func WithMaxResponseBytes(n int64) Option {
+	return func(h *HTTPClient) {
+		h.maxResponseBytes = n
+	}
+}
+
+// RequestOption customises a request built by the JSON helpers.
+type RequestOption func(*http.Request)
+
+// WithHeader sets a header on the request.
+func WithHeader(key, value string) RequestOption {
+	return func(req *http.Request) {
+		req.Header.Set(key, value)
+	}
+}
+
+// Problem is an RFC 9457 problem details body. Code carries the remote
+// AppError code, if the callee sent one.
+type Problem struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code,omitempty"`
+}
+
+// ResponseError is the cause of an AppError built from a non-2xx response.
+type ResponseError struct {
+	StatusCode int
+	// Problem is set when the callee answered with a problem details body.
+	Problem *Problem
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("remote returned %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// GetJSON sends a GET request and decodes the JSON response into T.
+func GetJSON[T any](ctx context.Context, client *HTTPClient, url string, opts ...RequestOption) (T, error) {
+	var resp T
+	err := client.doJSON(ctx, http.MethodGet, url, nil, &resp, opts...)
+	return resp, err
+}
+
+// PostJSON sends body as JSON in a POST request and decodes the JSON response into Resp.
+func PostJSON[Req, Resp any](ctx context.Context, client *HTTPClient, url string, body Req, opts ...RequestOption) (Resp, error) {
+	var resp Resp
+	err := client.doJSON(ctx, http.MethodPost, url, &body, &resp, opts...)
+	return resp, err
+}
+
+// PutJSON sends body as JSON in a PUT request and decodes the JSON response into Resp.
+func PutJSON[Req, Resp any](ctx context.Context, client *HTTPClient, url string, body Req, opts ...RequestOption) (Resp, error) {
+	var resp Resp
+	err := client.doJSON(ctx, http.MethodPut, url, &body, &resp, opts...)
+	return resp, err
+}
+
+// DeleteJSON sends a DELETE request and decodes the JSON response, if any, into T.
+func DeleteJSON[T any](ctx context.Context, client *HTTPClient, url string, opts ...RequestOption) (T, error) {
+	var resp T
+	err := client.doJSON(ctx, http.MethodDelete, url, nil, &resp, opts...)
+	return resp, err
+}
+
+func (h *HTTPClient) doJSON(ctx context.Context, method, url string, body, out any, opts ...RequestOption) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encoding request body: %w", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+
+	resp, err := h.Do(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := h.CheckResponse(resp); err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNoContent || resp.ContentLength == 0 {
+		return nil
+	}
+	if !isJSON(resp.Header.Get("Content-Type")) {
+		return errors.New(errors.INVALID_RESPONSE_ERROR, fmt.Sprintf("expected a JSON response from %s, got %q", url, resp.Header.Get("Content-Type")))
+	}
+
+	data, err := h.readBody(resp)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return errors.Wrap(errors.INVALID_RESPONSE_ERROR, fmt.Sprintf("decoding response from %s", url), err)
+	}
+	return nil
+}
+
+// CheckResponse returns nil for 2xx responses. Otherwise it reads the body and
+// returns an AppError that keeps the remote error code from a problem body,
+// or REMOTE_ERROR with the body text, caused by a *ResponseError. A body is a
+// problem when it is application/problem+json, or JSON with a status or title.
+func (h *HTTPClient) CheckResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	cause := &ResponseError{StatusCode: resp.StatusCode}
+	data, err := h.readBody(resp)
+	if err != nil {
+		return errors.Wrap(errors.REMOTE_ERROR, http.StatusText(resp.StatusCode), cause)
+	}
+
+	if problem, ok := parseProblem(resp.Header.Get("Content-Type"), data); ok {
+		cause.Problem = problem
+		code := problem.Code
+		if code == "" {
+			code = errors.REMOTE_ERROR
+		}
+		message := problem.Detail
+		if message == "" {
+			message = problem.Title
+		}
+		if message == "" {
+			message = http.StatusText(resp.StatusCode)
+		}
+		return errors.Wrap(code, message, cause)
+	}
+
+	message := strings.TrimSpace(string(data))
+	if len(message) > maxErrorMessageBytes {
+		message = message[:maxErrorMessageBytes]
+	}
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+	return errors.Wrap(errors.REMOTE_ERROR, message, cause)
+}
+
+// readBody reads at most the configured number of bytes from the response body.
+func (h *HTTPClient) readBody(resp *http.Response) ([]byte, error) {
+	limit := h.maxResponseBytes
+	if limit <= 0 {
+		limit = DEFAULT_MAX_RESPONSE_BYTES
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, errors.New(errors.RESPONSE_TOO_LARGE_ERROR, fmt.Sprintf("response body exceeds %d bytes", limit))
+	}
+	return data, nil
+}
+
+// parseProblem decodes data as a problem details body. Other JSON error bodies
+// are not problems, so their text is kept.
+func parseProblem(contentType string, data []byte) (*Problem, bool) {
+	if !isJSON(contentType) {
+		return nil, false
+	}
+	var problem Problem
+	if json.Unmarshal(data, &problem) != nil {
+		return nil, false
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "application/problem+json" && problem.Status == 0 && problem.Title == "" {
+		return nil, false
+	}
+	return &problem, true
+}
+
+// isJSON accepts application/json and the +json suffix types such as application/problem+json.
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
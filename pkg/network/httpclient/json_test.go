@@ -0,0 +1,139 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"chaits.org/go-microservices-repo/pkg/errors"
+)
+
+type testApp struct {
+	Name string `json:"name"`
+	Plan string `json:"plan,omitempty"`
+}
+
+func TestJSONHelpers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/json" {
+			t.Errorf("%s sent Accept %q", r.Method, r.Header.Get("Accept"))
+		}
+		switch r.URL.Path {
+		case "/text":
+			w.Header().Set("Content-Type", "text/plain")
+			io.WriteString(w, "billing")
+			return
+		case "/large":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"name":"`+strings.Repeat("a", 64)+`"}`)
+			return
+		}
+
+		var app testApp
+		if r.Body != nil {
+			json.NewDecoder(r.Body).Decode(&app)
+		}
+		if (r.Method == http.MethodPost || r.Method == http.MethodPut) && r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("%s sent Content-Type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if app.Name == "" {
+			app.Name = r.Header.Get("X-App-Name")
+		}
+		app.Plan = strings.ToLower(r.Method)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(app)
+	}))
+	defer server.Close()
+	client := NewHTTPClient(WithMaxResponseBytes(64))
+	ctx := context.Background()
+
+	got, err := GetJSON[testApp](ctx, client, server.URL+"/apps", WithHeader("X-App-Name", "billing"))
+	if err != nil || got != (testApp{Name: "billing", Plan: "get"}) {
+		t.Errorf("GetJSON() = %+v, %v", got, err)
+	}
+	got, err = PostJSON[testApp, testApp](ctx, client, server.URL+"/apps", testApp{Name: "reports"})
+	if err != nil || got != (testApp{Name: "reports", Plan: "post"}) {
+		t.Errorf("PostJSON() = %+v, %v", got, err)
+	}
+	got, err = PutJSON[testApp, testApp](ctx, client, server.URL+"/apps", testApp{Name: "reports"})
+	if err != nil || got != (testApp{Name: "reports", Plan: "put"}) {
+		t.Errorf("PutJSON() = %+v, %v", got, err)
+	}
+	got, err = DeleteJSON[testApp](ctx, client, server.URL+"/apps")
+	if err != nil || got != (testApp{}) {
+		t.Errorf("DeleteJSON() with no content = %+v, %v", got, err)
+	}
+
+	for path, want := range map[string]string{"/text": errors.INVALID_RESPONSE_ERROR, "/large": errors.RESPONSE_TOO_LARGE_ERROR} {
+		_, err := GetJSON[testApp](ctx, client, server.URL+path)
+		var appErr *errors.AppError
+		if !errors.As(err, &appErr) || appErr.Code != want {
+			t.Errorf("GetJSON(%s) error = %v, want %s", path, err, want)
+		}
+	}
+}
+
+func TestCheckResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		wantCode    string
+		wantMessage string
+		wantProblem bool
+	}{
+		{name: "success", status: http.StatusOK, body: "ok"},
+		{name: "problem details", status: http.StatusUnauthorized, contentType: "application/problem+json",
+			body:     `{"type":"about:blank","title":"Unauthorized","status":401,"detail":"API key expired","code":"UnauthorizedError"}`,
+			wantCode: "UnauthorizedError", wantMessage: "API key expired", wantProblem: true},
+		{name: "problem details without a code", status: http.StatusNotFound, contentType: "application/problem+json",
+			body: `{}`, wantCode: errors.REMOTE_ERROR, wantMessage: "Not Found", wantProblem: true},
+		{name: "JSON with a title", status: http.StatusConflict, contentType: "application/json",
+			body: `{"title":"App exists","status":409}`, wantCode: errors.REMOTE_ERROR, wantMessage: "App exists", wantProblem: true},
+		{name: "other JSON keeps the body", status: http.StatusBadRequest, contentType: "application/json",
+			body: `{"error":"name is required"}`, wantCode: errors.REMOTE_ERROR, wantMessage: `{"error":"name is required"}`},
+		{name: "plain text", status: http.StatusBadGateway, contentType: "text/plain",
+			body: " upstream down\n", wantCode: errors.REMOTE_ERROR, wantMessage: "upstream down"},
+		{name: "long text is cut", status: http.StatusInternalServerError,
+			body: strings.Repeat("x", 600), wantCode: errors.REMOTE_ERROR, wantMessage: strings.Repeat("x", maxErrorMessageBytes)},
+		{name: "empty body", status: http.StatusServiceUnavailable, wantCode: errors.REMOTE_ERROR, wantMessage: "Service Unavailable"},
+	}
+
+	client := NewHTTPClient()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(tt.body))}
+			if tt.contentType != "" {
+				resp.Header.Set("Content-Type", tt.contentType)
+			}
+			err := client.CheckResponse(resp)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Errorf("CheckResponse() error = %v", err)
+				}
+				return
+			}
+
+			var appErr *errors.AppError
+			if !errors.As(err, &appErr) || appErr.Code != tt.wantCode || appErr.Message != tt.wantMessage {
+				t.Fatalf("CheckResponse() error = %v, want [%s] %s", err, tt.wantCode, tt.wantMessage)
+			}
+			var respErr *ResponseError
+			if !errors.As(err, &respErr) || respErr.StatusCode != tt.status {
+				t.Fatalf("CheckResponse() cause = %v, want a ResponseError with %d", err, tt.status)
+			}
+			if (respErr.Problem != nil) != tt.wantProblem {
+				t.Errorf("Problem = %+v, want problem %v", respErr.Problem, tt.wantProblem)
+			}
+		})
+	}
+}
@@ -0,0 +1,549 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"chaits.org/go-microservices-repo/pkg/errors"
+	"chaits.org/go-microservices-repo/pkg/general/config"
+	"chaits.org/go-microservices-repo/pkg/general/metrics"
+	"chaits.org/go-microservices-repo/pkg/network/discovery"
+)
+
+// BalancingStrategy selects how a LoadBalancer picks an endpoint.
+type BalancingStrategy string
+
+const (
+	// STRATEGY_ROUND_ROBIN cycles through the available endpoints.
+	STRATEGY_ROUND_ROBIN BalancingStrategy = "round-robin"
+	// STRATEGY_LEAST_OUTSTANDING picks the endpoint with the fewest requests in
+	// flight relative to its weight.
+	STRATEGY_LEAST_OUTSTANDING BalancingStrategy = "least-outstanding"
+	// STRATEGY_WEIGHTED spreads requests in proportion to the endpoint weights.
+	STRATEGY_WEIGHTED BalancingStrategy = "weighted"
+)
+
+// Endpoint is one instance of a service.
+type Endpoint struct {
+	// Address is "host:port".
+	Address string
+	// Weight is the relative share of traffic for STRATEGY_WEIGHTED and
+	// STRATEGY_LEAST_OUTSTANDING. Defaults to 1.
+	Weight int
+}
+
+// LoadBalancerConfig configures endpoint selection and health checking.
+type LoadBalancerConfig struct {
+	Strategy BalancingStrategy
+
+	// Scheme is used for requests and probes. Defaults to "http".
+	Scheme string
+
+	// HealthCheckPath is probed on every endpoint each HealthCheckInterval.
+	// An empty path disables active health checks.
+	HealthCheckPath     string
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+
+	// UnhealthyThreshold and HealthyThreshold are the consecutive probe results
+	// needed to mark an endpoint down or up.
+	UnhealthyThreshold int
+	HealthyThreshold   int
+
+	// EjectAfterFailures ejects an endpoint after this many consecutive failed
+	// requests (transport errors or 5xx). Zero disables passive checks.
+	EjectAfterFailures int
+
+	// EjectionDuration is how long the first ejection lasts. Repeated ejections
+	// last longer, up to ten times this value.
+	EjectionDuration time.Duration
+
+	// MaxEjectedRatio bounds the fraction of endpoints that can be ejected at once.
+	MaxEjectedRatio float64
+
+	// SlowStart ramps the traffic of an endpoint that came back, from 10% of
+	// its share to all of it, over this period. It applies to every strategy.
+	SlowStart time.Duration
+}
+
+// DefaultLoadBalancerConfig probes /health every 10 seconds and ejects an
+// endpoint for 30 seconds after 5 failed requests in a row.
+func DefaultLoadBalancerConfig() LoadBalancerConfig {
+	return LoadBalancerConfig{
+		Strategy:            STRATEGY_ROUND_ROBIN,
+		Scheme:              "http",
+		HealthCheckPath:     "/health",
+		HealthCheckInterval: 10 * time.Second,
+		HealthCheckTimeout:  2 * time.Second,
+		UnhealthyThreshold:  2,
+		HealthyThreshold:    2,
+		EjectAfterFailures:  5,
+		EjectionDuration:    30 * time.Second,
+		MaxEjectedRatio:     0.5,
+		SlowStart:           30 * time.Second,
+	}
+}
+
+// endpointState is an endpoint with its health and load.
+type endpointState struct {
+	Endpoint
+
+	outstanding atomic.Int64
+
+	// Guarded by LoadBalancer.mu.
+	healthy             bool
+	probeSuccesses      int
+	probeFailures       int
+	consecutiveFailures int
+	ejections           int
+	ejectedUntil        time.Time
+	restoredAt          time.Time
+	currentWeight       float64
+}
+
+// available reports whether the endpoint may receive traffic.
+func (e *endpointState) available(now time.Time) bool {
+	return e.healthy && !now.Before(e.ejectedUntil)
+}
+
+// effectiveWeight is the weight scaled down while the endpoint is slow starting.
+func (e *endpointState) effectiveWeight(now time.Time, slowStart time.Duration) float64 {
+	return float64(e.Weight) * e.ramp(now, slowStart)
+}
+
+// ramp is the share of its traffic an endpoint gets: from 0.1 when it came
+// back to 1 once slowStart has passed.
+func (e *endpointState) ramp(now time.Time, slowStart time.Duration) float64 {
+	if slowStart <= 0 || e.restoredAt.IsZero() {
+		return 1
+	}
+	elapsed := now.Sub(e.restoredAt)
+	if elapsed >= slowStart {
+		return 1
+	}
+	return math.Max(0.1, float64(elapsed)/float64(slowStart))
+}
+
+// LoadBalancer spreads the requests for a logical service over its endpoints.
+// Requests to "http://<service>/path" sent through a client configured with
+// WithLoadBalancer are routed to one of the endpoints.
+type LoadBalancer struct {
+	service string
+	config  LoadBalancerConfig
+	probe   *http.Client
+
+	mu        sync.Mutex
+	endpoints []*endpointState
+	next      int
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	// unsubscribe stops discovery updates for balancers built by NewDiscoveredLoadBalancer.
+	unsubscribe func()
+}
+
+// NewLoadBalancer returns a balancer for service and starts its health checks.
+// Call Close to stop them.
+func NewLoadBalancer(service string, endpoints []Endpoint, lbConfig LoadBalancerConfig) *LoadBalancer {
+	defaults := DefaultLoadBalancerConfig()
+	if lbConfig.Strategy == "" {
+		lbConfig.Strategy = defaults.Strategy
+	}
+	if lbConfig.Scheme == "" {
+		lbConfig.Scheme = defaults.Scheme
+	}
+	if lbConfig.HealthCheckInterval <= 0 {
+		lbConfig.HealthCheckInterval = defaults.HealthCheckInterval
+	}
+	if lbConfig.HealthCheckTimeout <= 0 {
+		lbConfig.HealthCheckTimeout = defaults.HealthCheckTimeout
+	}
+	if lbConfig.UnhealthyThreshold <= 0 {
+		lbConfig.UnhealthyThreshold = defaults.UnhealthyThreshold
+	}
+	if lbConfig.HealthyThreshold <= 0 {
+		lbConfig.HealthyThreshold = defaults.HealthyThreshold
+	}
+	if lbConfig.EjectionDuration <= 0 {
+		lbConfig.EjectionDuration = defaults.EjectionDuration
+	}
+	if lbConfig.MaxEjectedRatio <= 0 {
+		lbConfig.MaxEjectedRatio = defaults.MaxEjectedRatio
+	}
+
+	lb := &LoadBalancer{
+		service: service,
+		config:  lbConfig,
+		probe:   &http.Client{Timeout: lbConfig.HealthCheckTimeout},
+		stop:    make(chan struct{}),
+	}
+	lb.SetEndpoints(endpoints)
+	if lbConfig.HealthCheckPath != "" {
+		go lb.healthCheckLoop()
+	}
+	return lb
+}
+
+// NewLoadBalancerFromConfig builds a balancer from the services.<service>
+// section of the configuration.
+func NewLoadBalancerFromConfig(appConfig *config.AppConfig, service string) *LoadBalancer {
+	prefix := "services." + service + "."
+	weights := appConfig.GetStringMapString(prefix + "weights")
+	var endpoints []Endpoint
+	for _, address := range appConfig.GetStringSlice(prefix + "endpoints") {
+		weight, _ := strconv.Atoi(weights[address])
+		endpoints = append(endpoints, Endpoint{Address: address, Weight: weight})
+	}
+	return NewLoadBalancer(service, endpoints, LoadBalancerConfigFromApp(appConfig, service))
+}
+
+// NewDiscoveredLoadBalancer builds a balancer whose endpoints follow the
+// instances that d resolves for service.
+func NewDiscoveredLoadBalancer(d *discovery.Discovery, service string, lbConfig LoadBalancerConfig) *LoadBalancer {
+	lb := NewLoadBalancer(service, nil, lbConfig)
+	lb.unsubscribe = d.Subscribe(service, func(instances []discovery.Instance) {
+		endpoints := make([]Endpoint, 0, len(instances))
+		for _, instance := range instances {
+			endpoints = append(endpoints, Endpoint{Address: instance.Address, Weight: instance.Weight})
+		}
+		log.Printf("%s endpoints changed: %d instances", service, len(endpoints))
+		lb.SetEndpoints(endpoints)
+	})
+	return lb
+}
+
+// LoadBalancerConfigFromApp reads the balancing and health check settings of
+// the services.<service> section of the configuration.
+func LoadBalancerConfigFromApp(appConfig *config.AppConfig, service string) LoadBalancerConfig {
+	prefix := "services." + service + "."
+	lbConfig := DefaultLoadBalancerConfig()
+	if appConfig.IsSet(prefix + "strategy") {
+		lbConfig.Strategy = BalancingStrategy(appConfig.GetConfig(prefix + "strategy"))
+	}
+	if appConfig.IsSet(prefix + "health_check.path") {
+		lbConfig.HealthCheckPath = appConfig.GetConfig(prefix + "health_check.path")
+	}
+	if appConfig.IsSet(prefix + "health_check.interval") {
+		lbConfig.HealthCheckInterval = appConfig.GetDuration(prefix + "health_check.interval")
+	}
+	if appConfig.IsSet(prefix + "eject_after_failures") {
+		lbConfig.EjectAfterFailures = appConfig.GetInt(prefix + "eject_after_failures")
+	}
+	if appConfig.IsSet(prefix + "ejection_duration") {
+		lbConfig.EjectionDuration = appConfig.GetDuration(prefix + "ejection_duration")
+	}
+	if appConfig.IsSet(prefix + "slow_start") {
+		lbConfig.SlowStart = appConfig.GetDuration(prefix + "slow_start")
+	}
+	return lbConfig
+}
+
+// Service returns the logical service name the balancer answers for.
+func (lb *LoadBalancer) Service() string {
+	return lb.service
+}
+
+// SetEndpoints replaces the endpoint list. Endpoints that were already known
+// keep their health and load; new ones start healthy.
+func (lb *LoadBalancer) SetEndpoints(endpoints []Endpoint) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	existing := make(map[string]*endpointState, len(lb.endpoints))
+	for _, state := range lb.endpoints {
+		existing[state.Address] = state
+	}
+
+	states := make([]*endpointState, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if endpoint.Weight <= 0 {
+			endpoint.Weight = 1
+		}
+		state, ok := existing[endpoint.Address]
+		if ok {
+			state.Weight = endpoint.Weight
+			delete(existing, endpoint.Address)
+		} else {
+			state = &endpointState{Endpoint: endpoint, healthy: true}
+			metrics.UpdateLoadBalancerEndpointHealth(lb.service, endpoint.Address, true)
+		}
+		states = append(states, state)
+	}
+	for address := range existing {
+		metrics.RemoveLoadBalancerEndpoint(lb.service, address)
+	}
+	lb.endpoints = states
+}
+
+// Endpoints returns the current endpoints.
+func (lb *LoadBalancer) Endpoints() []Endpoint {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	endpoints := make([]Endpoint, len(lb.endpoints))
+	for i, state := range lb.endpoints {
+		endpoints[i] = state.Endpoint
+	}
+	return endpoints
+}
+
+// Close stops the health checks and discovery updates.
+func (lb *LoadBalancer) Close() {
+	lb.stopOnce.Do(func() {
+		close(lb.stop)
+		if lb.unsubscribe != nil {
+			lb.unsubscribe()
+		}
+	})
+}
+
+// pick chooses an endpoint. When none is available it falls back to all of
+// them, since failing every request is worse than trying a suspect endpoint.
+func (lb *LoadBalancer) pick() (*endpointState, error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	if len(lb.endpoints) == 0 {
+		return nil, errors.New(errors.NO_ENDPOINTS_ERROR, fmt.Sprintf("no endpoints for service %s", lb.service))
+	}
+
+	now := time.Now()
+	candidates := make([]*endpointState, 0, len(lb.endpoints))
+	for _, state := range lb.endpoints {
+		if state.available(now) {
+			candidates = append(candidates, state)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = lb.endpoints
+	}
+
+	switch lb.config.Strategy {
+	case STRATEGY_LEAST_OUTSTANDING:
+		return lb.pickLeastOutstanding(candidates, now), nil
+	case STRATEGY_WEIGHTED:
+		return lb.pickWeighted(candidates, func(state *endpointState) float64 {
+			return state.effectiveWeight(now, lb.config.SlowStart)
+		}), nil
+	default:
+		return lb.pickRoundRobin(candidates, now), nil
+	}
+}
+
+// pickRoundRobin cycles through the candidates. While one of them is slow
+// starting, it is picked with equal weights scaled by their ramp instead.
+func (lb *LoadBalancer) pickRoundRobin(candidates []*endpointState, now time.Time) *endpointState {
+	for _, state := range candidates {
+		if state.ramp(now, lb.config.SlowStart) < 1 {
+			return lb.pickWeighted(candidates, func(state *endpointState) float64 {
+				return state.ramp(now, lb.config.SlowStart)
+			})
+		}
+	}
+	lb.next++
+	return candidates[lb.next%len(candidates)]
+}
+
+// pickLeastOutstanding starts the scan at a rotating offset so ties are spread out.
+func (lb *LoadBalancer) pickLeastOutstanding(candidates []*endpointState, now time.Time) *endpointState {
+	lb.next++
+	var best *endpointState
+	bestLoad := math.Inf(1)
+	for i := range candidates {
+		state := candidates[(lb.next+i)%len(candidates)]
+		load := float64(state.outstanding.Load()+1) / state.effectiveWeight(now, lb.config.SlowStart)
+		if load < bestLoad {
+			best, bestLoad = state, load
+		}
+	}
+	return best
+}
+
+// pickWeighted is smooth weighted round-robin: every endpoint earns its weight
+// and the richest one is picked and pays back the total.
+func (lb *LoadBalancer) pickWeighted(candidates []*endpointState, weightOf func(*endpointState) float64) *endpointState {
+	var best *endpointState
+	total := 0.0
+	for _, state := range candidates {
+		weight := weightOf(state)
+		state.currentWeight += weight
+		total += weight
+		if best == nil || state.currentWeight > best.currentWeight {
+			best = state
+		}
+	}
+	best.currentWeight -= total
+	return best
+}
+
+// record applies the passive health check to the outcome of a request.
+func (lb *LoadBalancer) record(state *endpointState, failed bool) {
+	if lb.config.EjectAfterFailures <= 0 {
+		return
+	}
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	if !failed {
+		state.consecutiveFailures = 0
+		return
+	}
+	state.consecutiveFailures++
+	if state.consecutiveFailures < lb.config.EjectAfterFailures {
+		return
+	}
+
+	now := time.Now()
+	if !state.available(now) {
+		return
+	}
+	ejected := 0
+	for _, other := range lb.endpoints {
+		if !other.available(now) {
+			ejected++
+		}
+	}
+	if float64(ejected+1) > lb.config.MaxEjectedRatio*float64(len(lb.endpoints)) {
+		return
+	}
+
+	state.ejections++
+	duration := lb.config.EjectionDuration * time.Duration(min(state.ejections, 10))
+	state.ejectedUntil = now.Add(duration)
+	state.restoredAt = state.ejectedUntil
+	state.consecutiveFailures = 0
+	log.Printf("Ejecting %s endpoint %s for %v after %d consecutive failures", lb.service, state.Address, duration, lb.config.EjectAfterFailures)
+	metrics.IncrementLoadBalancerEjections(lb.service, state.Address)
+}
+
+func (lb *LoadBalancer) healthCheckLoop() {
+	ticker := time.NewTicker(lb.config.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lb.stop:
+			return
+		case <-ticker.C:
+			lb.checkAll()
+		}
+	}
+}
+
+// checkAll probes every endpoint concurrently.
+func (lb *LoadBalancer) checkAll() {
+	lb.mu.Lock()
+	endpoints := make([]*endpointState, len(lb.endpoints))
+	copy(endpoints, lb.endpoints)
+	lb.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, state := range endpoints {
+		wg.Add(1)
+		go func(state *endpointState) {
+			defer wg.Done()
+			lb.applyProbe(state, lb.probeEndpoint(state))
+		}(state)
+	}
+	wg.Wait()
+}
+
+func (lb *LoadBalancer) probeEndpoint(state *endpointState) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), lb.config.HealthCheckTimeout)
+	defer cancel()
+	url := fmt.Sprintf("%s://%s%s", lb.config.Scheme, state.Address, lb.config.HealthCheckPath)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := lb.probe.Do(req)
+	if err != nil {
+		return false
+	}
+	discard(resp)
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+func (lb *LoadBalancer) applyProbe(state *endpointState, ok bool) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	if ok {
+		state.probeFailures = 0
+		state.probeSuccesses++
+		if !state.healthy && state.probeSuccesses >= lb.config.HealthyThreshold {
+			state.healthy = true
+			state.restoredAt = time.Now()
+			log.Printf("%s endpoint %s is healthy again", lb.service, state.Address)
+			metrics.UpdateLoadBalancerEndpointHealth(lb.service, state.Address, true)
+		}
+		return
+	}
+
+	state.probeSuccesses = 0
+	state.probeFailures++
+	if state.healthy && state.probeFailures >= lb.config.UnhealthyThreshold {
+		state.healthy = false
+		log.Printf("%s endpoint %s failed %d health checks, marking it down", lb.service, state.Address, state.probeFailures)
+		metrics.UpdateLoadBalancerEndpointHealth(lb.service, state.Address, false)
+	}
+}
+
+// WithLoadBalancer routes requests for lb.Service() to its endpoints. It can
+// be used once per service the client talks to.
+func WithLoadBalancer(lb *LoadBalancer) Option {
+	return func(h *HTTPClient) {
+		if h.balancers == nil {
+			h.balancers = make(map[string]*LoadBalancer)
+		}
+		h.balancers[lb.Service()] = lb
+	}
+}
+
+// loadBalancingTransport rewrites requests for a logical service to one of its
+// endpoints. It sits outside the tracing transport, so spans show the endpoint
+// that was actually called, and each retry or hedge picks again.
+type loadBalancingTransport struct {
+	next      http.RoundTripper
+	balancers map[string]*LoadBalancer
+}
+
+func (t *loadBalancingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	lb, ok := t.balancers[req.URL.Host]
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+
+	state, err := lb.pick()
+	if err != nil {
+		return nil, err
+	}
+
+	out := req.Clone(req.Context())
+	out.URL.Host = state.Address
+	out.URL.Scheme = lb.config.Scheme
+	out.Host = ""
+
+	// The request is outstanding until its body is closed.
+	state.outstanding.Add(1)
+	resp, err := t.next.RoundTrip(out)
+	if err != nil {
+		state.outstanding.Add(-1)
+		// A caller that went away, such as a hedge that lost, says nothing
+		// about the endpoint. Per-attempt timeouts and open breakers still
+		// count as failures, which moves traffic to the other endpoints.
+		if !errors.Is(err, context.Canceled) && req.Context().Err() == nil {
+			lb.record(state, true)
+		}
+		return nil, err
+	}
+	resp.Body = &closeHook{ReadCloser: resp.Body, hook: func() { state.outstanding.Add(-1) }}
+
+	lb.record(state, resp.StatusCode >= http.StatusInternalServerError)
+	return resp, nil
+}
@@ -0,0 +1,263 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"chaits.org/go-microservices-repo/pkg/errors"
+)
+
+func TestRamp(t *testing.T) {
+	restored := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		restoredAt time.Time
+		elapsed    time.Duration
+		slowStart  time.Duration
+		want       float64
+	}{
+		{name: "slow start disabled", restoredAt: restored, elapsed: 0, slowStart: 0, want: 1},
+		{name: "never restored", elapsed: 0, slowStart: time.Minute, want: 1},
+		{name: "just restored", restoredAt: restored, elapsed: 0, slowStart: time.Minute, want: 0.1},
+		{name: "not restored yet", restoredAt: restored, elapsed: -time.Minute, slowStart: time.Minute, want: 0.1},
+		{name: "halfway", restoredAt: restored, elapsed: 30 * time.Second, slowStart: time.Minute, want: 0.5},
+		{name: "done", restoredAt: restored, elapsed: time.Minute, slowStart: time.Minute, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := &endpointState{Endpoint: Endpoint{Weight: 2}, restoredAt: tt.restoredAt}
+			now := restored.Add(tt.elapsed)
+			if got := state.ramp(now, tt.slowStart); got != tt.want {
+				t.Errorf("ramp() = %v, want %v", got, tt.want)
+			}
+			if got := state.effectiveWeight(now, tt.slowStart); got != 2*tt.want {
+				t.Errorf("effectiveWeight() = %v, want %v", got, 2*tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadBalancerPick(t *testing.T) {
+	tests := []struct {
+		name      string
+		strategy  BalancingStrategy
+		endpoints []Endpoint
+		setup     func(states map[string]*endpointState)
+		want      map[string]int
+	}{
+		{name: "round-robin", strategy: STRATEGY_ROUND_ROBIN,
+			endpoints: []Endpoint{{Address: "a"}, {Address: "b"}},
+			want:      map[string]int{"a": 500, "b": 500}},
+		{name: "round-robin ignores weights", strategy: STRATEGY_ROUND_ROBIN,
+			endpoints: []Endpoint{{Address: "a", Weight: 3}, {Address: "b"}},
+			want:      map[string]int{"a": 500, "b": 500}},
+		{name: "round-robin slow start", strategy: STRATEGY_ROUND_ROBIN,
+			endpoints: []Endpoint{{Address: "a"}, {Address: "b"}},
+			setup: func(states map[string]*endpointState) {
+				states["b"].restoredAt = time.Now().Add(-15 * time.Minute)
+			},
+			want: map[string]int{"a": 800, "b": 200}},
+		{name: "weighted", strategy: STRATEGY_WEIGHTED,
+			endpoints: []Endpoint{{Address: "a", Weight: 3}, {Address: "b"}},
+			want:      map[string]int{"a": 750, "b": 250}},
+		{name: "weighted slow start", strategy: STRATEGY_WEIGHTED,
+			endpoints: []Endpoint{{Address: "a"}, {Address: "b", Weight: 4}},
+			setup: func(states map[string]*endpointState) {
+				states["b"].restoredAt = time.Now().Add(-15 * time.Minute)
+			},
+			want: map[string]int{"a": 500, "b": 500}},
+		{name: "least outstanding", strategy: STRATEGY_LEAST_OUTSTANDING,
+			endpoints: []Endpoint{{Address: "a"}, {Address: "b"}},
+			setup: func(states map[string]*endpointState) {
+				states["a"].outstanding.Store(1)
+			},
+			want: map[string]int{"b": 1000}},
+		{name: "ejected endpoints are skipped", strategy: STRATEGY_ROUND_ROBIN,
+			endpoints: []Endpoint{{Address: "a"}, {Address: "b"}},
+			setup: func(states map[string]*endpointState) {
+				states["a"].ejectedUntil = time.Now().Add(time.Hour)
+			},
+			want: map[string]int{"b": 1000}},
+		{name: "all unavailable falls back to all", strategy: STRATEGY_ROUND_ROBIN,
+			endpoints: []Endpoint{{Address: "a"}, {Address: "b"}},
+			setup: func(states map[string]*endpointState) {
+				states["a"].healthy = false
+				states["b"].healthy = false
+			},
+			want: map[string]int{"a": 500, "b": 500}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := NewLoadBalancer("svc", tt.endpoints, LoadBalancerConfig{Strategy: tt.strategy, SlowStart: time.Hour})
+			defer lb.Close()
+			states := make(map[string]*endpointState)
+			for _, state := range lb.endpoints {
+				states[state.Address] = state
+			}
+			if tt.setup != nil {
+				tt.setup(states)
+			}
+
+			got := make(map[string]int)
+			for i := 0; i < 1000; i++ {
+				state, err := lb.pick()
+				if err != nil {
+					t.Fatalf("pick() error = %v", err)
+				}
+				got[state.Address]++
+			}
+			for address := range states {
+				if diff := got[address] - tt.want[address]; diff < -5 || diff > 5 {
+					t.Errorf("%s picked %d times, want about %d", address, got[address], tt.want[address])
+				}
+			}
+		})
+	}
+}
+
+func TestLoadBalancerPickWithoutEndpoints(t *testing.T) {
+	lb := NewLoadBalancer("svc", nil, LoadBalancerConfig{})
+	defer lb.Close()
+
+	_, err := lb.pick()
+	var appErr *errors.AppError
+	if !errors.As(err, &appErr) || appErr.Code != errors.NO_ENDPOINTS_ERROR {
+		t.Errorf("pick() error = %v, want %s", err, errors.NO_ENDPOINTS_ERROR)
+	}
+}
+
+func TestLoadBalancerEjection(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoints []string
+		failures  map[string][]bool
+		want      map[string]bool
+	}{
+		{name: "ejected after consecutive failures", endpoints: []string{"a", "b"},
+			failures: map[string][]bool{"a": {true, true}},
+			want:     map[string]bool{"a": true}},
+		{name: "success resets the count", endpoints: []string{"a", "b"},
+			failures: map[string][]bool{"a": {true, false, true}},
+			want:     map[string]bool{"a": false}},
+		{name: "max ejected ratio", endpoints: []string{"a", "b"},
+			failures: map[string][]bool{"a": {true, true}, "b": {true, true}},
+			want:     map[string]bool{"a": true, "b": false}},
+		{name: "single endpoint is never ejected", endpoints: []string{"a"},
+			failures: map[string][]bool{"a": {true, true, true}},
+			want:     map[string]bool{"a": false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var endpoints []Endpoint
+			for _, address := range tt.endpoints {
+				endpoints = append(endpoints, Endpoint{Address: address})
+			}
+			lb := NewLoadBalancer("svc", endpoints, LoadBalancerConfig{EjectAfterFailures: 2, EjectionDuration: time.Minute, MaxEjectedRatio: 0.5})
+			defer lb.Close()
+			states := make(map[string]*endpointState)
+			for _, state := range lb.endpoints {
+				states[state.Address] = state
+			}
+
+			for _, address := range tt.endpoints {
+				for _, failed := range tt.failures[address] {
+					lb.record(states[address], failed)
+				}
+			}
+			for address, wantEjected := range tt.want {
+				if ejected := !states[address].available(time.Now()); ejected != wantEjected {
+					t.Errorf("%s ejected = %v, want %v", address, ejected, wantEjected)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadBalancerEjectionBackoff(t *testing.T) {
+	lb := NewLoadBalancer("svc", []Endpoint{{Address: "a"}, {Address: "b"}, {Address: "c"}},
+		LoadBalancerConfig{EjectAfterFailures: 1, EjectionDuration: time.Minute, MaxEjectedRatio: 0.5})
+	defer lb.Close()
+	state := lb.endpoints[0]
+
+	for ejection := 1; ejection <= 3; ejection++ {
+		state.ejectedUntil = time.Time{}
+		lb.record(state, true)
+		duration := time.Until(state.ejectedUntil)
+		if want := time.Duration(ejection) * time.Minute; duration > want || duration < want-time.Second {
+			t.Errorf("ejection %d lasts %v, want %v", ejection, duration, want)
+		}
+		if !state.restoredAt.Equal(state.ejectedUntil) {
+			t.Errorf("ejection %d: slow start begins at %v, want the end of the ejection %v", ejection, state.restoredAt, state.ejectedUntil)
+		}
+	}
+}
+
+// TestLoadBalancerTransportFailures covers which failed requests count toward
+// an ejection: the endpoint failing does, the caller going away does not.
+func TestLoadBalancerTransportFailures(t *testing.T) {
+	tests := []struct {
+		name        string
+		roundTrip   func(req *http.Request) (*http.Response, error)
+		cancel      bool
+		wantEjected bool
+	}{
+		{name: "server errors", roundTrip: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusBadGateway, Body: http.NoBody}, nil
+		}, wantEjected: true},
+		{name: "transport errors", roundTrip: func(req *http.Request) (*http.Response, error) {
+			return nil, errors.New(errors.INTERNAL_ERROR, "connection refused")
+		}, wantEjected: true},
+		{name: "per-attempt timeouts", roundTrip: func(req *http.Request) (*http.Response, error) {
+			return nil, context.DeadlineExceeded
+		}, wantEjected: true},
+		{name: "canceled by the caller", cancel: true, roundTrip: func(req *http.Request) (*http.Response, error) {
+			return nil, req.Context().Err()
+		}, wantEjected: false},
+		{name: "canceled below the balancer", roundTrip: func(req *http.Request) (*http.Response, error) {
+			return nil, context.Canceled
+		}, wantEjected: false},
+		{name: "client errors", roundTrip: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusNotFound, Body: http.NoBody}, nil
+		}, wantEjected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := NewLoadBalancer("svc", []Endpoint{{Address: "a"}, {Address: "b"}},
+				LoadBalancerConfig{EjectAfterFailures: 3, EjectionDuration: time.Minute, MaxEjectedRatio: 0.5})
+			defer lb.Close()
+			transport := &loadBalancingTransport{
+				balancers: map[string]*LoadBalancer{"svc": lb},
+				next:      RoundTripperFunc(tt.roundTrip),
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+			for i := 0; i < 6; i++ {
+				req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://svc/items", nil)
+				if resp, err := transport.RoundTrip(req); err == nil {
+					resp.Body.Close()
+				}
+			}
+
+			ejected := false
+			for _, state := range lb.endpoints {
+				ejected = ejected || !state.available(time.Now())
+				if n := state.outstanding.Load(); n != 0 {
+					t.Errorf("%s has %d outstanding requests after all bodies were closed", state.Address, n)
+				}
+			}
+			if ejected != tt.wantEjected {
+				t.Errorf("an endpoint was ejected = %v, want %v", ejected, tt.wantEjected)
+			}
+		})
+	}
+}
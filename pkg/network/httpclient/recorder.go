@@ -0,0 +1,327 @@
+package httpclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"chaits.org/go-microservices-repo/pkg/errors"
+	"chaits.org/go-microservices-repo/pkg/general/logger"
+)
+
+// RecorderMode selects whether a Recorder talks to the network.
+type RecorderMode string
+
+const (
+	// RECORDER_MODE_RECORD sends requests and writes them with their responses to the cassette.
+	RECORDER_MODE_RECORD RecorderMode = "record"
+	// RECORDER_MODE_REPLAY answers from the cassette and never touches the network.
+	RECORDER_MODE_REPLAY RecorderMode = "replay"
+)
+
+// RECORDER_MODE_ENV overrides the mode of recorders created without one, so
+// cassettes can be re-recorded with HTTPCLIENT_RECORDER_MODE=record go test ./...
+const RECORDER_MODE_ENV = "HTTPCLIENT_RECORDER_MODE"
+
+// RecordedRequest is a request as stored in a cassette. Sensitive headers and
+// JSON fields are redacted.
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// RecordedResponse is a response as stored in a cassette.
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Interaction is one request/response pair.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// Cassette is the file format of a Recorder: a JSON list of interactions.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// MatchConfig selects which parts of a request must equal the recorded one
+// for it to be replayed. JSON bodies are compared by value.
+type MatchConfig struct {
+	Method  bool
+	URL     bool
+	Body    bool
+	Headers []string
+}
+
+// DefaultMatchConfig matches on method and URL.
+func DefaultMatchConfig() MatchConfig {
+	return MatchConfig{Method: true, URL: true}
+}
+
+// Recorder records request/response pairs to a cassette file, or replays them.
+// Replayed interactions are used once each, in recorded order among the
+// interactions that match.
+type Recorder struct {
+	mode  RecorderMode
+	path  string
+	match MatchConfig
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+type RecorderOption func(*Recorder)
+
+// WithMatching sets the fields compared when replaying. Defaults to DefaultMatchConfig.
+func WithMatching(match MatchConfig) RecorderOption {
+	return func(r *Recorder) {
+		r.match = match
+	}
+}
+
+// NewRecorder returns a recorder for the cassette at path. An empty mode reads
+// RECORDER_MODE_ENV and defaults to replay. In replay mode the cassette must exist.
+func NewRecorder(path string, mode RecorderMode, opts ...RecorderOption) (*Recorder, error) {
+	if mode == "" {
+		mode = RecorderMode(os.Getenv(RECORDER_MODE_ENV))
+	}
+	if mode == "" {
+		mode = RECORDER_MODE_REPLAY
+	}
+	r := &Recorder{mode: mode, path: path, match: DefaultMatchConfig()}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	switch mode {
+	case RECORDER_MODE_RECORD:
+	case RECORDER_MODE_REPLAY:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &r.cassette); err != nil {
+			return nil, fmt.Errorf("reading cassette %s: %w", path, err)
+		}
+		r.used = make([]bool, len(r.cassette.Interactions))
+	default:
+		return nil, fmt.Errorf("unknown recorder mode %q", mode)
+	}
+	return r, nil
+}
+
+// Mode returns the mode the recorder runs in.
+func (r *Recorder) Mode() RecorderMode {
+	return r.mode
+}
+
+// Unused returns the recorded interactions that were not replayed, so a test
+// can check that every expected call was made.
+func (r *Recorder) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var unused []Interaction
+	for i, interaction := range r.cassette.Interactions {
+		if !r.used[i] {
+			unused = append(unused, interaction)
+		}
+	}
+	return unused
+}
+
+// WithRecorder records or replays the requests of the client. The recorder
+// sits after authentication and before hedging, load balancing and circuit
+// breaking, so cassettes hold logical URLs such as http://onboarding/hello.
+func WithRecorder(recorder *Recorder) Option {
+	return func(h *HTTPClient) {
+		h.recorder = recorder
+	}
+}
+
+// Interceptor returns the recorder as an interceptor for WithChain.
+func (r *Recorder) Interceptor() Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if r.mode == RECORDER_MODE_REPLAY {
+				return r.replay(req)
+			}
+			return r.record(next, req)
+		})
+	}
+}
+
+func (r *Recorder) record(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	body, req, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	interaction := Interaction{
+		Request: recordRequest(req, body),
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     redactHeader(resp.Header),
+			Body:       string(respBody),
+		},
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	return resp, r.save()
+}
+
+// save writes the whole cassette, so it is complete even if the test stops early.
+func (r *Recorder) save() error {
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, data, 0o644)
+}
+
+func (r *Recorder) replay(req *http.Request) (*http.Response, error) {
+	body, req, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	actual := recordRequest(req, body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var closest []string
+	for i, interaction := range r.cassette.Interactions {
+		if r.used[i] {
+			continue
+		}
+		diff := r.diff(interaction.Request, actual)
+		if len(diff) == 0 {
+			r.used[i] = true
+			return interaction.Response.response(req), nil
+		}
+		if closest == nil || len(diff) < len(closest) {
+			closest = diff
+		}
+	}
+
+	message := fmt.Sprintf("no recorded interaction in %s matches %s %s", r.path, actual.Method, actual.URL)
+	if closest != nil {
+		message += "; closest unused interaction differs in:\n" + strings.Join(closest, "\n")
+	} else {
+		message += fmt.Sprintf("; all %d recorded interactions were already replayed", len(r.cassette.Interactions))
+	}
+	return nil, errors.New(errors.UNRECORDED_REQUEST_ERROR, message)
+}
+
+// diff lists the matched fields in which the actual request differs from the recorded one.
+func (r *Recorder) diff(recorded, actual RecordedRequest) []string {
+	var diff []string
+	if r.match.Method && recorded.Method != actual.Method {
+		diff = append(diff, fieldDiff("method", recorded.Method, actual.Method))
+	}
+	if r.match.URL && recorded.URL != actual.URL {
+		diff = append(diff, fieldDiff("url", recorded.URL, actual.URL))
+	}
+	if r.match.Body && !equalBodies(recorded.Body, actual.Body) {
+		diff = append(diff, fieldDiff("body", recorded.Body, actual.Body))
+	}
+	for _, name := range r.match.Headers {
+		if want, got := recorded.Header.Get(name), actual.Header.Get(name); want != got {
+			diff = append(diff, fieldDiff("header "+http.CanonicalHeaderKey(name), want, got))
+		}
+	}
+	return diff
+}
+
+func fieldDiff(field, recorded, actual string) string {
+	return fmt.Sprintf("  %s:\n    - recorded: %s\n    + actual:   %s", field, recorded, actual)
+}
+
+func equalBodies(a, b string) bool {
+	if a == b {
+		return true
+	}
+	var va, vb any
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return false
+	}
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+	return bytes.Equal(ja, jb)
+}
+
+func recordRequest(req *http.Request, body []byte) RecordedRequest {
+	return RecordedRequest{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: redactHeader(req.Header),
+		Body:   logger.RedactBody(body, req.Header.Get("Content-Type")),
+	}
+}
+
+// redactHeader copies header with the values of credentials replaced by logger.REDACTED.
+func redactHeader(header http.Header) http.Header {
+	if len(header) == 0 {
+		return nil
+	}
+	redacted := make(http.Header, len(header))
+	for name, values := range header {
+		if logger.IsSensitive(name) {
+			redacted[name] = []string{logger.REDACTED}
+		} else {
+			redacted[name] = append([]string(nil), values...)
+		}
+	}
+	return redacted
+}
+
+// readRequestBody returns the request body and a request whose body can still be read.
+func readRequestBody(req *http.Request) ([]byte, *http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, req, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	out.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, out, nil
+}
+
+func (r RecordedResponse) response(req *http.Request) *http.Response {
+	cached := CachedResponse{StatusCode: r.StatusCode, Header: r.Header, Body: []byte(r.Body)}
+	if cached.Header == nil {
+		cached.Header = http.Header{}
+	}
+	return cached.response(req)
+}
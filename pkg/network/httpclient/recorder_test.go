@@ -0,0 +1,208 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"chaits.org/go-microservices-repo/pkg/errors"
+	"chaits.org/go-microservices-repo/pkg/general/logger"
+)
+
+// writeCassette writes interactions to a cassette in a temporary directory.
+func writeCassette(t *testing.T, interactions ...Interaction) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	data, err := json.Marshal(Cassette{Interactions: interactions})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func recorderSend(t *testing.T, transport http.RoundTripper, method, url, body string) (string, error) {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret-token")
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return string(data), nil
+}
+
+func TestRecorderRoundTrip(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, r.Method+" "+string(body))
+	}))
+	path := filepath.Join(t.TempDir(), "cassettes", "items.json")
+
+	recorder, err := NewRecorder(path, RECORDER_MODE_RECORD)
+	if err != nil {
+		t.Fatalf("NewRecorder() error = %v", err)
+	}
+	transport := recorder.Interceptor()(http.DefaultTransport)
+	var recorded []string
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		body, err := recorderSend(t, transport, method, server.URL+"/items", `{"name":"a"}`)
+		if err != nil {
+			t.Fatalf("recording %s: %v", method, err)
+		}
+		recorded = append(recorded, body)
+	}
+	server.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cassette not written: %v", err)
+	}
+	if strings.Contains(string(data), "secret-token") {
+		t.Errorf("cassette holds the bearer token:\n%s", data)
+	}
+	if !strings.Contains(string(data), logger.REDACTED) {
+		t.Errorf("cassette does not redact the Authorization header:\n%s", data)
+	}
+
+	replayer, err := NewRecorder(path, RECORDER_MODE_REPLAY)
+	if err != nil {
+		t.Fatalf("NewRecorder() error = %v", err)
+	}
+	transport = replayer.Interceptor()(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		t.Errorf("replay sent %s %s to the network", req.Method, req.URL)
+		return nil, errors.New(errors.INTERNAL_ERROR, "network used")
+	}))
+	for i, method := range []string{http.MethodGet, http.MethodPost} {
+		body, err := recorderSend(t, transport, method, server.URL+"/items", `{"name":"a"}`)
+		if err != nil {
+			t.Fatalf("replaying %s: %v", method, err)
+		}
+		if body != recorded[i] {
+			t.Errorf("replayed %s body = %q, want %q", method, body, recorded[i])
+		}
+	}
+	if unused := replayer.Unused(); len(unused) != 0 {
+		t.Errorf("%d interactions were not replayed", len(unused))
+	}
+}
+
+func TestRecorderMatching(t *testing.T) {
+	recorded := Interaction{
+		Request:  RecordedRequest{Method: http.MethodPost, URL: "http://onboarding/apps", Body: `{"name":"billing","plan":"free"}`},
+		Response: RecordedResponse{StatusCode: http.StatusCreated, Body: "created"},
+	}
+
+	tests := []struct {
+		name      string
+		match     MatchConfig
+		method    string
+		url       string
+		body      string
+		wantMatch bool
+		wantDiff  string
+	}{
+		{name: "method and URL", match: DefaultMatchConfig(), method: http.MethodPost, url: "http://onboarding/apps", body: "ignored", wantMatch: true},
+		{name: "other URL", match: DefaultMatchConfig(), method: http.MethodPost, url: "http://onboarding/plans", wantDiff: "url"},
+		{name: "other method", match: DefaultMatchConfig(), method: http.MethodPut, url: "http://onboarding/apps", wantDiff: "method"},
+		{name: "method not matched", match: MatchConfig{URL: true}, method: http.MethodPut, url: "http://onboarding/apps", wantMatch: true},
+		{name: "JSON body compared by value", match: MatchConfig{Method: true, URL: true, Body: true},
+			method: http.MethodPost, url: "http://onboarding/apps", body: `{ "plan": "free", "name": "billing" }`, wantMatch: true},
+		{name: "other body", match: MatchConfig{Method: true, URL: true, Body: true},
+			method: http.MethodPost, url: "http://onboarding/apps", body: `{"name":"reports","plan":"free"}`, wantDiff: "body"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, err := NewRecorder(writeCassette(t, recorded), RECORDER_MODE_REPLAY, WithMatching(tt.match))
+			if err != nil {
+				t.Fatalf("NewRecorder() error = %v", err)
+			}
+			body, err := recorderSend(t, recorder.Interceptor()(nil), tt.method, tt.url, tt.body)
+			if tt.wantMatch {
+				if err != nil || body != "created" {
+					t.Errorf("replay = (%q, %v), want the recorded response", body, err)
+				}
+				return
+			}
+			var appErr *errors.AppError
+			if !errors.As(err, &appErr) || appErr.Code != errors.UNRECORDED_REQUEST_ERROR {
+				t.Fatalf("replay error = %v, want %s", err, errors.UNRECORDED_REQUEST_ERROR)
+			}
+			if !strings.Contains(err.Error(), tt.wantDiff+":") {
+				t.Errorf("error does not point at the %s:\n%v", tt.wantDiff, err)
+			}
+		})
+	}
+}
+
+func TestRecorderMiss(t *testing.T) {
+	recorder, err := NewRecorder(writeCassette(t, Interaction{
+		Request:  RecordedRequest{Method: http.MethodGet, URL: "http://onboarding/hello"},
+		Response: RecordedResponse{StatusCode: http.StatusOK, Body: "hello"},
+	}), RECORDER_MODE_REPLAY)
+	if err != nil {
+		t.Fatalf("NewRecorder() error = %v", err)
+	}
+	client := NewHTTPClient(WithRecorder(recorder))
+	get := func() error {
+		req, _ := http.NewRequest(http.MethodGet, "http://onboarding/hello", nil)
+		resp, err := client.Do(context.Background(), req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := get(); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	err = get()
+	var appErr *errors.AppError
+	if !errors.As(err, &appErr) || appErr.Code != errors.UNRECORDED_REQUEST_ERROR {
+		t.Fatalf("second request error = %v, want %s", err, errors.UNRECORDED_REQUEST_ERROR)
+	}
+	if !strings.Contains(err.Error(), "already replayed") {
+		t.Errorf("error does not say the interaction was used: %v", err)
+	}
+}
+
+func TestNewRecorder(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     RecorderMode
+		env      string
+		wantMode RecorderMode
+		wantErr  bool
+	}{
+		{name: "replay needs a cassette", mode: RECORDER_MODE_REPLAY, wantErr: true},
+		{name: "record creates the cassette", mode: RECORDER_MODE_RECORD, wantMode: RECORDER_MODE_RECORD},
+		{name: "mode from the environment", env: "record", wantMode: RECORDER_MODE_RECORD},
+		{name: "unknown mode", mode: "playback", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(RECORDER_MODE_ENV, tt.env)
+			recorder, err := NewRecorder(filepath.Join(t.TempDir(), "cassette.json"), tt.mode)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewRecorder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && recorder.Mode() != tt.wantMode {
+				t.Errorf("Mode() = %s, want %s", recorder.Mode(), tt.wantMode)
+			}
+		})
+	}
+}
@@ -0,0 +1,398 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"chaits.org/go-microservices-repo/pkg/errors"
+	"chaits.org/go-microservices-repo/pkg/general/bulkhead"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Jitter selects how the backoff between attempts is randomised.
+type Jitter int
+
+const (
+	// JitterNone uses plain exponential backoff: Backoff * 2^retry.
+	JitterNone Jitter = iota
+	// JitterFull sleeps a random duration between zero and the exponential backoff.
+	JitterFull
+	// JitterDecorrelated sleeps a random duration between Backoff and three
+	// times the previous sleep, which spreads out clients that failed together.
+	JitterDecorrelated
+)
+
+// maxDrainBytes bounds how much of a discarded response body is read so the
+// connection can be reused.
+const maxDrainBytes = 64 << 10
+
+// RetryPolicy configures how failed requests are retried.
+type RetryPolicy struct {
+	// MaxRetries is the maximum number of attempts, the first one included, so
+	// 3 sends a request at most three times. Values below 1 send it once.
+	MaxRetries int
+
+	// Backoff is the base time duration for exponential backoff between retries.
+	Backoff time.Duration
+
+	// MaxBackoff caps a single wait between attempts. Zero means no cap.
+	MaxBackoff time.Duration
+
+	// MaxElapsed bounds the total time spent on a call, including waits. No
+	// retry is started if its wait would exceed the budget. Zero means no budget.
+	MaxElapsed time.Duration
+
+	// Jitter randomises the backoff.
+	Jitter Jitter
+
+	// RespectRetryAfter waits at least as long as the Retry-After header of a
+	// 429 or 503 response asks for.
+	RespectRetryAfter bool
+
+	// RetryNonIdempotent also retries POST and PATCH requests without an
+	// Idempotency-Key after they were sent. Only use it when the server
+	// deduplicates requests itself.
+	RetryNonIdempotent bool
+
+	// RetryableStatusCodes is a map of HTTP status codes that should trigger a retry.
+	RetryableStatusCodes map[int]bool
+
+	// MaxBufferedBody is how much of a request body without GetBody is buffered
+	// so it can be replayed. Larger bodies are streamed and sent only once.
+	// Zero means DEFAULT_MAX_BUFFERED_BODY_BYTES; negative never buffers.
+	MaxBufferedBody int64
+}
+
+// notReplayableReason tells callers why a request was not retried.
+const notReplayableReason = "the request body cannot be replayed; set req.GetBody or use SetFileBody to allow retries"
+
+// WithRetry retries transport errors and the given status codes with
+// full-jitter exponential backoff, honouring Retry-After, for at most
+// maxRetries attempts in total.
+// POST and PATCH are only retried when they carry an Idempotency-Key, see
+// WithIdempotencyKeys, or when they failed before being sent.
+func WithRetry(maxRetries int, backOffDuration time.Duration, retryableStatusCodes ...int) Option {
+	statusCodeMap := make(map[int]bool)
+	for _, statusCode := range retryableStatusCodes {
+		statusCodeMap[statusCode] = true
+	}
+	return WithRetryPolicy(RetryPolicy{
+		MaxRetries:           maxRetries,
+		Backoff:              backOffDuration,
+		MaxBackoff:           30 * time.Second,
+		Jitter:               JitterFull,
+		RespectRetryAfter:    true,
+		RetryableStatusCodes: statusCodeMap,
+	})
+}
+
+// WithRetryPolicy retries failed requests as described by policy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(h *HTTPClient) {
+		if policy.RetryableStatusCodes == nil {
+			policy.RetryableStatusCodes = map[int]bool{}
+		}
+		h.retryPolicy = &policy
+	}
+}
+
+// RetryAttempt describes the outcome of one attempt of a retried call.
+type RetryAttempt struct {
+	Attempt    int
+	StatusCode int
+	Err        error
+	Duration   time.Duration
+	// Wait is the time waited after this attempt. Zero for the last attempt.
+	Wait time.Duration
+}
+
+// RetryHistory is the cause of an ALL_RETRIES_FAILED_ERROR. It lists every
+// attempt and unwraps to the error that ended the call, so errors.Is(err,
+// context.Canceled) works when the caller gave up.
+type RetryHistory struct {
+	Attempts []RetryAttempt
+	Cause    error
+}
+
+func (h *RetryHistory) Error() string {
+	parts := make([]string, 0, len(h.Attempts))
+	for _, attempt := range h.Attempts {
+		outcome := fmt.Sprintf("status %d", attempt.StatusCode)
+		if attempt.Err != nil {
+			outcome = attempt.Err.Error()
+		}
+		parts = append(parts, fmt.Sprintf("attempt %d: %s after %v", attempt.Attempt, outcome, attempt.Duration.Round(time.Millisecond)))
+	}
+	// The cause is usually the last attempt's error, which is already listed.
+	if h.Cause != nil && (len(h.Attempts) == 0 || h.Attempts[len(h.Attempts)-1].Err != h.Cause) {
+		parts = append(parts, h.Cause.Error())
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (h *RetryHistory) Unwrap() error {
+	return h.Cause
+}
+
+// backoff returns the wait before retry number retry (starting at 1).
+// previous is the previous wait, used by decorrelated jitter.
+func (p *RetryPolicy) backoff(retry int, previous time.Duration) time.Duration {
+	var wait time.Duration
+	switch p.Jitter {
+	case JitterFull:
+		wait = randomDuration(0, p.exponential(retry))
+	case JitterDecorrelated:
+		if previous < p.Backoff {
+			previous = p.Backoff
+		}
+		wait = randomDuration(p.Backoff, 3*previous)
+	default:
+		wait = p.exponential(retry)
+	}
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	return wait
+}
+
+// exponential returns Backoff * 2^(retry-1), guarding against overflow.
+func (p *RetryPolicy) exponential(retry int) time.Duration {
+	wait := p.Backoff
+	for i := 1; i < retry; i++ {
+		if wait > time.Duration(1<<62)/2 || (p.MaxBackoff > 0 && wait >= p.MaxBackoff) {
+			break
+		}
+		wait *= 2
+	}
+	return wait
+}
+
+func randomDuration(min, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	return min + time.Duration(rand.Int63n(int64(max-min)))
+}
+
+// retryAfter parses the Retry-After header of a 429 or 503 response. It
+// accepts both delay-seconds and an HTTP date.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		wait := at.Sub(now)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// discard drains and closes a response that will not be returned to the caller.
+func discard(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+	resp.Body.Close()
+}
+
+// retryTransport retries failed requests as described by policy. Each attempt
+// is a clone of the request, so the interceptors below it see a fresh request.
+type retryTransport struct {
+	next   http.RoundTripper
+	policy RetryPolicy
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	policy := &t.policy
+	ctx := req.Context()
+	span := trace.SpanFromContext(ctx)
+	idempotent := policy.RetryNonIdempotent || isIdempotent(req)
+
+	body, getBody, err := policy.replayableBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if getBody == nil && body != nil {
+		return t.sendOnce(req, body, span)
+	}
+
+	start := time.Now()
+	history := &RetryHistory{}
+	var wait time.Duration
+	for attempt := 1; ; attempt++ {
+		attemptReq, tracker := withWriteTracker(req)
+		if getBody != nil {
+			if attempt > 1 {
+				if body, err = getBody(); err != nil {
+					return nil, errors.Wrap(errors.ALL_RETRIES_FAILED_ERROR, "rewinding the request body failed", err)
+				}
+			}
+			attemptReq.Body = body
+			attemptReq.GetBody = getBody
+		}
+
+		attemptStart := time.Now()
+		resp, err := t.next.RoundTrip(attemptReq)
+		record := RetryAttempt{Attempt: attempt, Err: err, Duration: time.Since(attemptStart)}
+		if resp != nil {
+			record.StatusCode = resp.StatusCode
+		}
+
+		if err == nil && !policy.RetryableStatusCodes[resp.StatusCode] {
+			return resp, nil
+		}
+		if isCircuitOpen(err) || bulkhead.IsRejection(err) {
+			// Retrying would only add load to a dependency that is already shedding it.
+			return nil, err
+		}
+		// A request that was not written can always be retried. Once the server
+		// may have seen it, only idempotent requests are repeated.
+		if !idempotent && (err == nil || tracker.started.Load()) {
+			return resp, err
+		}
+		if ctx.Err() != nil {
+			history.Attempts = append(history.Attempts, record)
+			history.Cause = ctx.Err()
+			discard(resp)
+			return nil, errors.Wrap(errors.ALL_RETRIES_FAILED_ERROR, fmt.Sprintf("gave up after %d attempts", attempt), history)
+		}
+		if attempt >= policy.MaxRetries {
+			history.Attempts = append(history.Attempts, record)
+			history.Cause = err
+			discard(resp)
+			return nil, errors.Wrap(errors.ALL_RETRIES_FAILED_ERROR, fmt.Sprintf("all %d attempts failed", attempt), history)
+		}
+
+		wait = policy.backoff(attempt, wait)
+		if delay, ok := retryAfter(resp, time.Now()); ok && policy.RespectRetryAfter && delay > wait {
+			wait = delay
+		}
+		if policy.MaxElapsed > 0 && time.Since(start)+wait > policy.MaxElapsed {
+			history.Attempts = append(history.Attempts, record)
+			history.Cause = err
+			discard(resp)
+			return nil, errors.Wrap(errors.ALL_RETRIES_FAILED_ERROR, fmt.Sprintf("retry budget of %v exhausted after %d attempts", policy.MaxElapsed, attempt), history)
+		}
+
+		record.Wait = wait
+		history.Attempts = append(history.Attempts, record)
+		discard(resp)
+
+		span.AddEvent("retry", trace.WithAttributes(retryEventAttributes(attempt, wait, resp, err)...))
+		log.Printf("Request Failed. (attempt %d of %d). Retrying in %v.", attempt, max(policy.MaxRetries, 1), wait)
+		if err := sleep(ctx, wait); err != nil {
+			history.Cause = err
+			return nil, errors.Wrap(errors.ALL_RETRIES_FAILED_ERROR, fmt.Sprintf("gave up after %d attempts", attempt), history)
+		}
+	}
+}
+
+// replayableBody returns the body of the first attempt and a function that
+// returns it again for the following ones. Bodies without GetBody are buffered
+// up to MaxBufferedBody; a nil getBody with a non-nil body means the body
+// cannot be replayed. Large bodies are never held in memory.
+func (p *RetryPolicy) replayableBody(req *http.Request) (body io.ReadCloser, getBody func() (io.ReadCloser, error), err error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil, nil
+	}
+	if req.GetBody != nil {
+		return req.Body, req.GetBody, nil
+	}
+
+	limit := p.MaxBufferedBody
+	if limit == 0 {
+		limit = DEFAULT_MAX_BUFFERED_BODY_BYTES
+	}
+	if limit < 0 || req.ContentLength > limit {
+		return req.Body, nil, nil
+	}
+	prefix, complete, err := readPrefix(req.Body, limit)
+	if err != nil {
+		req.Body.Close()
+		return nil, nil, err
+	}
+	if !complete {
+		return withPrefix(prefix, req.Body), nil, nil
+	}
+	req.Body.Close()
+	getBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(prefix)), nil
+	}
+	body, _ = getBody()
+	return body, getBody, nil
+}
+
+// sendOnce sends a request whose body cannot be replayed. When the attempt
+// fails in a way that would have been retried, the caller is told why it was not.
+func (t *retryTransport) sendOnce(req *http.Request, body io.ReadCloser, span trace.Span) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.Body = body
+	resp, err := t.next.RoundTrip(out)
+	if isCircuitOpen(err) || bulkhead.IsRejection(err) {
+		return nil, err
+	}
+	if err == nil && !t.policy.RetryableStatusCodes[resp.StatusCode] {
+		return resp, nil
+	}
+
+	span.AddEvent("retry.skipped", trace.WithAttributes(attribute.String("http.retry.reason", notReplayableReason)))
+	if err != nil {
+		return nil, errors.Wrap(errors.BODY_NOT_REPLAYABLE_ERROR, "request failed and was not retried: "+notReplayableReason, err)
+	}
+	log.Printf("Request %s %s failed with status %d and was not retried: %s.", req.Method, req.URL.Path, resp.StatusCode, notReplayableReason)
+	return resp, nil
+}
+
+func isCircuitOpen(err error) bool {
+	var appErr *errors.AppError
+	return errors.As(err, &appErr) && appErr.Code == errors.CIRCUIT_OPEN_ERROR
+}
+
+// retryEventAttributes describes why an attempt is retried.
+func retryEventAttributes(attempt int, backoff time.Duration, resp *http.Response, err error) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.Int("http.retry.attempt", attempt),
+		attribute.Int64("http.retry.backoff_ms", backoff.Milliseconds()),
+	}
+	if err != nil {
+		attrs = append(attrs, attribute.String("http.retry.reason", err.Error()))
+	} else if resp != nil {
+		attrs = append(attrs, attribute.Int("http.status_code", resp.StatusCode))
+	}
+	return attrs
+}
@@ -0,0 +1,147 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"chaits.org/go-microservices-repo/pkg/errors"
+)
+
+func TestRetryAttempts(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxRetries   int
+		method       string
+		opts         []Option
+		failures     int
+		wantAttempts int32
+		wantErr      bool
+	}{
+		{name: "max retries is the total number of attempts", maxRetries: 3, method: http.MethodGet, failures: 10, wantAttempts: 3, wantErr: true},
+		{name: "one attempt", maxRetries: 1, method: http.MethodGet, failures: 10, wantAttempts: 1, wantErr: true},
+		{name: "below one sends once", maxRetries: 0, method: http.MethodGet, failures: 10, wantAttempts: 1, wantErr: true},
+		{name: "succeeds on the second attempt", maxRetries: 3, method: http.MethodGet, failures: 1, wantAttempts: 2},
+		{name: "POST without Idempotency-Key is sent once", maxRetries: 3, method: http.MethodPost, failures: 10, wantAttempts: 1},
+		{name: "POST with Idempotency-Key is retried", maxRetries: 3, method: http.MethodPost, opts: []Option{WithIdempotencyKeys()}, failures: 10, wantAttempts: 3, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if attempts.Add(1) <= int32(tt.failures) {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			opts := append([]Option{WithRetry(tt.maxRetries, time.Millisecond, http.StatusServiceUnavailable)}, tt.opts...)
+			client := NewHTTPClient(opts...)
+			req, _ := http.NewRequest(tt.method, server.URL, strings.NewReader("{}"))
+			resp, err := client.Do(context.Background(), req)
+			if err == nil {
+				resp.Body.Close()
+			}
+
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("server saw %d attempts, want %d", got, tt.wantAttempts)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var appErr *errors.AppError
+			if tt.wantErr && (!errors.As(err, &appErr) || appErr.Code != errors.ALL_RETRIES_FAILED_ERROR) {
+				t.Errorf("Do() error = %v, want %s", err, errors.ALL_RETRIES_FAILED_ERROR)
+			}
+		})
+	}
+}
+
+func TestRetryStopsWhenCanceled(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(WithRetry(5, time.Hour, http.StatusServiceUnavailable))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	_, err := client.Do(ctx, req)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Do() error = %v, want it to wrap context.DeadlineExceeded", err)
+	}
+	if got := attempts.Load(); got != 1 {
+		t.Errorf("server saw %d attempts, want 1", got)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		retry    int
+		previous time.Duration
+		min, max time.Duration
+	}{
+		{name: "first retry", policy: RetryPolicy{Backoff: 100 * time.Millisecond}, retry: 1, min: 100 * time.Millisecond, max: 100 * time.Millisecond},
+		{name: "exponential", policy: RetryPolicy{Backoff: 100 * time.Millisecond}, retry: 4, min: 800 * time.Millisecond, max: 800 * time.Millisecond},
+		{name: "capped", policy: RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: 250 * time.Millisecond}, retry: 4, min: 250 * time.Millisecond, max: 250 * time.Millisecond},
+		{name: "no overflow", policy: RetryPolicy{Backoff: time.Second}, retry: 100, min: time.Duration(1 << 61), max: time.Duration(1<<63 - 1)},
+		{name: "full jitter", policy: RetryPolicy{Backoff: 100 * time.Millisecond, Jitter: JitterFull}, retry: 3, min: 0, max: 400 * time.Millisecond},
+		{name: "decorrelated jitter", policy: RetryPolicy{Backoff: 100 * time.Millisecond, Jitter: JitterDecorrelated}, retry: 3, previous: 200 * time.Millisecond, min: 100 * time.Millisecond, max: 600 * time.Millisecond},
+		{name: "decorrelated jitter capped", policy: RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: 150 * time.Millisecond, Jitter: JitterDecorrelated}, retry: 3, previous: time.Second, min: 100 * time.Millisecond, max: 150 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if got := tt.policy.backoff(tt.retry, tt.previous); got < tt.min || got > tt.max {
+					t.Fatalf("backoff(%d, %v) = %v, want between %v and %v", tt.retry, tt.previous, got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		status int
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{name: "seconds", status: http.StatusTooManyRequests, header: "2", want: 2 * time.Second, ok: true},
+		{name: "HTTP date", status: http.StatusServiceUnavailable, header: now.Add(5 * time.Second).Format(http.TimeFormat), want: 5 * time.Second, ok: true},
+		{name: "date in the past", status: http.StatusServiceUnavailable, header: now.Add(-time.Minute).Format(http.TimeFormat), want: 0, ok: true},
+		{name: "negative", status: http.StatusTooManyRequests, header: "-1"},
+		{name: "invalid", status: http.StatusTooManyRequests, header: "soon"},
+		{name: "missing", status: http.StatusTooManyRequests},
+		{name: "ignored on other statuses", status: http.StatusInternalServerError, header: "2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			if tt.header != "" {
+				resp.Header.Set("Retry-After", tt.header)
+			}
+			got, ok := retryAfter(resp, now)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("retryAfter() = (%v, %v), want (%v, %v)", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"chaits.org/go-microservices-repo/pkg/general/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Request phases reported in dependency_phase_duration_seconds.
+const (
+	PHASE_WAIT_CONN = "wait_conn"
+	PHASE_DNS       = "dns"
+	PHASE_CONNECT   = "connect"
+	PHASE_TLS       = "tls"
+	PHASE_SERVER    = "server"
+)
+
+// ConnectionTimings breaks one attempt down into its phases. DNS, Connect and
+// TLS are zero when a pooled connection was reused.
+type ConnectionTimings struct {
+	// WaitConn is the time from asking the pool for a connection to getting one,
+	// which includes DNS, Connect and TLS for a new connection.
+	WaitConn time.Duration
+	DNS      time.Duration
+	Connect  time.Duration
+	TLS      time.Duration
+	// Server is the time from writing the request to the first response byte.
+	Server time.Duration
+	// Total is the time until the response headers were read.
+	Total  time.Duration
+	Reused bool
+}
+
+// WithConnectionTiming records the phases of every attempt as span events and
+// attributes and in dependency_phase_duration_seconds. Attempts that take at
+// least slowThreshold are logged with their timings. Zero disables the log.
+func WithConnectionTiming(slowThreshold time.Duration) Option {
+	return func(h *HTTPClient) {
+		h.connectionTiming = true
+		h.slowThreshold = slowThreshold
+	}
+}
+
+// TimingInterceptor records connection timings, see WithConnectionTiming. It
+// belongs right after TracingInterceptor, so the events land on the attempt span.
+func TimingInterceptor(slowThreshold time.Duration) Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			recorder := &timingRecorder{span: trace.SpanFromContext(req.Context())}
+			ctx := httptrace.WithClientTrace(req.Context(), recorder.clientTrace())
+
+			start := time.Now()
+			resp, err := next.RoundTrip(req.WithContext(ctx))
+			timings := recorder.finish(time.Since(start))
+
+			dependency := DependencyName(req)
+			recordTimings(dependency, timings)
+			recorder.span.SetAttributes(timingAttributes(timings)...)
+			if slowThreshold > 0 && timings.Total >= slowThreshold {
+				log.Printf("Slow request %s %s to %s took %v: wait_conn=%v dns=%v connect=%v tls=%v server=%v reused=%t",
+					req.Method, req.URL.Path, dependency, timings.Total, timings.WaitConn, timings.DNS,
+					timings.Connect, timings.TLS, timings.Server, timings.Reused)
+			}
+			return resp, err
+		})
+	}
+}
+
+// timingRecorder collects the httptrace callbacks of one attempt. Dialing may
+// call them from several goroutines.
+type timingRecorder struct {
+	span trace.Span
+
+	mu                                  sync.Mutex
+	getConn, dnsStart, connectStart     time.Time
+	tlsStart, wroteRequest              time.Time
+	waitConn, dns, connect, tls, server time.Duration
+	reused                              bool
+}
+
+func (r *timingRecorder) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(string) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.getConn = time.Now()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.reused = info.Reused
+			r.waitConn = since(r.getConn)
+			r.span.AddEvent("http.got_conn", trace.WithAttributes(attribute.Bool("http.conn.reused", info.Reused)))
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.dnsStart = time.Now()
+			r.span.AddEvent("http.dns.start")
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.dns = since(r.dnsStart)
+			r.span.AddEvent("http.dns.done")
+		},
+		ConnectStart: func(string, string) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if r.connectStart.IsZero() {
+				r.connectStart = time.Now()
+				r.span.AddEvent("http.connect.start")
+			}
+		},
+		ConnectDone: func(network, addr string, err error) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if err == nil && r.connect == 0 {
+				r.connect = since(r.connectStart)
+				r.span.AddEvent("http.connect.done", trace.WithAttributes(attribute.String("net.peer.address", addr)))
+			}
+		},
+		TLSHandshakeStart: func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.tlsStart = time.Now()
+			r.span.AddEvent("http.tls.start")
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.tls = since(r.tlsStart)
+			r.span.AddEvent("http.tls.done")
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.wroteRequest = time.Now()
+			r.span.AddEvent("http.wrote_request")
+		},
+		GotFirstResponseByte: func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.server = since(r.wroteRequest)
+			r.span.AddEvent("http.first_response_byte")
+		},
+	}
+}
+
+func (r *timingRecorder) finish(total time.Duration) ConnectionTimings {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return ConnectionTimings{
+		WaitConn: r.waitConn,
+		DNS:      r.dns,
+		Connect:  r.connect,
+		TLS:      r.tls,
+		Server:   r.server,
+		Total:    total,
+		Reused:   r.reused,
+	}
+}
+
+func since(start time.Time) time.Duration {
+	if start.IsZero() {
+		return 0
+	}
+	return time.Since(start)
+}
+
+// recordTimings observes the phases that took place in this attempt.
+func recordTimings(dependency string, timings ConnectionTimings) {
+	metrics.RecordDependencyPhase(dependency, PHASE_WAIT_CONN, timings.WaitConn)
+	if !timings.Reused {
+		metrics.RecordDependencyPhase(dependency, PHASE_DNS, timings.DNS)
+		metrics.RecordDependencyPhase(dependency, PHASE_CONNECT, timings.Connect)
+	}
+	if timings.TLS > 0 {
+		metrics.RecordDependencyPhase(dependency, PHASE_TLS, timings.TLS)
+	}
+	if timings.Server > 0 {
+		metrics.RecordDependencyPhase(dependency, PHASE_SERVER, timings.Server)
+	}
+	metrics.IncrementDependencyConnections(dependency, timings.Reused)
+}
+
+func timingAttributes(timings ConnectionTimings) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Bool("http.conn.reused", timings.Reused),
+		attribute.Float64("http.timing.wait_conn_ms", milliseconds(timings.WaitConn)),
+		attribute.Float64("http.timing.dns_ms", milliseconds(timings.DNS)),
+		attribute.Float64("http.timing.connect_ms", milliseconds(timings.Connect)),
+		attribute.Float64("http.timing.tls_ms", milliseconds(timings.TLS)),
+		attribute.Float64("http.timing.server_ms", milliseconds(timings.Server)),
+		attribute.Float64("http.timing.total_ms", milliseconds(timings.Total)),
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// transport returns the *http.Transport at the bottom of the chain, cloning
+// http.DefaultTransport the first time a pool option is applied.
+func (h *HTTPClient) transport() *http.Transport {
+	if t, ok := h.httpclient.Transport.(*http.Transport); ok {
+		return t
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	h.httpclient.Transport = t
+	return t
+}
+
+// WithMaxIdleConns caps the idle connections kept across all hosts. Zero means no limit.
+func WithMaxIdleConns(n int) Option {
+	return func(h *HTTPClient) {
+		h.transport().MaxIdleConns = n
+	}
+}
+
+// WithMaxIdleConnsPerHost caps the idle connections kept per host. Defaults to 2.
+func WithMaxIdleConnsPerHost(n int) Option {
+	return func(h *HTTPClient) {
+		h.transport().MaxIdleConnsPerHost = n
+	}
+}
+
+// WithMaxConnsPerHost caps the connections per host, idle or in use. Requests
+// over the cap wait for a connection, which shows up as wait_conn time.
+func WithMaxConnsPerHost(n int) Option {
+	return func(h *HTTPClient) {
+		h.transport().MaxConnsPerHost = n
+	}
+}
+
+// WithIdleConnTimeout closes connections that were idle for longer than d.
+func WithIdleConnTimeout(d time.Duration) Option {
+	return func(h *HTTPClient) {
+		h.transport().IdleConnTimeout = d
+	}
+}
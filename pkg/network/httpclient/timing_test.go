@@ -0,0 +1,124 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"chaits.org/go-microservices-repo/pkg/general/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTimingInterceptor(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer(tracerName)
+	transport := TimingInterceptor(0)(server.Client().Transport)
+	newConns := metrics.DependencyConnectionsTotal.WithLabelValues("onboarding-timing", "false")
+	reusedConns := metrics.DependencyConnectionsTotal.WithLabelValues("onboarding-timing", "true")
+	newBefore, reusedBefore := testutil.ToFloat64(newConns), testutil.ToFloat64(reusedConns)
+
+	for i := 0; i < 2; i++ {
+		ctx, span := tracer.Start(withDependencyName(context.Background(), "onboarding-timing"), "attempt")
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/hello", nil)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip() %d error = %v", i, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		span.End()
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("%d spans ended, want 2", len(spans))
+	}
+	first, second := spans[0], spans[1]
+	if spanAttr(first, "http.conn.reused").AsBool() || !spanAttr(second, "http.conn.reused").AsBool() {
+		t.Errorf("reused = %v, %v, want a new connection and then a pooled one",
+			spanAttr(first, "http.conn.reused").AsBool(), spanAttr(second, "http.conn.reused").AsBool())
+	}
+	for _, key := range []string{"http.timing.connect_ms", "http.timing.tls_ms"} {
+		if spanAttr(first, key).AsFloat64() <= 0 || spanAttr(second, key).AsFloat64() != 0 {
+			t.Errorf("%s = %v, %v, want it on the new connection only", key, spanAttr(first, key).AsFloat64(), spanAttr(second, key).AsFloat64())
+		}
+	}
+	for i, span := range spans {
+		if server := spanAttr(span, "http.timing.server_ms").AsFloat64(); server < 20 {
+			t.Errorf("attempt %d server time = %vms, want at least the handler's 20ms", i+1, server)
+		}
+		if total := spanAttr(span, "http.timing.total_ms").AsFloat64(); total < spanAttr(span, "http.timing.server_ms").AsFloat64() {
+			t.Errorf("attempt %d total time %vms is below its server time", i+1, total)
+		}
+	}
+	events := map[string]bool{}
+	for _, event := range first.Events {
+		events[event.Name] = true
+	}
+	for _, want := range []string{"http.got_conn", "http.connect.done", "http.tls.done", "http.wrote_request", "http.first_response_byte"} {
+		if !events[want] {
+			t.Errorf("first attempt lacks the %s event", want)
+		}
+	}
+
+	if got := testutil.ToFloat64(newConns) - newBefore; got != 1 {
+		t.Errorf("new connections counted = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(reusedConns) - reusedBefore; got != 1 {
+		t.Errorf("reused connections counted = %v, want 1", got)
+	}
+}
+
+func TestTimingInterceptorSlowThreshold(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		wantLog   bool
+	}{
+		{name: "disabled", threshold: 0},
+		{name: "below the threshold", threshold: time.Minute},
+		{name: "slow", threshold: 10 * time.Millisecond, wantLog: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			output := log.Writer()
+			log.SetOutput(&buf)
+			t.Cleanup(func() { log.SetOutput(output) })
+
+			req, _ := http.NewRequest(http.MethodGet, server.URL+"/slow", nil)
+			resp, err := TimingInterceptor(tt.threshold)(http.DefaultTransport).RoundTrip(req)
+			if err != nil {
+				t.Fatalf("RoundTrip() error = %v", err)
+			}
+			resp.Body.Close()
+
+			logged := strings.Contains(buf.String(), "Slow request GET /slow")
+			if logged != tt.wantLog {
+				t.Errorf("slow request logged = %v, want %v:\n%s", logged, tt.wantLog, buf.String())
+			}
+			if tt.wantLog && !strings.Contains(buf.String(), "server=") {
+				t.Errorf("slow request log lacks the timings:\n%s", buf.String())
+			}
+		})
+	}
+}
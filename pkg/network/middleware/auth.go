@@ -1,44 +1,129 @@
 package middleware
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 
 	"chaits.org/go-microservices-repo/internal/repositories"
+	apperrors "chaits.org/go-microservices-repo/pkg/errors"
 )
 
-// WithAPIKeyAuth is a middleware that validates an API key from a request header
-// by checking it against the database.
-func WithAPIKeyAuth(appRepo repositories.AppRepository) func(http.Handler) http.Handler {
+// AuthError is the body of the 401, 403 and 500 responses of the auth
+// middleware. It has the problem details shape decoded by httpclient, with
+// Code one of the errors constants.
+type AuthError struct {
+	Status int    `json:"status"`
+	Title  string `json:"title"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+	// challenge is sent in WWW-Authenticate with a 401.
+	challenge string
+}
+
+func (e *AuthError) Error() string {
+	return e.Code + ": " + e.Detail
+}
+
+// ErrNoCredentials is returned by an Authenticator when the request does not
+// carry its kind of credential, so that WithAnyAuth tries the next one.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authenticator checks one kind of credential. It returns the request with the
+// identity in its context, ErrNoCredentials, or an error that rejects the
+// request: an *AuthError, or any other error for a 500.
+type Authenticator func(r *http.Request) (*http.Request, error)
+
+// WithAnyAuth accepts a request that carries any of the credentials of
+// authenticators. They are tried in order and the first one whose credential
+// is present decides, so an invalid credential is rejected even if a later
+// authenticator would have accepted the request.
+func WithAnyAuth(authenticators ...Authenticator) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Get the API key from the X-API-Key header.
-			appName := r.Header.Get("X-App-Name")
-			apiKey := r.Header.Get("X-API-Key")
-
-			if apiKey == "" {
-				log.Println("Unauthorized: API key is missing.")
-				http.Error(w, "Unauthorized: API Key Missing", http.StatusUnauthorized)
+			for _, authenticate := range authenticators {
+				authenticated, err := authenticate(r)
+				if errors.Is(err, ErrNoCredentials) {
+					continue
+				}
+				if err != nil {
+					writeAuthError(w, err)
+					return
+				}
+				next.ServeHTTP(w, authenticated)
 				return
 			}
 
-			// Validate the API key using a database lookup.
-			_, ok, err := appRepo.ValidateAPIKey(r.Context(), appName, apiKey)
-			if err != nil {
-				log.Printf("Error validating API key: %v", err)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-				return
-			}
-			if !ok {
-				log.Printf("Unauthorized: Invalid API key '%s' for App '%s'", apiKey, appName)
-				http.Error(w, "Unauthorized: Invalid API Key", http.StatusUnauthorized)
-				return
-			}
+			log.Println("Unauthorized: credentials are missing.")
+			writeAuthError(w, &AuthError{
+				Status: http.StatusUnauthorized,
+				Code:   apperrors.MISSING_CREDENTIALS_ERROR,
+				Detail: "Unauthorized: Credentials Missing",
+			})
+		})
+	}
+}
 
-			log.Printf("Authenticated: Request with valid API key")
+func writeAuthError(w http.ResponseWriter, err error) {
+	var authErr *AuthError
+	if !errors.As(err, &authErr) {
+		authErr = &AuthError{Status: http.StatusInternalServerError, Code: apperrors.INTERNAL_ERROR, Detail: "Internal Server Error"}
+	}
+	if authErr.Title == "" {
+		authErr.Title = http.StatusText(authErr.Status)
+	}
+	if authErr.challenge != "" {
+		w.Header().Set("WWW-Authenticate", authErr.challenge)
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(authErr.Status)
+	json.NewEncoder(w).Encode(authErr)
+}
 
-			// If the key is valid, proceed to the next handler.
-			next.ServeHTTP(w, r)
-		})
+type appNameKey struct{}
+
+// AppNameFromContext returns the app authenticated by WithAPIKeyAuth.
+func AppNameFromContext(ctx context.Context) (string, bool) {
+	appName, ok := ctx.Value(appNameKey{}).(string)
+	return appName, ok
+}
+
+// WithAPIKeyAuth is a middleware that validates an API key from a request header
+// by checking it against the database. The name of the authenticated app is
+// available to later handlers through AppNameFromContext.
+func WithAPIKeyAuth(appRepo repositories.AppRepository) func(http.Handler) http.Handler {
+	return WithAnyAuth(APIKeyAuthenticator(appRepo))
+}
+
+// APIKeyAuthenticator checks the X-App-Name and X-API-Key headers, see WithAPIKeyAuth.
+func APIKeyAuthenticator(appRepo repositories.AppRepository) Authenticator {
+	return func(r *http.Request) (*http.Request, error) {
+		// Get the API key from the X-API-Key header.
+		appName := r.Header.Get("X-App-Name")
+		apiKey := r.Header.Get("X-API-Key")
+
+		if apiKey == "" {
+			return nil, ErrNoCredentials
+		}
+
+		// Validate the API key using a database lookup.
+		_, ok, err := appRepo.ValidateAPIKey(r.Context(), appName, apiKey)
+		if err != nil {
+			log.Printf("Error validating API key: %v", err)
+			return nil, err
+		}
+		if !ok {
+			log.Printf("Unauthorized: Invalid API key '%s' for App '%s'", apiKey, appName)
+			return nil, &AuthError{
+				Status: http.StatusUnauthorized,
+				Code:   apperrors.INVALID_CREDENTIALS_ERROR,
+				Detail: "Unauthorized: Invalid API Key",
+			}
+		}
+
+		log.Printf("Authenticated: Request with valid API key")
+		return r.WithContext(context.WithValue(r.Context(), appNameKey{}, appName)), nil
 	}
 }
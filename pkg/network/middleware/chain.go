@@ -21,14 +21,34 @@ func NewManager(m ...func(http.Handler) http.Handler) *Manager {
 	}
 }
 
-// AllMiddlewareManager returns a new Manager with the given middleware.
-func AllMiddlewareManager(serviceName string, appRepo repositories.AppRepository) *Manager {
+// AllMiddlewareManager returns a new Manager with the given middleware. Requests
+// need an API key; routes that accept bearer tokens build their own chain with
+// WithJWTAuth or WithAnyAuth. Apps are limited by rateLimits, see
+// AppRateLimitConfigFromApp.
+func AllMiddlewareManager(serviceName string, appRepo repositories.AppRepository, rateLimits AppRateLimitConfig) *Manager {
 	return NewManager(
 		WithLogging,
 		WithPrometheusMetrics(serviceName),
 		WithCORS,
-		WithRateLimiter(100, time.Minute),
+		WithRateLimiter(rateLimits.IPRequestsPerMinute, time.Minute),
 		WithAPIKeyAuth(appRepo),
+		WithAppRateLimiter(appRepo, rateLimits),
+	)
+}
+
+// ROLE_ADMIN is the role of bearer tokens allowed through AdminMiddlewareManager.
+const ROLE_ADMIN = "admin"
+
+// AdminMiddlewareManager returns a Manager for administrative routes. Requests
+// need a bearer token issued for serviceName with the ROLE_ADMIN role; API
+// keys are rejected, since any app holds one.
+func AdminMiddlewareManager(serviceName string) *Manager {
+	return NewManager(
+		WithLogging,
+		WithPrometheusMetrics(serviceName),
+		WithCORS,
+		WithJWTAuth(serviceName),
+		RequireRoles(RoleRule{AllOf: []string{ROLE_ADMIN}}),
 	)
 }
 
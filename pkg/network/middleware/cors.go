@@ -1,32 +1,269 @@
 package middleware
 
 import (
+	"fmt"
 	"log"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"chaits.org/go-microservices-repo/pkg/general/config"
 )
 
+// CORSPolicy describes which cross-origin requests a route accepts.
+type CORSPolicy struct {
+	// AllowedOrigins are exact origins such as "https://app.example.com",
+	// wildcard subdomains such as "https://*.example.com", or "*" for any origin.
+	AllowedOrigins []string
+	AllowedMethods []string
+	// AllowedHeaders are the request headers a preflight may ask for. "*" allows any.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers scripts may read.
+	ExposedHeaders []string
+	// AllowCredentials lets browsers send cookies and Authorization. The
+	// request origin is then echoed, as browsers require, so it cannot be
+	// combined with the "*" origin.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight answer. Zero omits the header.
+	MaxAge time.Duration
+}
+
+// CORSRoute applies a policy to the paths under PathPrefix, which must not be empty.
+type CORSRoute struct {
+	PathPrefix string
+	Policy     CORSPolicy
+}
+
+// CORSConfig is the default policy plus per-route overrides. The route with
+// the longest matching prefix wins.
+type CORSConfig struct {
+	Default CORSPolicy
+	Routes  []CORSRoute
+}
+
+// Validate rejects policies that allow any origin with credentials, which
+// would let every site make credentialed requests, and routes without a path.
+func (c CORSConfig) Validate() error {
+	if err := c.Default.validate(); err != nil {
+		return fmt.Errorf("default CORS policy: %w", err)
+	}
+	for _, route := range c.Routes {
+		if route.PathPrefix == "" {
+			return fmt.Errorf("CORS route without a path")
+		}
+		if err := route.Policy.validate(); err != nil {
+			return fmt.Errorf("CORS policy of %s: %w", route.PathPrefix, err)
+		}
+	}
+	return nil
+}
+
+func (p CORSPolicy) validate() error {
+	if p.AllowCredentials && containsFold(p.AllowedOrigins, "*") {
+		return fmt.Errorf(`origin "*" cannot be combined with allow_credentials`)
+	}
+	return nil
+}
+
+// DefaultCORSPolicy allows any origin without credentials, the common methods
+// and the headers used by our clients, including X-API-Key and X-App-Name. The
+// rate limit headers are exposed to scripts.
+func DefaultCORSPolicy() CORSPolicy {
+	return CORSPolicy{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-API-Key", "X-App-Name", "Idempotency-Key"},
+		ExposedHeaders: []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"},
+		MaxAge:         10 * time.Minute,
+	}
+}
+
 // WithCORS is an HTTP middleware that adds Cross-Origin Resource Sharing (CORS)
-// headers to the response. It also handles preflight OPTIONS requests,
-// ensuring your API can be consumed by web clients from different domains.
+// headers to the response with DefaultCORSPolicy. It also handles preflight
+// OPTIONS requests, ensuring your API can be consumed by web clients from
+// different domains.
 func WithCORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Set headers to allow all origins, common methods, and common headers.
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	return WithCORSConfig(CORSConfig{Default: DefaultCORSPolicy()})(next)
+}
 
-		// Log the request and the CORS headers being set.
-		log.Printf("CORS middleware: Setting headers for Method: %s, Origin: %s", r.Method, r.Header.Get("Origin"))
+// WithCORSConfig returns a CORS middleware for cfg, which should pass
+// Validate. Preflights from origins, methods or headers the policy does not
+// allow are answered with 403. Other requests from disallowed origins reach
+// the handler without CORS headers, so the browser withholds the response. A
+// "*" origin in a policy with credentials matches nothing, and routes without
+// a path are ignored.
+func WithCORSConfig(cfg CORSConfig) func(http.Handler) http.Handler {
+	routes := append([]CORSRoute(nil), cfg.Routes...)
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].PathPrefix) > len(routes[j].PathPrefix)
+	})
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			policy := cfg.Default
+			for _, route := range routes {
+				if route.PathPrefix != "" && strings.HasPrefix(r.URL.Path, route.PathPrefix) {
+					policy = route.Policy
+					break
+				}
+			}
+
+			origin := r.Header.Get("Origin")
+			w.Header().Add("Vary", "Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			requestedMethod := r.Header.Get("Access-Control-Request-Method")
+			if r.Method == http.MethodOptions && requestedMethod != "" {
+				policy.preflight(w, r, origin, requestedMethod)
+				return
+			}
+
+			if policy.allowsOrigin(origin) {
+				policy.setOrigin(w, origin)
+				if len(policy.ExposedHeaders) > 0 {
+					w.Header().Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
 
-		// Handle preflight OPTIONS requests.
-		// Browsers send these to check permissions before making the actual request.
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusNoContent)
+// preflight answers an OPTIONS request that asks whether the actual request may be sent.
+func (p CORSPolicy) preflight(w http.ResponseWriter, r *http.Request, origin, method string) {
+	w.Header().Add("Vary", "Access-Control-Request-Method")
+	w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+	requestedHeaders := splitHeaderList(r.Header.Get("Access-Control-Request-Headers"))
+	switch {
+	case !p.allowsOrigin(origin):
+		log.Printf("CORS: rejected preflight from origin %s for %s", origin, r.URL.Path)
+		http.Error(w, "CORS: origin not allowed", http.StatusForbidden)
+		return
+	case !containsFold(p.AllowedMethods, method):
+		log.Printf("CORS: rejected preflight from origin %s for method %s on %s", origin, method, r.URL.Path)
+		http.Error(w, "CORS: method not allowed", http.StatusForbidden)
+		return
+	}
+	for _, header := range requestedHeaders {
+		if !p.allowsHeader(header) {
+			log.Printf("CORS: rejected preflight from origin %s for header %s on %s", origin, header, r.URL.Path)
+			http.Error(w, "CORS: header "+header+" not allowed", http.StatusForbidden)
 			return
 		}
+	}
 
-		// Call the next handler in the chain.
-		next.ServeHTTP(w, r)
-	})
+	p.setOrigin(w, origin)
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(p.AllowedMethods, ", "))
+	if len(requestedHeaders) > 0 {
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(requestedHeaders, ", "))
+	}
+	if p.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setOrigin sets Access-Control-Allow-Origin for an allowed origin.
+func (p CORSPolicy) setOrigin(w http.ResponseWriter, origin string) {
+	if p.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		return
+	}
+	if containsFold(p.AllowedOrigins, "*") {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+}
+
+func (p CORSPolicy) allowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range p.AllowedOrigins {
+		allowed = strings.ToLower(allowed)
+		if allowed == "*" {
+			// Never echo an arbitrary origin together with credentials.
+			if !p.AllowCredentials {
+				return true
+			}
+			continue
+		}
+		if allowed == origin {
+			return true
+		}
+		// "https://*.example.com" matches any subdomain, but not example.com itself.
+		if prefix, suffix, ok := strings.Cut(allowed, "*"); ok {
+			if len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) &&
+				!strings.ContainsAny(origin[len(prefix):len(origin)-len(suffix)], "/:") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p CORSPolicy) allowsHeader(header string) bool {
+	return containsFold(p.AllowedHeaders, "*") || containsFold(p.AllowedHeaders, header)
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitHeaderList(list string) []string {
+	var headers []string
+	for _, header := range strings.Split(list, ",") {
+		if header = strings.TrimSpace(header); header != "" {
+			headers = append(headers, header)
+		}
+	}
+	return headers
+}
+
+// CORSConfigFromApp reads the cors section of the configuration. Routes under
+// cors.routes.<name> override the keys they set for the paths under their path.
+// The result is checked with Validate.
+func CORSConfigFromApp(appConfig *config.AppConfig) (CORSConfig, error) {
+	cfg := CORSConfig{Default: corsPolicyFromApp(appConfig, "cors.", DefaultCORSPolicy())}
+	for name := range appConfig.GetStringMap("cors.routes") {
+		prefix := "cors.routes." + name + "."
+		cfg.Routes = append(cfg.Routes, CORSRoute{
+			PathPrefix: appConfig.GetConfig(prefix + "path"),
+			Policy:     corsPolicyFromApp(appConfig, prefix, cfg.Default),
+		})
+	}
+	return cfg, cfg.Validate()
+}
+
+func corsPolicyFromApp(appConfig *config.AppConfig, prefix string, policy CORSPolicy) CORSPolicy {
+	if appConfig.IsSet(prefix + "allowed_origins") {
+		policy.AllowedOrigins = appConfig.GetStringSlice(prefix + "allowed_origins")
+	}
+	if appConfig.IsSet(prefix + "allowed_methods") {
+		policy.AllowedMethods = appConfig.GetStringSlice(prefix + "allowed_methods")
+	}
+	if appConfig.IsSet(prefix + "allowed_headers") {
+		policy.AllowedHeaders = appConfig.GetStringSlice(prefix + "allowed_headers")
+	}
+	if appConfig.IsSet(prefix + "exposed_headers") {
+		policy.ExposedHeaders = appConfig.GetStringSlice(prefix + "exposed_headers")
+	}
+	if appConfig.IsSet(prefix + "allow_credentials") {
+		policy.AllowCredentials = appConfig.GetBool(prefix + "allow_credentials")
+	}
+	if appConfig.IsSet(prefix + "max_age") {
+		policy.MaxAge = appConfig.GetDuration(prefix + "max_age")
+	}
+	return policy
 }
@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSAllowsOrigin(t *testing.T) {
+	tests := []struct {
+		name        string
+		allowed     []string
+		credentials bool
+		origin      string
+		want        bool
+	}{
+		{name: "any origin", allowed: []string{"*"}, origin: "https://evil.example", want: true},
+		{name: "exact origin", allowed: []string{"https://app.example.com"}, origin: "https://app.example.com", want: true},
+		{name: "case-insensitive", allowed: []string{"https://App.Example.com"}, origin: "https://app.example.COM", want: true},
+		{name: "other origin", allowed: []string{"https://app.example.com"}, origin: "https://app.example.org", want: false},
+		{name: "other scheme", allowed: []string{"https://app.example.com"}, origin: "http://app.example.com", want: false},
+		{name: "wildcard subdomain", allowed: []string{"https://*.example.com"}, origin: "https://app.example.com", want: true},
+		{name: "wildcard nested subdomain", allowed: []string{"https://*.example.com"}, origin: "https://a.b.example.com", want: true},
+		{name: "wildcard excludes the apex", allowed: []string{"https://*.example.com"}, origin: "https://example.com", want: false},
+		{name: "wildcard excludes look-alikes", allowed: []string{"https://*.example.com"}, origin: "https://evil-example.com", want: false},
+		{name: "wildcard excludes ports", allowed: []string{"https://*.example.com"}, origin: "https://evil.com:1.example.com", want: false},
+		{name: "wildcard excludes paths", allowed: []string{"https://*.example.com"}, origin: "https://evil.com/.example.com", want: false},
+		// The regression: "*" with credentials must never echo an arbitrary origin.
+		{name: "any origin with credentials", allowed: []string{"*"}, credentials: true, origin: "https://evil.example", want: false},
+		{name: "listed origin with credentials", allowed: []string{"*", "https://app.example.com"}, credentials: true, origin: "https://app.example.com", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := CORSPolicy{AllowedOrigins: tt.allowed, AllowCredentials: tt.credentials}
+			if got := policy.allowsOrigin(tt.origin); got != tt.want {
+				t.Errorf("allowsOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCORSConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     CORSConfig
+		wantErr bool
+	}{
+		{name: "default", cfg: CORSConfig{Default: DefaultCORSPolicy()}},
+		{name: "credentials with listed origins", cfg: CORSConfig{Default: CORSPolicy{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true}}},
+		{name: "any origin with credentials", cfg: CORSConfig{Default: CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}}, wantErr: true},
+		{name: "route with any origin and credentials", cfg: CORSConfig{Routes: []CORSRoute{
+			{PathPrefix: "/api", Policy: CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}},
+		}}, wantErr: true},
+		{name: "route without a path", cfg: CORSConfig{Routes: []CORSRoute{{Policy: DefaultCORSPolicy()}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithCORSConfig(t *testing.T) {
+	cfg := CORSConfig{
+		Default: DefaultCORSPolicy(),
+		Routes: []CORSRoute{
+			{PathPrefix: "/account", Policy: CORSPolicy{
+				AllowedOrigins:   []string{"https://app.example.com"},
+				AllowedMethods:   []string{http.MethodGet, http.MethodPost},
+				AllowedHeaders:   []string{"Content-Type"},
+				AllowCredentials: true,
+			}},
+			{PathPrefix: "/account/public", Policy: DefaultCORSPolicy()},
+			// Ignored: an empty prefix would otherwise match every path.
+			{Policy: CORSPolicy{AllowedOrigins: []string{"https://other.example.com"}}},
+		},
+	}
+
+	tests := []struct {
+		name            string
+		method          string
+		path            string
+		origin          string
+		requestMethod   string
+		requestHeaders  string
+		wantStatus      int
+		wantOrigin      string
+		wantCredentials string
+		wantHandler     bool
+	}{
+		{name: "no origin", method: http.MethodGet, path: "/items", wantStatus: http.StatusOK, wantHandler: true},
+		{name: "default policy", method: http.MethodGet, path: "/items", origin: "https://a.example", wantStatus: http.StatusOK, wantOrigin: "*", wantHandler: true},
+		{name: "route echoes origin with credentials", method: http.MethodGet, path: "/account/me", origin: "https://app.example.com",
+			wantStatus: http.StatusOK, wantOrigin: "https://app.example.com", wantCredentials: "true", wantHandler: true},
+		{name: "route rejects other origins", method: http.MethodGet, path: "/account/me", origin: "https://a.example", wantStatus: http.StatusOK, wantHandler: true},
+		{name: "longest prefix wins", method: http.MethodGet, path: "/account/public/x", origin: "https://a.example", wantStatus: http.StatusOK, wantOrigin: "*", wantHandler: true},
+		{name: "route without a path is ignored", method: http.MethodGet, path: "/items", origin: "https://other.example.com", wantStatus: http.StatusOK, wantOrigin: "*", wantHandler: true},
+		{name: "preflight", method: http.MethodOptions, path: "/account/me", origin: "https://app.example.com", requestMethod: http.MethodPost, requestHeaders: "content-type",
+			wantStatus: http.StatusNoContent, wantOrigin: "https://app.example.com", wantCredentials: "true"},
+		{name: "preflight from other origin", method: http.MethodOptions, path: "/account/me", origin: "https://a.example", requestMethod: http.MethodPost, wantStatus: http.StatusForbidden},
+		{name: "preflight for other method", method: http.MethodOptions, path: "/account/me", origin: "https://app.example.com", requestMethod: http.MethodDelete, wantStatus: http.StatusForbidden},
+		{name: "preflight for other header", method: http.MethodOptions, path: "/account/me", origin: "https://app.example.com", requestMethod: http.MethodPost, requestHeaders: "X-API-Key", wantStatus: http.StatusForbidden},
+		{name: "plain OPTIONS reaches the handler", method: http.MethodOptions, path: "/items", origin: "https://a.example", wantStatus: http.StatusOK, wantOrigin: "*", wantHandler: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handlerCalled := false
+			handler := WithCORSConfig(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handlerCalled = true
+			}))
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.requestMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+			}
+			if tt.requestHeaders != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.requestHeaders)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != tt.wantCredentials {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, tt.wantCredentials)
+			}
+			if handlerCalled != tt.wantHandler {
+				t.Errorf("handler called = %v, want %v", handlerCalled, tt.wantHandler)
+			}
+		})
+	}
+}
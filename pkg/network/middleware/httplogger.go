@@ -56,7 +56,8 @@ func getOtelTraceID(ctx context.Context) string {
 }
 
 // WithLogging is the middleware function. It wraps an http.Handler and
-// logs detailed request and response information.
+// logs detailed request and response information. Credentials in the query
+// and in form and JSON bodies are redacted.
 func WithLogging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -82,10 +83,10 @@ func WithLogging(next http.Handler) http.Handler {
 			"traceID":       traceID,
 			"method":        r.Method,
 			"path":          r.URL.Path,
-			"query":         r.URL.RawQuery,
-			"request_body":  string(reqBody),
+			"query":         logger.RedactQuery(r.URL.RawQuery),
+			"request_body":  logger.RedactBody(reqBody, r.Header.Get("Content-Type")),
 			"status_code":   lrw.statusCode,
-			"response_body": lrw.body.String(),
+			"response_body": logger.RedactBody(lrw.body.Bytes(), lrw.Header().Get("Content-Type")),
 			"duration_ms":   duration.Milliseconds(),
 		}).Info("HTTP request processed.")
 	})
@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	apperrors "chaits.org/go-microservices-repo/pkg/errors"
+	"chaits.org/go-microservices-repo/pkg/general/config"
+	jwtutil "chaits.org/go-microservices-repo/pkg/security/jwt"
+)
+
+type claimsKey struct{}
+
+// ClaimsFromContext returns the claims of the bearer token accepted by WithJWTAuth.
+func ClaimsFromContext(ctx context.Context) (*jwtutil.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*jwtutil.Claims)
+	return claims, ok
+}
+
+// WithJWTAuth is a middleware that validates an Authorization: Bearer token
+// issued for audience. The claims of the token are available to later handlers
+// through ClaimsFromContext.
+func WithJWTAuth(audience string) func(http.Handler) http.Handler {
+	return WithAnyAuth(JWTAuthenticator(audience))
+}
+
+// JWTAuthenticator checks the bearer token of a request, see WithJWTAuth.
+// Other Authorization schemes count as no credentials.
+func JWTAuthenticator(audience string) Authenticator {
+	return func(r *http.Request) (*http.Request, error) {
+		scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return nil, ErrNoCredentials
+		}
+
+		claims, err := jwtutil.ValidateToken(strings.TrimSpace(token), audience)
+		if err != nil {
+			log.Printf("Unauthorized: Invalid bearer token for audience '%s': %v", audience, err)
+			return nil, &AuthError{
+				Status:    http.StatusUnauthorized,
+				Code:      apperrors.INVALID_CREDENTIALS_ERROR,
+				Detail:    "Unauthorized: Invalid Bearer Token",
+				challenge: `Bearer error="invalid_token"`,
+			}
+		}
+
+		log.Printf("Authenticated: Request with valid bearer token for subject '%s'", claims.Subject)
+		return r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)), nil
+	}
+}
+
+// RoleRule lists the roles the bearer token of a request must carry.
+type RoleRule struct {
+	// AllOf are roles that are all required.
+	AllOf []string
+	// AnyOf are roles of which at least one is required.
+	AnyOf []string
+	// AllowAPIKeys lets requests authenticated by API key through. Apps carry no
+	// roles, so they are rejected otherwise.
+	AllowAPIKeys bool
+}
+
+func (rule RoleRule) empty() bool {
+	return len(rule.AllOf) == 0 && len(rule.AnyOf) == 0
+}
+
+// check returns nil if the request satisfies the rule, or the error to answer with.
+func (rule RoleRule) check(r *http.Request) *AuthError {
+	if rule.empty() {
+		return nil
+	}
+	claims, ok := ClaimsFromContext(r.Context())
+	if !ok {
+		if _, isApp := AppNameFromContext(r.Context()); isApp {
+			if rule.AllowAPIKeys {
+				return nil
+			}
+			return &AuthError{Status: http.StatusForbidden, Code: apperrors.FORBIDDEN_ERROR, Detail: "Forbidden: Bearer Token With Roles Required"}
+		}
+		return &AuthError{Status: http.StatusUnauthorized, Code: apperrors.MISSING_CREDENTIALS_ERROR, Detail: "Unauthorized: Credentials Missing"}
+	}
+
+	for _, role := range rule.AllOf {
+		if !slices.Contains(claims.Roles, role) {
+			return &AuthError{Status: http.StatusForbidden, Code: apperrors.FORBIDDEN_ERROR, Detail: "Forbidden: Missing Role " + role}
+		}
+	}
+	if len(rule.AnyOf) > 0 && !slices.ContainsFunc(rule.AnyOf, func(role string) bool { return slices.Contains(claims.Roles, role) }) {
+		return &AuthError{Status: http.StatusForbidden, Code: apperrors.FORBIDDEN_ERROR, Detail: "Forbidden: Requires One Of Roles " + strings.Join(rule.AnyOf, ", ")}
+	}
+	return nil
+}
+
+// RequireRoles rejects requests that do not satisfy rule with 401 or 403. It
+// belongs after the authentication middleware.
+func RequireRoles(rule RoleRule) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if authErr := rule.check(r); authErr != nil {
+				log.Printf("%s: %s %s", authErr.Detail, r.Method, r.URL.Path)
+				writeAuthError(w, authErr)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AuthorizationRule applies a role rule to the paths under PathPrefix.
+type AuthorizationRule struct {
+	PathPrefix string
+	Roles      RoleRule
+}
+
+// WithAuthorization applies the rule with the longest matching prefix to each
+// request, like RequireRoles. Paths without a rule are let through.
+func WithAuthorization(rules []AuthorizationRule) func(http.Handler) http.Handler {
+	rules = append([]AuthorizationRule(nil), rules...)
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(rules[i].PathPrefix) > len(rules[j].PathPrefix)
+	})
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, rule := range rules {
+				if strings.HasPrefix(r.URL.Path, rule.PathPrefix) {
+					RequireRoles(rule.Roles)(next).ServeHTTP(w, r)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AuthorizationRulesFromApp reads the rules under auth.routes.<name>: path,
+// all_of, any_of and allow_api_keys.
+func AuthorizationRulesFromApp(appConfig *config.AppConfig) []AuthorizationRule {
+	var rules []AuthorizationRule
+	for name := range appConfig.GetStringMap("auth.routes") {
+		prefix := "auth.routes." + name + "."
+		rules = append(rules, AuthorizationRule{
+			PathPrefix: appConfig.GetConfig(prefix + "path"),
+			Roles: RoleRule{
+				AllOf:        appConfig.GetStringSlice(prefix + "all_of"),
+				AnyOf:        appConfig.GetStringSlice(prefix + "any_of"),
+				AllowAPIKeys: appConfig.GetBool(prefix + "allow_api_keys"),
+			},
+		})
+	}
+	return rules
+}
@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	apperrors "chaits.org/go-microservices-repo/pkg/errors"
+	jwtutil "chaits.org/go-microservices-repo/pkg/security/jwt"
+)
+
+const testAudience = "test-service"
+
+func setTestSigningKey(t *testing.T) {
+	t.Helper()
+	if err := jwtutil.SetSigningKey([]byte("0123456789abcdef0123456789abcdef")); err != nil {
+		t.Fatalf("SetSigningKey() error = %v", err)
+	}
+}
+
+func bearerToken(t *testing.T, roles []string, audience string, ttl time.Duration) string {
+	t.Helper()
+	token, _, err := jwtutil.GenerateTokenWithTTL("billing", roles, audience, ttl)
+	if err != nil {
+		t.Fatalf("GenerateTokenWithTTL() error = %v", err)
+	}
+	return "Bearer " + token
+}
+
+func TestRoleRuleCheck(t *testing.T) {
+	withRoles := func(roles ...string) context.Context {
+		return context.WithValue(context.Background(), claimsKey{}, &jwtutil.Claims{Roles: roles})
+	}
+	withApp := context.WithValue(context.Background(), appNameKey{}, "billing")
+
+	tests := []struct {
+		name       string
+		rule       RoleRule
+		ctx        context.Context
+		wantStatus int
+	}{
+		{name: "empty rule", rule: RoleRule{}, ctx: context.Background()},
+		{name: "all of", rule: RoleRule{AllOf: []string{"admin", "ops"}}, ctx: withRoles("ops", "admin")},
+		{name: "all of missing one", rule: RoleRule{AllOf: []string{"admin", "ops"}}, ctx: withRoles("admin"), wantStatus: http.StatusForbidden},
+		{name: "any of", rule: RoleRule{AnyOf: []string{"admin", "ops"}}, ctx: withRoles("ops")},
+		{name: "any of missing all", rule: RoleRule{AnyOf: []string{"admin", "ops"}}, ctx: withRoles("service"), wantStatus: http.StatusForbidden},
+		{name: "all of and any of", rule: RoleRule{AllOf: []string{"service"}, AnyOf: []string{"read", "write"}}, ctx: withRoles("service", "write")},
+		{name: "all of met, any of not", rule: RoleRule{AllOf: []string{"service"}, AnyOf: []string{"read", "write"}}, ctx: withRoles("service"), wantStatus: http.StatusForbidden},
+		{name: "token without roles", rule: RoleRule{AllOf: []string{"admin"}}, ctx: withRoles(), wantStatus: http.StatusForbidden},
+		{name: "API key rejected", rule: RoleRule{AllOf: []string{"admin"}}, ctx: withApp, wantStatus: http.StatusForbidden},
+		{name: "API key allowed", rule: RoleRule{AllOf: []string{"admin"}, AllowAPIKeys: true}, ctx: withApp},
+		{name: "not authenticated", rule: RoleRule{AllOf: []string{"admin"}, AllowAPIKeys: true}, ctx: context.Background(), wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(tt.ctx)
+			authErr := tt.rule.check(r)
+			status := 0
+			if authErr != nil {
+				status = authErr.Status
+			}
+			if status != tt.wantStatus {
+				t.Errorf("check() = %v, want status %d", authErr, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestJWTAuthWithRoles(t *testing.T) {
+	setTestSigningKey(t)
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		wantCode      string
+		wantChallenge bool
+	}{
+		{name: "admin token", authorization: bearerToken(t, []string{"admin"}, testAudience, time.Hour), wantStatus: http.StatusOK},
+		{name: "lowercase scheme", authorization: "bearer " + bearerToken(t, []string{"admin"}, testAudience, time.Hour)[len("Bearer "):], wantStatus: http.StatusOK},
+		{name: "missing role", authorization: bearerToken(t, []string{"service"}, testAudience, time.Hour),
+			wantStatus: http.StatusForbidden, wantCode: apperrors.FORBIDDEN_ERROR},
+		{name: "other audience", authorization: bearerToken(t, []string{"admin"}, "other-service", time.Hour),
+			wantStatus: http.StatusUnauthorized, wantCode: apperrors.INVALID_CREDENTIALS_ERROR, wantChallenge: true},
+		{name: "expired", authorization: bearerToken(t, []string{"admin"}, testAudience, -time.Minute),
+			wantStatus: http.StatusUnauthorized, wantCode: apperrors.INVALID_CREDENTIALS_ERROR, wantChallenge: true},
+		{name: "malformed", authorization: "Bearer not-a-token",
+			wantStatus: http.StatusUnauthorized, wantCode: apperrors.INVALID_CREDENTIALS_ERROR, wantChallenge: true},
+		{name: "other scheme", authorization: "Basic YWRtaW46YWRtaW4=",
+			wantStatus: http.StatusUnauthorized, wantCode: apperrors.MISSING_CREDENTIALS_ERROR},
+		{name: "no credentials", wantStatus: http.StatusUnauthorized, wantCode: apperrors.MISSING_CREDENTIALS_ERROR},
+	}
+
+	handler := WithJWTAuth(testAudience)(RequireRoles(RoleRule{AllOf: []string{"admin"}})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if claims, ok := ClaimsFromContext(r.Context()); !ok || claims.Subject != "billing" {
+				t.Errorf("ClaimsFromContext() = %v, %v, want the token's claims", claims, ok)
+			}
+		})))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/apps/plan", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantCode == "" {
+				return
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("Content-Type = %q, want application/problem+json", ct)
+			}
+			var problem AuthError
+			if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+				t.Fatalf("decoding the error body: %v", err)
+			}
+			if problem.Status != tt.wantStatus || problem.Code != tt.wantCode || problem.Title == "" || problem.Detail == "" {
+				t.Errorf("body = %+v, want status %d and code %s", problem, tt.wantStatus, tt.wantCode)
+			}
+			if challenge := rec.Header().Get("WWW-Authenticate"); (challenge != "") != tt.wantChallenge {
+				t.Errorf("WWW-Authenticate = %q, want one: %v", challenge, tt.wantChallenge)
+			}
+		})
+	}
+}
+
+func TestWithAuthorization(t *testing.T) {
+	setTestSigningKey(t)
+	rules := []AuthorizationRule{
+		{PathPrefix: "/apps", Roles: RoleRule{AnyOf: []string{"service", "admin"}}},
+		{PathPrefix: "/apps/plan", Roles: RoleRule{AllOf: []string{"admin"}}},
+	}
+	handler := WithJWTAuth(testAudience)(WithAuthorization(rules)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	tests := []struct {
+		name       string
+		path       string
+		roles      []string
+		wantStatus int
+	}{
+		{name: "shorter prefix", path: "/apps/billing", roles: []string{"service"}, wantStatus: http.StatusOK},
+		{name: "longest prefix wins", path: "/apps/plan", roles: []string{"service"}, wantStatus: http.StatusForbidden},
+		{name: "longest prefix satisfied", path: "/apps/plan", roles: []string{"admin"}, wantStatus: http.StatusOK},
+		{name: "path without a rule", path: "/health", roles: nil, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", bearerToken(t, tt.roles, testAudience, time.Hour))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -1,12 +1,28 @@
 package middleware
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"chaits.org/go-microservices-repo/internal/models"
+	"chaits.org/go-microservices-repo/internal/repositories"
+	"chaits.org/go-microservices-repo/pkg/general/config"
+	"chaits.org/go-microservices-repo/pkg/general/metrics"
+	"chaits.org/go-microservices-repo/pkg/general/ratelimit"
 	"github.com/go-chi/httprate"
 )
 
+// WithRateLimiter limits requests per client IP, counted in the memory of this
+// instance. In front of the authentication middleware it bounds how fast
+// credentials can be guessed; WithAppRateLimiter then limits per app.
 func WithRateLimiter(requests int, duration time.Duration) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		if requests == 0 {
@@ -18,3 +34,253 @@ func WithRateLimiter(requests int, duration time.Duration) func(next http.Handle
 		return httprate.LimitByIP(requests, duration)(next)
 	}
 }
+
+// Rejection reasons reported in rate_limit_rejections_total.
+const (
+	RATE_LIMIT_REASON_RATE  = "rate"
+	RATE_LIMIT_REASON_QUOTA = "quota"
+)
+
+// ANONYMOUS_APP is the app label of requests that reached WithAppRateLimiter
+// without an authenticated app. They are limited per client IP.
+const ANONYMOUS_APP = "anonymous"
+
+// AppRateLimitConfig configures WithAppRateLimiter.
+type AppRateLimitConfig struct {
+	// DefaultPlan applies to apps without a row in app_plans and to anonymous clients.
+	DefaultPlan models.AppPlan
+	// PlanTTL is how long a plan read from the database is used before it is
+	// read again, so plan changes take effect without a restart.
+	PlanTTL time.Duration
+	// Store keeps the state of the limits. Replicas that share a store share
+	// their limits. Defaults to a ratelimit.MemoryStore.
+	Store ratelimit.Store
+	// FailMode decides whether requests pass unlimited or are rejected with
+	// 503 while the store fails. Defaults to ratelimit.FAIL_OPEN.
+	FailMode ratelimit.FailMode
+	// IPRequestsPerMinute limits each client IP with WithRateLimiter before
+	// authentication. It must allow the plans of apps that share an IP.
+	IPRequestsPerMinute int
+}
+
+// DefaultAppRateLimitConfig allows bursts of 20 requests, 100 requests per
+// minute sustained and no daily quota, and re-reads plans every 30 seconds.
+// Each client IP may send 1000 requests per minute.
+func DefaultAppRateLimitConfig() AppRateLimitConfig {
+	return AppRateLimitConfig{
+		DefaultPlan:         models.AppPlan{Burst: 20, RatePerMinute: 100},
+		PlanTTL:             30 * time.Second,
+		IPRequestsPerMinute: 1000,
+	}
+}
+
+// AppRateLimitConfigFromApp reads the ratelimit section of the configuration.
+// The store is left to the caller, see ratelimit.StoreFromApp.
+func AppRateLimitConfigFromApp(appConfig *config.AppConfig) (AppRateLimitConfig, error) {
+	cfg := DefaultAppRateLimitConfig()
+	if appConfig.IsSet("ratelimit.default_burst") {
+		cfg.DefaultPlan.Burst = appConfig.GetInt("ratelimit.default_burst")
+	}
+	if appConfig.IsSet("ratelimit.default_rate_per_minute") {
+		cfg.DefaultPlan.RatePerMinute = appConfig.GetInt("ratelimit.default_rate_per_minute")
+	}
+	if appConfig.IsSet("ratelimit.default_daily_quota") {
+		cfg.DefaultPlan.DailyQuota = appConfig.GetInt("ratelimit.default_daily_quota")
+	}
+	if appConfig.IsSet("ratelimit.plan_ttl") {
+		cfg.PlanTTL = appConfig.GetDuration("ratelimit.plan_ttl")
+	}
+	if appConfig.IsSet("ratelimit.ip_requests_per_minute") {
+		cfg.IPRequestsPerMinute = appConfig.GetInt("ratelimit.ip_requests_per_minute")
+	}
+	failMode, err := ratelimit.FailModeFromApp(appConfig)
+	if err != nil {
+		return AppRateLimitConfig{}, err
+	}
+	cfg.FailMode = failMode
+	return cfg, nil
+}
+
+// WithAppRateLimiter limits requests per app, with the plan of the app read
+// from app_plans. Each app has a token bucket of Burst requests refilled at
+// RatePerMinute, and a DailyQuota that resets at midnight UTC. It belongs after
+// the authentication middleware, and limits bearer tokens by their subject.
+// Requests without an authenticated app are limited per client IP with the
+// default plan. The state of the limits lives in cfg.Store.
+//
+// Responses carry RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset for
+// whichever limit is closer to running out, and RateLimit-Policy listing both.
+// Rejected requests get 429 with Retry-After.
+func WithAppRateLimiter(appRepo repositories.AppRepository, cfg AppRateLimitConfig) func(http.Handler) http.Handler {
+	if cfg.Store == nil {
+		cfg.Store = ratelimit.NewMemoryStore()
+	}
+	limiter := &appRateLimiter{repo: appRepo, cfg: cfg, plans: make(map[string]cachedPlan)}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			app, key := ANONYMOUS_APP, "ip:"+clientIP(r)
+			plan := cfg.DefaultPlan
+			if appName, ok := authenticatedApp(r.Context()); ok {
+				app, key = appName, "app:"+appName
+				plan = limiter.plan(r.Context(), appName)
+			}
+
+			decision, err := limiter.take(r.Context(), key, plan, time.Now())
+			if err != nil {
+				metrics.IncrementRateLimitStoreErrors(cfg.Store.Name())
+				if cfg.FailMode == ratelimit.FAIL_CLOSED {
+					log.Printf("Rate limit store %s failed, rejecting request of app '%s': %v", cfg.Store.Name(), app, err)
+					w.Header().Set("Retry-After", "1")
+					http.Error(w, "Service Unavailable: rate limiter unavailable", http.StatusServiceUnavailable)
+					return
+				}
+				log.Printf("Rate limit store %s failed, letting request of app '%s' through: %v", cfg.Store.Name(), app, err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			decision.setHeaders(w, plan)
+			if decision.reason != "" {
+				metrics.IncrementRateLimitRejections(app, decision.reason)
+				log.Printf("Rate limited: app '%s' exceeded its %s limit, retry after %v", app, decision.reason, decision.retryAfter)
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(decision.retryAfter)))
+				if decision.reason == RATE_LIMIT_REASON_QUOTA {
+					http.Error(w, "Too Many Requests: daily quota exceeded", http.StatusTooManyRequests)
+				} else {
+					http.Error(w, "Too Many Requests: rate limit exceeded", http.StatusTooManyRequests)
+				}
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type appRateLimiter struct {
+	repo repositories.AppRepository
+	cfg  AppRateLimitConfig
+
+	mu    sync.Mutex
+	plans map[string]cachedPlan
+}
+
+type cachedPlan struct {
+	plan    models.AppPlan
+	expires time.Time
+}
+
+// plan returns the cached plan of app, reading it again once PlanTTL passed.
+// If the database cannot be read, the last known plan or the default is used.
+func (l *appRateLimiter) plan(ctx context.Context, app string) models.AppPlan {
+	now := time.Now()
+	l.mu.Lock()
+	cached, ok := l.plans[app]
+	l.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.plan
+	}
+
+	plan, found, err := l.repo.GetAppPlan(ctx, app)
+	switch {
+	case err != nil:
+		log.Printf("Error reading rate limit plan of app '%s': %v", app, err)
+		if !ok {
+			cached.plan = l.cfg.DefaultPlan
+		}
+		plan = cached.plan
+	case !found:
+		plan = l.cfg.DefaultPlan
+	}
+	plan.AppName = app
+
+	l.mu.Lock()
+	l.plans[app] = cachedPlan{plan: plan, expires: now.Add(l.cfg.PlanTTL)}
+	l.mu.Unlock()
+	return plan
+}
+
+// rateLimitDecision is the outcome of take. reason is empty when the request is allowed.
+type rateLimitDecision struct {
+	reason     string
+	limit      int
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+// take spends one request of the rate limit of key and, if that is allowed,
+// one request of its daily quota. A request rejected for its quota has still
+// spent its token.
+func (l *appRateLimiter) take(ctx context.Context, key string, plan models.AppPlan, now time.Time) (rateLimitDecision, error) {
+	decision := rateLimitDecision{limit: -1}
+	if plan.RatePerMinute > 0 {
+		limit := ratelimit.Limit{Rate: plan.RatePerMinute, Period: time.Minute, Burst: plan.Burst}
+		res, err := l.cfg.Store.Allow(ctx, key+":rate", limit)
+		if err != nil {
+			return decision, err
+		}
+		decision.limit, decision.remaining, decision.reset = res.Limit, res.Remaining, res.ResetAfter
+		if !res.Allowed {
+			decision.reason, decision.retryAfter = RATE_LIMIT_REASON_RATE, res.RetryAfter
+			return decision, nil
+		}
+	}
+
+	if plan.DailyQuota > 0 {
+		day := now.UTC().Truncate(24 * time.Hour)
+		midnight := day.Add(24 * time.Hour)
+		used, err := l.cfg.Store.Increment(ctx, key+":quota:"+day.Format(time.DateOnly), midnight)
+		if err != nil {
+			return decision, err
+		}
+		remaining := plan.DailyQuota - int(used)
+		if remaining < 0 {
+			decision.reason, decision.retryAfter = RATE_LIMIT_REASON_QUOTA, midnight.Sub(now)
+		}
+		if decision.limit < 0 || remaining < decision.remaining || decision.reason == RATE_LIMIT_REASON_QUOTA {
+			decision.limit, decision.remaining, decision.reset = plan.DailyQuota, max(remaining, 0), midnight.Sub(now)
+		}
+	}
+	return decision, nil
+}
+
+// setHeaders writes the RateLimit-* headers. Nothing is written when the plan has no limits.
+func (d rateLimitDecision) setHeaders(w http.ResponseWriter, plan models.AppPlan) {
+	if d.limit < 0 {
+		return
+	}
+	var policies []string
+	if plan.RatePerMinute > 0 {
+		policies = append(policies, fmt.Sprintf("%d;w=60;burst=%d", plan.RatePerMinute, max(plan.Burst, 1)))
+	}
+	if plan.DailyQuota > 0 {
+		policies = append(policies, fmt.Sprintf("%d;w=86400", plan.DailyQuota))
+	}
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(d.limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(d.remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.reset)))
+	w.Header().Set("RateLimit-Policy", strings.Join(policies, ", "))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// authenticatedApp returns the app of an API key, or the subject of a bearer token.
+func authenticatedApp(ctx context.Context) (string, bool) {
+	if appName, ok := AppNameFromContext(ctx); ok {
+		return appName, true
+	}
+	if claims, ok := ClaimsFromContext(ctx); ok && claims.Subject != "" {
+		return claims.Subject, true
+	}
+	return "", false
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
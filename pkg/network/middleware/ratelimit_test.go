@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"chaits.org/go-microservices-repo/internal/models"
+	"chaits.org/go-microservices-repo/internal/repositories"
+	"chaits.org/go-microservices-repo/pkg/general/logger"
+	"chaits.org/go-microservices-repo/pkg/general/ratelimit"
+	"github.com/sirupsen/logrus"
+)
+
+// planRepository serves app plans from a map. The other methods are not used
+// by the rate limiter.
+type planRepository struct {
+	repositories.AppRepository
+	plans map[string]models.AppPlan
+}
+
+func (r planRepository) GetAppPlan(ctx context.Context, appName string) (models.AppPlan, bool, error) {
+	plan, ok := r.plans[appName]
+	return plan, ok, nil
+}
+
+// failingStore is a ratelimit.Store that cannot be reached.
+type failingStore struct{}
+
+func (failingStore) Name() string { return "failing" }
+func (failingStore) Allow(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+func (failingStore) Increment(ctx context.Context, key string, expiresAt time.Time) (int64, error) {
+	return 0, errors.New("connection refused")
+}
+
+func TestAppRateLimiterTake(t *testing.T) {
+	now := time.Now()
+	midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	tests := []struct {
+		name          string
+		plan          models.AppPlan
+		requests      int
+		wantReason    string
+		wantLimit     int
+		wantRemaining int
+	}{
+		{name: "within burst", plan: models.AppPlan{Burst: 3, RatePerMinute: 60}, requests: 2, wantLimit: 3, wantRemaining: 1},
+		{name: "burst exhausted", plan: models.AppPlan{Burst: 2, RatePerMinute: 60}, requests: 3, wantReason: RATE_LIMIT_REASON_RATE, wantLimit: 2},
+		{name: "within quota", plan: models.AppPlan{DailyQuota: 5}, requests: 2, wantLimit: 5, wantRemaining: 3},
+		{name: "quota exhausted", plan: models.AppPlan{DailyQuota: 2}, requests: 3, wantReason: RATE_LIMIT_REASON_QUOTA, wantLimit: 2},
+		{name: "quota closer to running out", plan: models.AppPlan{Burst: 10, RatePerMinute: 600, DailyQuota: 3}, requests: 2, wantLimit: 3, wantRemaining: 1},
+		{name: "no limits", plan: models.AppPlan{}, requests: 5, wantLimit: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := &appRateLimiter{cfg: AppRateLimitConfig{Store: ratelimit.NewMemoryStore()}}
+			var decision rateLimitDecision
+			for i := 0; i < tt.requests; i++ {
+				var err error
+				if decision, err = limiter.take(context.Background(), "app:billing", tt.plan, now); err != nil {
+					t.Fatalf("take() error = %v", err)
+				}
+			}
+			if decision.reason != tt.wantReason || decision.limit != tt.wantLimit || decision.remaining != tt.wantRemaining {
+				t.Errorf("take() = %+v, want reason %q, limit %d, remaining %d", decision, tt.wantReason, tt.wantLimit, tt.wantRemaining)
+			}
+			if tt.wantReason == RATE_LIMIT_REASON_QUOTA && decision.retryAfter != midnight.Sub(now) {
+				t.Errorf("retryAfter = %v, want the time until midnight UTC", decision.retryAfter)
+			}
+		})
+	}
+}
+
+func TestWithAppRateLimiter(t *testing.T) {
+	repo := planRepository{plans: map[string]models.AppPlan{"billing": {Burst: 1, RatePerMinute: 1}}}
+	withApp := func(app string) context.Context {
+		return context.WithValue(context.Background(), appNameKey{}, app)
+	}
+
+	tests := []struct {
+		name       string
+		store      ratelimit.Store
+		failMode   ratelimit.FailMode
+		ctx        context.Context
+		requests   int
+		wantStatus int
+	}{
+		{name: "app plan", ctx: withApp("billing"), requests: 2, wantStatus: http.StatusTooManyRequests},
+		{name: "default plan for apps without one", ctx: withApp("reports"), requests: 2, wantStatus: http.StatusOK},
+		{name: "anonymous clients get the default plan", ctx: context.Background(), requests: 3, wantStatus: http.StatusTooManyRequests},
+		{name: "store down, fail open", store: failingStore{}, failMode: ratelimit.FAIL_OPEN, ctx: withApp("billing"), requests: 2, wantStatus: http.StatusOK},
+		{name: "store down, fail closed", store: failingStore{}, failMode: ratelimit.FAIL_CLOSED, ctx: withApp("billing"), requests: 1, wantStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := AppRateLimitConfig{
+				DefaultPlan: models.AppPlan{Burst: 2, RatePerMinute: 1},
+				PlanTTL:     time.Minute,
+				Store:       tt.store,
+				FailMode:    tt.failMode,
+			}
+			handler := WithAppRateLimiter(repo, cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			var rec *httptest.ResponseRecorder
+			for i := 0; i < tt.requests; i++ {
+				rec = httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/apps", nil).WithContext(tt.ctx))
+			}
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status of request %d = %d, want %d", tt.requests, rec.Code, tt.wantStatus)
+			}
+			if rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+				t.Errorf("429 without Retry-After")
+			}
+		})
+	}
+}
+
+// keyRepository rejects every API key and counts the lookups.
+type keyRepository struct {
+	planRepository
+	lookups *int
+}
+
+func (r keyRepository) ValidateAPIKey(ctx context.Context, appName, apiKey string) (string, bool, error) {
+	*r.lookups++
+	return "", false, nil
+}
+
+func TestAllMiddlewareManagerLimitsIPsBeforeAuth(t *testing.T) {
+	if logger.Logger == nil {
+		logger.Logger = logrus.New()
+		logger.Logger.SetOutput(io.Discard)
+	}
+	lookups := 0
+	repo := keyRepository{lookups: &lookups}
+	cfg := DefaultAppRateLimitConfig()
+	cfg.IPRequestsPerMinute = 3
+	handler := AllMiddlewareManager("ratelimit-test", repo, cfg).Then(func(w http.ResponseWriter, r *http.Request) {}, "test")
+
+	var statuses []int
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/apps/list", nil)
+		req.Header.Set("X-App-Name", "billing")
+		req.Header.Set("X-API-Key", "guess")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		statuses = append(statuses, rec.Code)
+	}
+
+	if statuses[2] != http.StatusUnauthorized || statuses[4] != http.StatusTooManyRequests {
+		t.Errorf("statuses = %v, want 401 until the IP limit and 429 after it", statuses)
+	}
+	if lookups != 3 {
+		t.Errorf("%d API keys checked, want 3", lookups)
+	}
+}
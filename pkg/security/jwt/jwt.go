@@ -1,7 +1,9 @@
 package jwtutil
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -14,17 +16,54 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
+// MIN_SIGNING_KEY_BYTES is the shortest HS256 key SetSigningKey accepts.
+const MIN_SIGNING_KEY_BYTES = 32
+
+// ErrNoSigningKey is returned when tokens are generated or validated before SetSigningKey.
+var ErrNoSigningKey = errors.New("jwt signing key is not set")
+
 var (
-	// The secret key used for signing and validating the tokens.
-	secretKey = []byte("super-secret-key")
+	// The secret key used for signing and validating the tokens, set with SetSigningKey.
+	secretKey   []byte
+	secretKeyMu sync.RWMutex
 	// The service that issues the tokens.
 	issuer = "auth-service"
 )
 
-// GenerateToken creates a new JWT with the given user details and audience.
+// SetSigningKey sets the HS256 key used to sign and validate tokens. Services
+// load it from their secret store at startup; there is no default key.
+func SetSigningKey(key []byte) error {
+	if len(key) < MIN_SIGNING_KEY_BYTES {
+		return fmt.Errorf("jwt signing key must be at least %d bytes, got %d", MIN_SIGNING_KEY_BYTES, len(key))
+	}
+	secretKeyMu.Lock()
+	defer secretKeyMu.Unlock()
+	secretKey = append([]byte(nil), key...)
+	return nil
+}
+
+func signingKey() ([]byte, error) {
+	secretKeyMu.RLock()
+	defer secretKeyMu.RUnlock()
+	if secretKey == nil {
+		return nil, ErrNoSigningKey
+	}
+	return secretKey, nil
+}
+
+// GenerateToken creates a new JWT with the given user details and audience
+// that expires 24 hours from now.
 func GenerateToken(userID string, roles []string, audience string) (string, error) {
-	// Set the token's expiration time to 24 hours from now.
-	expirationTime := time.Now().Add(24 * time.Hour)
+	tokenString, _, err := GenerateTokenWithTTL(userID, roles, audience, 24*time.Hour)
+	return tokenString, err
+}
+
+// GenerateTokenWithTTL creates a new JWT that expires after ttl and returns
+// it with its expiration time, so callers can renew it in time.
+func GenerateTokenWithTTL(userID string, roles []string, audience string, ttl time.Duration) (string, time.Time, error) {
+	// Set the token's expiration time to ttl from now.
+	now := time.Now()
+	expirationTime := now.Add(ttl)
 
 	// Create a new claims object with our custom and standard claims.
 	claims := &Claims{
@@ -35,25 +74,35 @@ func GenerateToken(userID string, roles []string, audience string) (string, erro
 			Subject:   userID,
 			Audience:  jwt.ClaimStrings{audience},
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 		},
 	}
 
 	// Create a new token with the signing method and claims.
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
+	key, err := signingKey()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
 	// Sign the token with the secret key and return the signed string.
-	tokenString, err := token.SignedString(secretKey)
+	tokenString, err := token.SignedString(key)
 	if err != nil {
-		return "", fmt.Errorf("could not sign the token: %w", err)
+		return "", time.Time{}, fmt.Errorf("could not sign the token: %w", err)
 	}
 
-	return tokenString, nil
+	return tokenString, expirationTime, nil
 }
 
 // ValidateToken parses and validates a JWT string.
 func ValidateToken(tokenString, requiredAudience string) (*Claims, error) {
+	key, err := signingKey()
+	if err != nil {
+		return nil, err
+	}
+
 	// Define the claims and options for parsing.
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
@@ -62,7 +111,7 @@ func ValidateToken(tokenString, requiredAudience string) (*Claims, error) {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		// Return the secret key to validate the signature.
-		return secretKey, nil
+		return key, nil
 	}, jwt.WithAudience(requiredAudience)) // Validate the audience claim.
 
 	// Check for parsing or validation errors.
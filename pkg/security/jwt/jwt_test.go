@@ -0,0 +1,93 @@
+package jwtutil
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func withSigningKey(t *testing.T, key []byte) {
+	t.Helper()
+	secretKeyMu.Lock()
+	previous := secretKey
+	secretKey = key
+	secretKeyMu.Unlock()
+	t.Cleanup(func() {
+		secretKeyMu.Lock()
+		secretKey = previous
+		secretKeyMu.Unlock()
+	})
+}
+
+func TestSetSigningKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     []byte
+		wantErr bool
+	}{
+		{name: "long enough", key: testKey},
+		{name: "too short", key: []byte("secret"), wantErr: true},
+		{name: "empty", key: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withSigningKey(t, nil)
+			if err := SetSigningKey(tt.key); (err != nil) != tt.wantErr {
+				t.Errorf("SetSigningKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNoSigningKey(t *testing.T) {
+	withSigningKey(t, nil)
+	if _, err := GenerateToken("billing", nil, "svc"); !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("GenerateToken() error = %v, want ErrNoSigningKey", err)
+	}
+	if _, err := ValidateToken("a.b.c", "svc"); !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("ValidateToken() error = %v, want ErrNoSigningKey", err)
+	}
+}
+
+func TestValidateToken(t *testing.T) {
+	withSigningKey(t, testKey)
+	valid, expiresAt, err := GenerateTokenWithTTL("billing", []string{"admin"}, "svc", time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateTokenWithTTL() error = %v", err)
+	}
+	if d := time.Until(expiresAt); d <= 59*time.Minute || d > time.Hour {
+		t.Errorf("token expires in %v, want 1h", d)
+	}
+	expired, _, _ := GenerateTokenWithTTL("billing", nil, "svc", -time.Minute)
+
+	tests := []struct {
+		name     string
+		token    string
+		audience string
+		key      []byte
+		wantErr  bool
+	}{
+		{name: "valid", token: valid, audience: "svc", key: testKey},
+		{name: "other audience", token: valid, audience: "other", key: testKey, wantErr: true},
+		{name: "expired", token: expired, audience: "svc", key: testKey, wantErr: true},
+		{name: "other key", token: valid, audience: "svc", key: []byte("fedcba9876543210fedcba9876543210"), wantErr: true},
+		{name: "unsigned", token: "eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0.eyJzdWIiOiJiaWxsaW5nIiwiYXVkIjpbInN2YyJdfQ.", audience: "svc", key: testKey, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withSigningKey(t, tt.key)
+			claims, err := ValidateToken(tt.token, tt.audience)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (claims.Subject != "billing" || claims.UserID != "billing" || !slices.Equal(claims.Roles, []string{"admin"})) {
+				t.Errorf("ValidateToken() claims = %+v", claims)
+			}
+		})
+	}
+}
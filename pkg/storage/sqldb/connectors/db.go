@@ -0,0 +1,384 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"chaits.org/go-microservices-repo/pkg/general/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.20.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "db-tracer"
+
+const (
+	// Row counts are not part of semconv v1.20.0, so they use their own keys.
+	dbRowsAffectedKey = attribute.Key("db.rows_affected")
+	dbRowsReturnedKey = attribute.Key("db.rows_returned")
+)
+
+// DB wraps *sql.DB and records a client span and a dependency metric for every
+// query, exec, prepare and transaction. The plain *sql.DB methods (Ping, Close,
+// Stats, SetMaxOpenConns, ...) are still available through the embedded field.
+type DB struct {
+	*sql.DB
+	instrumentation *instrumentation
+}
+
+// instrumentation holds what is needed to describe a call against one database.
+type instrumentation struct {
+	tracer         trace.Tracer
+	dependencyName string
+	driver         string
+	attrs          []attribute.KeyValue
+}
+
+// NewDB instruments a database opened without a Connector, such as one opened
+// by another library or a mock in tests. Only cfg.DBDriver is required.
+func NewDB(db *sql.DB, cfg *DBConfig) *DB {
+	system := semconv.DBSystemKey.String(cfg.DBDriver)
+	if cfg.DBDriver == DB_POSTGRES {
+		system = semconv.DBSystemPostgreSQL
+	}
+
+	attrs := []attribute.KeyValue{
+		system,
+		semconv.DBName(cfg.DBName),
+		semconv.DBUser(cfg.DBUser),
+		semconv.NetPeerName(cfg.DBHost),
+	}
+	if port, err := strconv.Atoi(cfg.DBPort); err == nil {
+		attrs = append(attrs, semconv.NetPeerPort(port))
+	}
+
+	return &DB{
+		DB: db,
+		instrumentation: &instrumentation{
+			tracer:         otel.Tracer(tracerName),
+			dependencyName: fmt.Sprintf("%s/%s", cfg.DBDriver, cfg.DBName),
+			driver:         cfg.DBDriver,
+			attrs:          attrs,
+		},
+	}
+}
+
+// start opens a client span for a statement. query may be empty for
+// operations such as BEGIN or COMMIT that have no statement text.
+func (in *instrumentation) start(ctx context.Context, operation, query string) (context.Context, trace.Span) {
+	attrs := append([]attribute.KeyValue{semconv.DBOperation(operation)}, in.attrs...)
+	if query != "" {
+		attrs = append(attrs, semconv.DBStatement(SanitizeSQL(in.driver, query)))
+	}
+	return in.tracer.Start(ctx, fmt.Sprintf("%s %s", operation, in.dependencyName),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// finish ends the span and records the call duration. sql.ErrNoRows is a
+// normal outcome and is not reported as an error.
+func (in *instrumentation) finish(span trace.Span, start time.Time, err error) {
+	status := "success"
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		status = "error"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+	metrics.RecordDependencyRequest(in.dependencyName, status, time.Since(start))
+}
+
+// ExecContext executes a statement and records the number of affected rows.
+func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return execContext(ctx, db.instrumentation, db.DB.ExecContext, query, args...)
+}
+
+// Exec is ExecContext with a background context.
+func (db *DB) Exec(query string, args ...any) (sql.Result, error) {
+	return db.ExecContext(context.Background(), query, args...)
+}
+
+// QueryContext executes a query. The span stays open until the returned Rows
+// are read to the end or closed, so that it covers reading the result set.
+func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (*Rows, error) {
+	return queryContext(ctx, db.instrumentation, db.DB.QueryContext, query, args...)
+}
+
+// Query is QueryContext with a background context.
+func (db *DB) Query(query string, args ...any) (*Rows, error) {
+	return db.QueryContext(context.Background(), query, args...)
+}
+
+// QueryRowContext executes a query that returns at most one row. The span ends
+// on Scan, or on Err if the query failed.
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...any) *Row {
+	return queryRowContext(ctx, db.instrumentation, db.DB.QueryRowContext, query, args...)
+}
+
+// QueryRow is QueryRowContext with a background context.
+func (db *DB) QueryRow(query string, args ...any) *Row {
+	return db.QueryRowContext(context.Background(), query, args...)
+}
+
+// PrepareContext prepares a statement. Executions of the returned Stmt are
+// recorded as their own spans.
+func (db *DB) PrepareContext(ctx context.Context, query string) (*Stmt, error) {
+	return prepareContext(ctx, db.instrumentation, db.DB.PrepareContext, query)
+}
+
+// Prepare is PrepareContext with a background context.
+func (db *DB) Prepare(query string) (*Stmt, error) {
+	return db.PrepareContext(context.Background(), query)
+}
+
+// BeginTx starts a transaction. The transaction span stays open until Commit
+// or Rollback, and statements run inside it become its children.
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	start := time.Now()
+	txCtx, span := db.instrumentation.start(ctx, "TRANSACTION", "")
+
+	tx, err := db.DB.BeginTx(txCtx, opts)
+	if err != nil {
+		db.instrumentation.finish(span, start, err)
+		return nil, err
+	}
+	return &Tx{tx: tx, ctx: txCtx, span: span, start: start, instrumentation: db.instrumentation}, nil
+}
+
+// Begin is BeginTx with a background context and default options.
+func (db *DB) Begin() (*Tx, error) {
+	return db.BeginTx(context.Background(), nil)
+}
+
+// Tx is an instrumented *sql.Tx.
+type Tx struct {
+	tx              *sql.Tx
+	ctx             context.Context
+	span            trace.Span
+	start           time.Time
+	instrumentation *instrumentation
+}
+
+// withTxSpan parents statement spans under the transaction span.
+func (tx *Tx) withTxSpan(ctx context.Context) context.Context {
+	return trace.ContextWithSpan(ctx, tx.span)
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return execContext(tx.withTxSpan(ctx), tx.instrumentation, tx.tx.ExecContext, query, args...)
+}
+
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...any) (*Rows, error) {
+	return queryContext(tx.withTxSpan(ctx), tx.instrumentation, tx.tx.QueryContext, query, args...)
+}
+
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...any) *Row {
+	return queryRowContext(tx.withTxSpan(ctx), tx.instrumentation, tx.tx.QueryRowContext, query, args...)
+}
+
+func (tx *Tx) PrepareContext(ctx context.Context, query string) (*Stmt, error) {
+	stmt, err := prepareContext(tx.withTxSpan(ctx), tx.instrumentation, tx.tx.PrepareContext, query)
+	if err != nil {
+		return nil, err
+	}
+	stmt.ctx = tx.ctx
+	return stmt, nil
+}
+
+// StmtContext returns a transaction-specific version of a statement prepared on the DB.
+func (tx *Tx) StmtContext(ctx context.Context, stmt *Stmt) *Stmt {
+	return &Stmt{stmt: tx.tx.StmtContext(ctx, stmt.stmt), query: stmt.query, ctx: tx.ctx, instrumentation: tx.instrumentation}
+}
+
+// Commit commits the transaction and ends its span.
+func (tx *Tx) Commit() error {
+	err := tx.tx.Commit()
+	tx.span.SetAttributes(attribute.String("db.transaction.outcome", "commit"))
+	tx.instrumentation.finish(tx.span, tx.start, err)
+	return err
+}
+
+// Rollback aborts the transaction and ends its span. Calling Rollback after
+// Commit is a no-op, so it can be deferred safely.
+func (tx *Tx) Rollback() error {
+	err := tx.tx.Rollback()
+	if errors.Is(err, sql.ErrTxDone) {
+		return err
+	}
+	tx.span.SetAttributes(attribute.String("db.transaction.outcome", "rollback"))
+	tx.instrumentation.finish(tx.span, tx.start, err)
+	return err
+}
+
+// Stmt is an instrumented *sql.Stmt.
+type Stmt struct {
+	stmt  *sql.Stmt
+	query string
+	// ctx is the transaction context for statements bound to a Tx, nil otherwise.
+	ctx             context.Context
+	instrumentation *instrumentation
+}
+
+// parentContext keeps statements bound to a transaction under the transaction span.
+func (s *Stmt) parentContext(ctx context.Context) context.Context {
+	if s.ctx != nil {
+		return trace.ContextWithSpan(ctx, trace.SpanFromContext(s.ctx))
+	}
+	return ctx
+}
+
+func (s *Stmt) ExecContext(ctx context.Context, args ...any) (sql.Result, error) {
+	exec := func(ctx context.Context, _ string, args ...any) (sql.Result, error) {
+		return s.stmt.ExecContext(ctx, args...)
+	}
+	return execContext(s.parentContext(ctx), s.instrumentation, exec, s.query, args...)
+}
+
+func (s *Stmt) QueryContext(ctx context.Context, args ...any) (*Rows, error) {
+	query := func(ctx context.Context, _ string, args ...any) (*sql.Rows, error) {
+		return s.stmt.QueryContext(ctx, args...)
+	}
+	return queryContext(s.parentContext(ctx), s.instrumentation, query, s.query, args...)
+}
+
+func (s *Stmt) QueryRowContext(ctx context.Context, args ...any) *Row {
+	queryRow := func(ctx context.Context, _ string, args ...any) *sql.Row {
+		return s.stmt.QueryRowContext(ctx, args...)
+	}
+	return queryRowContext(s.parentContext(ctx), s.instrumentation, queryRow, s.query, args...)
+}
+
+func (s *Stmt) Close() error {
+	return s.stmt.Close()
+}
+
+// Rows wraps *sql.Rows to count the rows read and end the query span once the
+// last row was read, or on Close if that comes first.
+type Rows struct {
+	*sql.Rows
+	span            trace.Span
+	start           time.Time
+	count           int
+	ended           bool
+	instrumentation *instrumentation
+}
+
+func (r *Rows) Next() bool {
+	if r.Rows.Next() {
+		r.count++
+		return true
+	}
+	// Next returns false at the end of the result set or on an error.
+	r.end(r.Rows.Err())
+	return false
+}
+
+// Close closes the result set and ends the query span.
+func (r *Rows) Close() error {
+	err := r.Rows.Close()
+	if err == nil {
+		err = r.Rows.Err()
+	}
+	r.end(err)
+	return err
+}
+
+// end ends the query span the first time it is called.
+func (r *Rows) end(err error) {
+	if r.ended {
+		return
+	}
+	r.ended = true
+	r.span.SetAttributes(dbRowsReturnedKey.Int(r.count))
+	r.instrumentation.finish(r.span, r.start, err)
+}
+
+// Row wraps *sql.Row and ends the query span on Scan, or on Err if the query failed.
+type Row struct {
+	row             *sql.Row
+	span            trace.Span
+	start           time.Time
+	ended           bool
+	instrumentation *instrumentation
+}
+
+func (r *Row) Scan(dest ...any) error {
+	err := r.row.Scan(dest...)
+	returned := 1
+	if err != nil {
+		returned = 0
+	}
+	r.end(returned, err)
+	return err
+}
+
+// Err returns the error of the query, if any, without scanning the row. A
+// failed query ends the span, since Scan would only return the same error.
+func (r *Row) Err() error {
+	err := r.row.Err()
+	if err != nil {
+		r.end(0, err)
+	}
+	return err
+}
+
+// end ends the query span the first time it is called.
+func (r *Row) end(returned int, err error) {
+	if r.ended {
+		return
+	}
+	r.ended = true
+	r.span.SetAttributes(dbRowsReturnedKey.Int(returned))
+	r.instrumentation.finish(r.span, r.start, err)
+}
+
+func execContext(ctx context.Context, in *instrumentation, exec func(context.Context, string, ...any) (sql.Result, error), query string, args ...any) (sql.Result, error) {
+	start := time.Now()
+	ctx, span := in.start(ctx, operationName(query), query)
+
+	res, err := exec(ctx, query, args...)
+	if err == nil {
+		if affected, rowsErr := res.RowsAffected(); rowsErr == nil {
+			span.SetAttributes(dbRowsAffectedKey.Int64(affected))
+		}
+	}
+	in.finish(span, start, err)
+	return res, err
+}
+
+func queryContext(ctx context.Context, in *instrumentation, query func(context.Context, string, ...any) (*sql.Rows, error), statement string, args ...any) (*Rows, error) {
+	start := time.Now()
+	ctx, span := in.start(ctx, operationName(statement), statement)
+
+	rows, err := query(ctx, statement, args...)
+	if err != nil {
+		in.finish(span, start, err)
+		return nil, err
+	}
+	return &Rows{Rows: rows, span: span, start: start, instrumentation: in}, nil
+}
+
+func queryRowContext(ctx context.Context, in *instrumentation, queryRow func(context.Context, string, ...any) *sql.Row, query string, args ...any) *Row {
+	start := time.Now()
+	ctx, span := in.start(ctx, operationName(query), query)
+	return &Row{row: queryRow(ctx, query, args...), span: span, start: start, instrumentation: in}
+}
+
+func prepareContext(ctx context.Context, in *instrumentation, prepare func(context.Context, string) (*sql.Stmt, error), query string) (*Stmt, error) {
+	start := time.Now()
+	spanCtx, span := in.start(ctx, "PREPARE", query)
+
+	stmt, err := prepare(spanCtx, query)
+	in.finish(span, start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &Stmt{stmt: stmt, query: query, instrumentation: in}, nil
+}
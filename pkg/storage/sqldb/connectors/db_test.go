@@ -0,0 +1,178 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// fakeDriver answers every query with rowCount rows of one integer column, or
+// with queryErr.
+type fakeDriver struct {
+	rowCount int
+	queryErr error
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{driver: d}, nil }
+
+type fakeConn struct{ driver *fakeDriver }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return &fakeStmt{driver: c.driver}, nil }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+type fakeStmt struct{ driver *fakeDriver }
+
+func (s *fakeStmt) Close() error                               { return nil }
+func (s *fakeStmt) NumInput() int                              { return -1 }
+func (s *fakeStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(0), nil }
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	if s.driver.queryErr != nil {
+		return nil, s.driver.queryErr
+	}
+	return &fakeRows{left: s.driver.rowCount}, nil
+}
+
+type fakeRows struct{ left int }
+
+func (r *fakeRows) Columns() []string { return []string{"n"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.left == 0 {
+		return io.EOF
+	}
+	r.left--
+	dest[0] = int64(r.left)
+	return nil
+}
+
+func newTestDB(t *testing.T, d *fakeDriver) (*DB, *tracetest.SpanRecorder) {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	db := NewDB(sql.OpenDB(&fakeConnector{driver: d}), &DBConfig{DBDriver: "fake", DBName: "test"})
+	db.instrumentation.tracer = provider.Tracer(tracerName)
+	t.Cleanup(func() { db.Close() })
+	return db, recorder
+}
+
+type fakeConnector struct{ driver *fakeDriver }
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) { return c.driver.Open("") }
+func (c *fakeConnector) Driver() driver.Driver                        { return c.driver }
+
+func TestRowsEndSpan(t *testing.T) {
+	tests := []struct {
+		name  string
+		read  func(rows *Rows)
+		ended bool
+	}{
+		{name: "read to the end", read: func(rows *Rows) {
+			for rows.Next() {
+			}
+		}, ended: true},
+		{name: "closed early", read: func(rows *Rows) {
+			rows.Next()
+			rows.Close()
+		}, ended: true},
+		{name: "read to the end and closed", read: func(rows *Rows) {
+			for rows.Next() {
+			}
+			rows.Close()
+		}, ended: true},
+		{name: "still reading", read: func(rows *Rows) {
+			rows.Next()
+		}, ended: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, recorder := newTestDB(t, &fakeDriver{rowCount: 3})
+			rows, err := db.QueryContext(context.Background(), "SELECT n FROM t")
+			if err != nil {
+				t.Fatalf("QueryContext() error = %v", err)
+			}
+			defer rows.Close()
+
+			tt.read(rows)
+			if ended := len(recorder.Ended()); ended != btoi(tt.ended) {
+				t.Errorf("%d spans ended, want %d", ended, btoi(tt.ended))
+			}
+		})
+	}
+}
+
+func TestRowsRecordsRowCount(t *testing.T) {
+	db, recorder := newTestDB(t, &fakeDriver{rowCount: 3})
+	rows, err := db.QueryContext(context.Background(), "SELECT n FROM t")
+	if err != nil {
+		t.Fatalf("QueryContext() error = %v", err)
+	}
+	for rows.Next() {
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("%d spans ended, want 1", len(spans))
+	}
+	for _, attr := range spans[0].Attributes() {
+		if attr.Key == dbRowsReturnedKey && attr.Value.AsInt64() != 3 {
+			t.Errorf("%s = %d, want 3", dbRowsReturnedKey, attr.Value.AsInt64())
+		}
+	}
+}
+
+func TestRowEndsSpan(t *testing.T) {
+	queryErr := errors.New("connection reset")
+	tests := []struct {
+		name     string
+		driver   *fakeDriver
+		call     func(row *Row) error
+		wantErr  error
+		wantEnds int
+	}{
+		{name: "scan", driver: &fakeDriver{rowCount: 1}, call: func(row *Row) error {
+			var n int
+			return row.Scan(&n)
+		}, wantEnds: 1},
+		{name: "scan no rows", driver: &fakeDriver{}, call: func(row *Row) error {
+			var n int
+			return row.Scan(&n)
+		}, wantErr: sql.ErrNoRows, wantEnds: 1},
+		{name: "err of a failed query", driver: &fakeDriver{queryErr: queryErr}, call: func(row *Row) error {
+			return row.Err()
+		}, wantErr: queryErr, wantEnds: 1},
+		{name: "err then scan", driver: &fakeDriver{queryErr: queryErr}, call: func(row *Row) error {
+			row.Err()
+			var n int
+			return row.Scan(&n)
+		}, wantErr: queryErr, wantEnds: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, recorder := newTestDB(t, tt.driver)
+			err := tt.call(db.QueryRowContext(context.Background(), "SELECT n FROM t"))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if ended := len(recorder.Ended()); ended != tt.wantEnds {
+				t.Errorf("%d spans ended, want %d", ended, tt.wantEnds)
+			}
+		})
+	}
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -1,7 +1,6 @@
 package sqldb
 
 import (
-	"database/sql"
 	"fmt"
 )
 
@@ -10,8 +9,10 @@ const (
 	DB_POSTGRES = "postgres"
 )
 
+// Connector opens a database connection. The returned DB is instrumented with
+// tracing and dependency metrics.
 type Connector interface {
-	Connect() (*sql.DB, error)
+	Connect() (*DB, error)
 }
 
 type DBConfig struct {
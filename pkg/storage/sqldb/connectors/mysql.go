@@ -15,7 +15,7 @@ func NewMySQLConnector(cfg *DBConfig) Connector {
 	return &mysqlconnector{cfg: cfg}
 }
 
-func (m *mysqlconnector) Connect() (*sql.DB, error) {
+func (m *mysqlconnector) Connect() (*DB, error) {
 	dsn := m.cfg.dsn(DB_MYSQL)
 	db, err := sql.Open(DB_MYSQL, dsn)
 	if err != nil {
@@ -25,5 +25,5 @@ func (m *mysqlconnector) Connect() (*sql.DB, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to ping MySql DB. Error: %w", err)
 	}
-	return db, nil
+	return NewDB(db, m.cfg), nil
 }
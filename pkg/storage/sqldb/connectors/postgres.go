@@ -15,7 +15,7 @@ func NewPostgreSQLConnector(cfg *DBConfig) Connector {
 	return &postgressqlconnector{cfg: cfg}
 }
 
-func (m *postgressqlconnector) Connect() (*sql.DB, error) {
+func (m *postgressqlconnector) Connect() (*DB, error) {
 	dsn := m.cfg.dsn(DB_POSTGRES)
 	db, err := sql.Open(DB_POSTGRES, dsn)
 	if err != nil {
@@ -25,5 +25,5 @@ func (m *postgressqlconnector) Connect() (*sql.DB, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to ping MySql DB. Error: %w", err)
 	}
-	return db, nil
+	return NewDB(db, m.cfg), nil
 }
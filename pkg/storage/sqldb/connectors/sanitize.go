@@ -0,0 +1,88 @@
+package sqldb
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SanitizeSQL replaces string and numeric literals in a statement with '?'
+// and collapses whitespace, so that statements can be recorded on spans
+// without leaking values such as names or keys. '...' is a string literal and
+// `...` a quoted identifier, which is kept. "..." is a string literal for
+// DB_MYSQL and a quoted identifier for the other drivers.
+func SanitizeSQL(driver, query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	lastSpace := true
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' && driver == DB_MYSQL:
+			// Skip to the closing quote. A doubled quote is an escaped quote.
+			for i++; i < len(query); i++ {
+				if query[i] == '\\' {
+					i++
+					continue
+				}
+				if query[i] == c {
+					if i+1 < len(query) && query[i+1] == c {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			b.WriteByte('?')
+			lastSpace = false
+
+		case c == '"' || c == '`':
+			// Copy a quoted identifier as it is, digits included.
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				end = len(query) - i - 1
+			} else {
+				end++
+			}
+			b.WriteString(query[i : i+end+1])
+			i += end
+			lastSpace = false
+
+		case isDigit(c) && (i == 0 || !isIdentifier(query[i-1])):
+			for i+1 < len(query) && (isDigit(query[i+1]) || query[i+1] == '.') {
+				i++
+			}
+			b.WriteByte('?')
+			lastSpace = false
+
+		case unicode.IsSpace(rune(c)):
+			if !lastSpace {
+				b.WriteByte(' ')
+				lastSpace = true
+			}
+
+		default:
+			b.WriteByte(c)
+			lastSpace = false
+		}
+	}
+
+	return strings.TrimSpace(b.String())
+}
+
+// operationName returns the leading SQL keyword, e.g. SELECT or INSERT.
+func operationName(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "QUERY"
+	}
+	return strings.ToUpper(fields[0])
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentifier(c byte) bool {
+	return c == '_' || c == '$' || isDigit(c) || (c|0x20 >= 'a' && c|0x20 <= 'z')
+}
@@ -0,0 +1,49 @@
+package sqldb
+
+import "testing"
+
+func TestSanitizeSQL(t *testing.T) {
+	tests := []struct {
+		name   string
+		driver string
+		query  string
+		want   string
+	}{
+		{name: "string literal", query: "SELECT * FROM apps WHERE name = 'billing'", want: "SELECT * FROM apps WHERE name = ?"},
+		{name: "escaped quotes", query: `SELECT 'it''s', 'a\'b' FROM t`, want: "SELECT ?, ? FROM t"},
+		{name: "numbers", query: "SELECT * FROM apps WHERE id = 42 AND ratio > 0.5", want: "SELECT * FROM apps WHERE id = ? AND ratio > ?"},
+		{name: "digits in identifiers", query: "SELECT col1 FROM table2", want: "SELECT col1 FROM table2"},
+		{name: "placeholders", query: "UPDATE app_plans SET burst = ? WHERE app_name = $1", want: "UPDATE app_plans SET burst = ? WHERE app_name = $1"},
+		{name: "double quoted identifier", driver: DB_POSTGRES, query: `SELECT "user" FROM "app plans"`, want: `SELECT "user" FROM "app plans"`},
+		{name: "digits in quoted identifiers", driver: DB_POSTGRES, query: "SELECT `col 2`, \"3d\" FROM t", want: "SELECT `col 2`, \"3d\" FROM t"},
+		{name: "unterminated identifier", driver: DB_POSTGRES, query: `SELECT "abc`, want: `SELECT "abc`},
+		{name: "double quoted string in MySQL", driver: DB_MYSQL, query: `SELECT * FROM apps WHERE api_key = "s3cr""et\"" AND name = 'x'`, want: "SELECT * FROM apps WHERE api_key = ? AND name = ?"},
+		{name: "backquoted identifier in MySQL", driver: DB_MYSQL, query: "SELECT `col 2` FROM t", want: "SELECT `col 2` FROM t"},
+		{name: "whitespace", query: "  SELECT\n\t*   FROM  apps  ", want: "SELECT * FROM apps"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeSQL(tt.driver, tt.query); got != tt.want {
+				t.Errorf("SanitizeSQL(%q, %q) = %q, want %q", tt.driver, tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOperationName(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "select * from apps", want: "SELECT"},
+		{query: "  INSERT INTO apps VALUES (?)", want: "INSERT"},
+		{query: "", want: "QUERY"},
+	}
+
+	for _, tt := range tests {
+		if got := operationName(tt.query); got != tt.want {
+			t.Errorf("operationName(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}